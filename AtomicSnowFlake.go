@@ -0,0 +1,197 @@
+package main
+
+import (
+        "context"
+        "errors"
+        "log/slog"
+        "sync/atomic"
+        "time"
+        "go.opentelemetry.io/otel/attribute"
+        "go.opentelemetry.io/otel/trace"
+)
+
+// AtomicSnowFlake generates the same ids as SnowFlake without a mutex. The elapsed time and the
+// sequence of the last id handed out are packed into one word,
+//
+//     state = elapsedTime << BitLenSequence | sequence
+//
+// which callers advance with compare-and-swap. Adding one to a state whose sequence is exhausted carries
+// into the time part, so the caller gets the first id of the next tick and sleeps until that tick starts.
+// Every successful swap yields a state larger than the previous one, so ids stay unique and increase in the
+// order they are handed out. A range of n ids moves the sequence by n at once.
+//
+// Under load the state runs ahead of the clock, the SequencePolicy decides whether a caller waits for its
+// tick or fails. The clock moving backwards is told apart by the latest clock reading, not by the state.
+type AtomicSnowFlake struct {
+        state           uint64 // atomic
+        lastClock       int64  // atomic, the latest elapsed time read from the clock
+        startTime       int64
+        machineID       uint16
+        machineIDSource string
+        layout          Layout
+        timeUnit        int64
+        logger          *slog.Logger
+        policy          SequencePolicy
+        randomStart     bool
+}
+
+// atomicMaxLead bounds how many ticks ahead of the clock the state may run. A caller which would move it
+// further waits for the clock before it swaps, so the state does not race ahead of the waiting callers.
+const atomicMaxLead = 16
+
+// NewAtomicSnowFlake returns a new AtomicSnowFlake configured with the given Settings.
+// It returns nil in the same cases as NewSnowFlake, if the SequencePolicy may borrow ticks, which needs
+// the lock around the state file, and if a SequenceMultiplier is set, whose ids cannot be handed out in order.
+func NewAtomicSnowFlake(st Settings) *AtomicSnowFlake {
+        if st.SequencePolicy.MaxBorrow > 0 || st.SequenceMultiplier != 0 {
+                return nil
+        }
+        sf := NewSnowFlake(st)
+        if sf == nil {
+                return nil
+        }
+        return &AtomicSnowFlake{startTime: sf.startTime, machineID: sf.machineID, machineIDSource: sf.machineIDSource,
+                layout: sf.layout, timeUnit: sf.timeUnit, logger: sf.logger, policy: sf.policy,
+                randomStart: sf.randomStart}
+}
+
+// NextID generates a next unique ID.
+func (sf *AtomicSnowFlake) NextID() (uint64, error) {
+        return sf.NextIDContext(context.Background())
+}
+
+// NextIDContext is NextID with the wait for the next tick traced as a child of ctx.
+func (sf *AtomicSnowFlake) NextIDContext(ctx context.Context) (uint64, error) {
+        id, _, err := sf.NextIDRangeContext(ctx, 1)
+        return id, err
+}
+
+// NextIDs returns n ids in increasing order, like SnowFlake.NextIDs.
+func (sf *AtomicSnowFlake) NextIDs(n int) ([]uint64, error) {
+        return sf.NextIDsContext(context.Background(), n)
+}
+
+// NextIDsContext is NextIDs with the wait for the next tick traced as a child of ctx.
+func (sf *AtomicSnowFlake) NextIDsContext(ctx context.Context, n int) ([]uint64, error) {
+        return collectRanges(ctx, sf, n)
+}
+
+// NextIDRange returns the first and the last of n consecutive ids, n is at most the ids of a tick.
+func (sf *AtomicSnowFlake) NextIDRange(n int) (uint64, uint64, error) {
+        return sf.NextIDRangeContext(context.Background(), n)
+}
+
+// NextIDRangeContext is NextIDRange with the wait for the next tick traced as a child of ctx.
+func (sf *AtomicSnowFlake) NextIDRangeContext(ctx context.Context, n int) (uint64, uint64, error) {
+        maxSequence := uint64(sf.layout.maxSequence())
+        if err := checkCount(n, int(maxSequence) + 1); err != nil {
+                return 0, 0, err
+        }
+        seqBits := sf.layout.BitLenSequence
+        policy := sequencePolicyFrom(ctx, sf.policy)
+        for {
+                old := atomic.LoadUint64(&sf.state)
+                current, err := sf.readClock()
+                if err != nil {
+                        return 0, 0, err
+                }
+                start := uint64(sf.layout.startSequence(sf.randomStart, n)) // first sequence number of a new tick
+                var next uint64
+                switch {
+                case current > int64(old >> seqBits):
+                        // the clock has moved past the last tick handed out
+                        next = uint64(current) << seqBits | (start + uint64(n - 1))
+                case old & maxSequence + uint64(n) <= maxSequence:
+                        next = old + uint64(n)
+                default:
+                        // the rest of the tick is too short, move on to the following tick
+                        next = (old >> seqBits + 1) << seqBits | (start + uint64(n - 1))
+                }
+                tick := int64(next >> seqBits)
+                if wait := sf.waitTime(tick); policy.failsAfter(wait) {
+                        // give up before the swap, so the state does not run ahead of the clock
+                        return 0, 0, &SequenceExhaustedError{RetryAfter: wait}
+                }
+                if tick - current > atomicMaxLead {
+                        sf.sleep(ctx, sf.waitTime(tick - atomicMaxLead))
+                        continue
+                }
+                if atomic.CompareAndSwapUint64(&sf.state, old, next) {
+                        upper, err := sf.issue(ctx, next)
+                        if err != nil {
+                                return 0, 0, err
+                        }
+                        return upper - uint64(n - 1), upper, nil
+                }
+        }
+}
+
+// MachineID returns the machine id part of the ids.
+func (sf *AtomicSnowFlake) MachineID() uint16 {
+        return sf.machineID
+}
+
+// Layout returns the bit layout of the ids.
+func (sf *AtomicSnowFlake) Layout() Layout {
+        return sf.layout
+}
+
+// Describe returns the strategy, layout, epoch and time unit of the ids.
+func (sf *AtomicSnowFlake) Describe() Description {
+        return Description{
+                Strategy:        StrategySnowFlake,
+                RangeSize:       int(sf.layout.maxSequence()) + 1,
+                MachineID:       sf.machineID,
+                MachineIDSource: sf.machineIDSource,
+                SnowFlake:       &Descriptor{Layout: sf.layout, StartTime: time.Unix(0, sf.startTime * sf.timeUnit).UTC(),
+                        TimeUnit: time.Duration(sf.timeUnit)},
+        }
+}
+
+// readClock returns the elapsed time and records it as the latest reading. The latest reading is loaded
+// before the clock is read, so a reading behind it means the clock moved backwards.
+func (sf *AtomicSnowFlake) readClock() (int64, error) {
+        last := atomic.LoadInt64(&sf.lastClock)
+        current := sf.currentElapsedTime()
+        if current < last {
+                sf.logger.Error("clock moved backwards, refusing to generate ids", "recent_time", last, "current_time", current)
+                return 0, errors.New("clock moved backwards")
+        }
+        for current > last && !atomic.CompareAndSwapInt64(&sf.lastClock, last, current) {
+                last = atomic.LoadInt64(&sf.lastClock)
+        }
+        return current, nil
+}
+
+// issue turns a state won by compare-and-swap into an id, after waiting for its tick if it is ahead of the clock.
+// The wait is taken from the clock after the swap, the caller may have been descheduled since it read the clock.
+func (sf *AtomicSnowFlake) issue(ctx context.Context, state uint64) (uint64, error) {
+        seqBits := sf.layout.BitLenSequence
+        tick := int64(state >> seqBits)
+        sf.sleep(ctx, sf.waitTime(tick))
+        return sf.layout.toID(tick, sf.machineID, uint16(state & uint64(sf.layout.maxSequence())))
+}
+
+// sleep waits inside a span, if at all.
+func (sf *AtomicSnowFlake) sleep(ctx context.Context, wait time.Duration) {
+        if wait <= 0 {
+                return
+        }
+        _, span := tracer().Start(ctx, "snowflake tick wait",
+                trace.WithAttributes(attribute.Int64("snowflake.wait_ns", int64(wait))))
+        time.Sleep(wait)
+        span.End()
+}
+
+// waitTime is the time until tick starts, 0 if it has started.
+func (sf *AtomicSnowFlake) waitTime(tick int64) time.Duration {
+        wait := time.Duration((sf.startTime + tick) * sf.timeUnit - time.Now().UnixNano())
+        if wait < 0 {
+                return 0
+        }
+        return wait
+}
+
+func (sf *AtomicSnowFlake) currentElapsedTime() int64 {
+        return time.Now().UTC().UnixNano() / sf.timeUnit - sf.startTime
+}
@@ -0,0 +1,204 @@
+package main
+import (
+        "context"
+        "sync"
+        "testing"
+        "time"
+        "github.com/stretchr/testify/assert"
+)
+
+func getAtomicSnowFlake() *AtomicSnowFlake {
+        var settings Settings
+        settings.StartTime = time.Now()
+        settings.MachineID = mockMachineId
+        sf := NewAtomicSnowFlake(settings)
+        if sf == nil {
+                panic("AtomicSnowFlake not created")
+        }
+        return sf
+}
+
+func TestAtomicSnowFlakeOnce(t *testing.T) {
+        sf := getAtomicSnowFlake()
+        id, err := sf.NextID()
+        assert.Nil(t, err, "id not generated")
+        parts := decompose(id)
+        assert.Equal(t, uint64(0), parts["msb"], "msb should be 0")
+        assert.Equal(t, uint64(321), parts["machine-id"], "machine id mismatch")
+        assert.Equal(t, uint16(321), sf.MachineID(), "machine id mismatch")
+        assert.Equal(t, DefaultLayout, sf.Layout(), "layout mismatch")
+}
+
+func TestAtomicSnowFlakeInParallel(t *testing.T) {
+        sf := getAtomicSnowFlake()
+        const numID = 10000
+        const numGenerator = 10
+        results := make([][]uint64, numGenerator)
+        var wg sync.WaitGroup
+        for i := 0; i < numGenerator; i++ {
+                wg.Add(1)
+                go func(i int) {
+                        defer wg.Done()
+                        for j := 0; j < numID; j++ {
+                                id, err := sf.NextID()
+                                if err != nil {
+                                        t.Error("id not generated")
+                                        return
+                                }
+                                results[i] = append(results[i], id)
+                        }
+                }(i)
+        }
+        wg.Wait()
+
+        seen := make(map[uint64]bool, numID*numGenerator)
+        for _, ids := range results {
+                for j, id := range ids {
+                        if seen[id] {
+                                t.Fatal("duplicated id")
+                        }
+                        seen[id] = true
+                        if j > 0 && id <= ids[j-1] {
+                                t.Fatalf("ids of one goroutine not increasing: %d after %d", id, ids[j-1])
+                        }
+                }
+        }
+        assert.Equal(t, numID*numGenerator, len(seen), "number of unique ids mismatch")
+}
+
+func TestAtomicSnowFlakeRangeAndList(t *testing.T) {
+        sf := getAtomicSnowFlake()
+        id, err := sf.NextID()
+        assert.Nil(t, err, "id not generated")
+        lower, upper, err := sf.NextIDRange(256)
+        assert.Nil(t, err, "range not generated")
+        assert.Equal(t, uint64(255), upper - lower, "range should be a tick")
+        assert.True(t, lower > id, "range should follow the id handed out before")
+        parts := decompose(lower)
+        assert.Equal(t, uint64(0), parts["sequence"], "range should start a tick")
+
+        list, err := sf.NextIDs(256)
+        assert.Nil(t, err, "list not generated")
+        assert.Equal(t, 256, len(list), "list should be a tick")
+        assert.True(t, list[0] > upper, "ranges should not overlap")
+
+        next, err := sf.NextID()
+        assert.Nil(t, err, "id not generated")
+        assert.True(t, next > list[len(list)-1], "id should follow the list handed out before")
+}
+
+func TestAtomicSnowFlakeClockMovedBackwards(t *testing.T) {
+        sf := getAtomicSnowFlake()
+        _, err := sf.NextID()
+        assert.Nil(t, err, "id not generated")
+        // the clock moved back by two seconds
+        sf.startTime += 200
+        _, err = sf.NextID()
+        assert.NotNil(t, err, "clock moving backwards should be an error")
+        _, err = sf.NextIDs(256)
+        assert.NotNil(t, err, "clock moving backwards should be an error")
+        _, _, err = sf.NextIDRange(256)
+        assert.NotNil(t, err, "clock moving backwards should be an error")
+}
+
+func TestAtomicSnowFlakeConcurrentRanges(t *testing.T) {
+        settings := Settings{StartTime: time.Now(), MachineID: mockMachineId, TimeUnit: time.Millisecond}
+        sf := NewAtomicSnowFlake(settings)
+        const numRange = 300
+        lowers := make([]uint64, numRange)
+        errs := make([]error, numRange)
+        var wg sync.WaitGroup
+        for i := 0; i < numRange; i++ {
+                wg.Add(1)
+                go func(i int) {
+                        defer wg.Done()
+                        lowers[i], _, errs[i] = sf.NextIDRange(256)
+                }(i)
+        }
+        wg.Wait()
+        seen := make(map[uint64]bool, numRange)
+        for i := range lowers {
+                assert.Nil(t, errs[i], "a whole tick range should wait for its tick")
+                assert.False(t, seen[lowers[i]], "ranges should not overlap")
+                seen[lowers[i]] = true
+        }
+}
+
+func TestAtomicSnowFlakeLeadFollowsPolicy(t *testing.T) {
+        settings := Settings{StartTime: time.Now().Add(-time.Hour), MachineID: mockMachineId, TimeUnit: time.Minute,
+                SequencePolicy: SequencePolicy{Mode: SequenceFail}}
+        sf := NewAtomicSnowFlake(settings)
+        _, _, err := sf.NextIDRange(256)
+        assert.Nil(t, err, "range not generated")
+        _, _, err = sf.NextIDRange(256)
+        exhausted, ok := err.(*SequenceExhaustedError)
+        assert.True(t, ok, "a tick ahead should exhaust the sequence, not look like the clock moving backwards: %v", err)
+        if ok {
+                assert.True(t, exhausted.RetryAfter > 0 && exhausted.RetryAfter <= time.Minute, "retry after the tick starts")
+        }
+}
+
+func TestAtomicSnowFlakeWaitsForTick(t *testing.T) {
+        sf := getAtomicSnowFlake()
+        // a state won for a tick ahead, issued with a stale clock reading
+        tick := sf.currentElapsedTime() + 5
+        id, err := sf.issue(context.Background(), uint64(tick) << sf.layout.BitLenSequence)
+        assert.Nil(t, err, "id not generated")
+        assert.True(t, sf.currentElapsedTime() >= tick, "the id should only be handed out once its tick started")
+        assert.Equal(t, uint64(tick), decompose(id)["time"], "time mismatch")
+}
+
+// benchmarkSettings leaves enough sequence space per tick that the benchmarks measure the generators
+// rather than the waits for the next tick. Compare both with: go test -run xxx -bench NextID -cpu=1,4,16
+func benchmarkSettings() Settings {
+        return Settings{
+                StartTime: time.Now(),
+                MachineID: mockMachineId,
+                Layout:    Layout{BitLenTime: 39, BitLenMachineID: 10, BitLenSequence: 14},
+                TimeUnit:  time.Millisecond,
+        }
+}
+
+func BenchmarkMutexNextID(b *testing.B) {
+        sf := NewSnowFlake(benchmarkSettings())
+        b.RunParallel(func(pb *testing.PB) {
+                for pb.Next() {
+                        if _, err := sf.NextID(); err != nil {
+                                b.Fatal(err)
+                        }
+                }
+        })
+}
+
+func BenchmarkAtomicNextID(b *testing.B) {
+        sf := NewAtomicSnowFlake(benchmarkSettings())
+        b.RunParallel(func(pb *testing.PB) {
+                for pb.Next() {
+                        if _, err := sf.NextID(); err != nil {
+                                b.Fatal(err)
+                        }
+                }
+        })
+}
+
+func BenchmarkMutexNextIDRange(b *testing.B) {
+        sf := NewSnowFlake(benchmarkSettings())
+        b.RunParallel(func(pb *testing.PB) {
+                for pb.Next() {
+                        if _, _, err := sf.NextIDRange(256); err != nil {
+                                b.Fatal(err)
+                        }
+                }
+        })
+}
+
+func BenchmarkAtomicNextIDRange(b *testing.B) {
+        sf := NewAtomicSnowFlake(benchmarkSettings())
+        b.RunParallel(func(pb *testing.PB) {
+                for pb.Next() {
+                        if _, _, err := sf.NextIDRange(256); err != nil {
+                                b.Fatal(err)
+                        }
+                }
+        })
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+        "bufio"
+        "encoding/json"
+        "errors"
+        "fmt"
+        "io"
+        "os"
+        "sync"
+        "time"
+)
+
+// AuditRecord is a line of the audit log: a range of ids handed out by a pod.
+// Single ids are recorded as a range with equal bounds.
+type AuditRecord struct {
+        Time       time.Time `json:"time"`
+        Host       string    `json:"host"`
+        MachineId  uint16    `json:"machine_id"`
+        Namespace  string    `json:"namespace"`
+        LowerBound uint64    `json:"lower_bound"`
+        UpperBound uint64    `json:"upper_bound"`
+        Client     string    `json:"client,omitempty"`
+}
+
+// AuditLogConfig enables the audit log. The file is rotated once it grows over MaxSizeMB,
+// the rotated files are called path.1 (newest) to path.MaxBackups (oldest).
+type AuditLogConfig struct {
+        Path       string `json:"path"`
+        MaxSizeMB  int    `json:"max_size_mb"` // default 100
+        MaxBackups int    `json:"max_backups"` // default 10
+}
+
+// AuditLog appends AuditRecords as JSON lines. It is safe for concurrent use.
+type AuditLog struct {
+        mutex      sync.Mutex
+        path       string
+        maxSize    int64
+        maxBackups int
+        host       string
+        file       *os.File
+        size       int64
+}
+
+// auditLog is set at startup if the audit log is configured.
+var auditLog *AuditLog
+
+// OpenAuditLog opens the audit log for appending.
+func OpenAuditLog(config AuditLogConfig) (*AuditLog, error) {
+        if config.Path == "" {
+                return nil, errors.New("audit log needs a path")
+        }
+        if config.MaxSizeMB <= 0 {
+                config.MaxSizeMB = 100
+        }
+        if config.MaxBackups <= 0 {
+                config.MaxBackups = 10
+        }
+        host, _ := os.Hostname()
+        l := &AuditLog{path: config.Path, maxSize: int64(config.MaxSizeMB) << 20, maxBackups: config.MaxBackups, host: host}
+        if err := l.open(); err != nil {
+                return nil, err
+        }
+        return l, nil
+}
+
+func (l *AuditLog) open() error {
+        f, err := os.OpenFile(l.path, os.O_WRONLY | os.O_APPEND | os.O_CREATE, 0644)
+        if err != nil {
+                return err
+        }
+        info, err := f.Stat()
+        if err != nil {
+                f.Close()
+                return err
+        }
+        l.file = f
+        l.size = info.Size()
+        return nil
+}
+
+// Record appends a record. Time and Host are filled in if empty.
+func (l *AuditLog) Record(r AuditRecord) error {
+        return l.RecordAll([]AuditRecord{r})
+}
+
+// RecordAll appends the records of one request in a single write, so either all of them or none are logged.
+// Time and Host are filled in if empty.
+func (l *AuditLog) RecordAll(records []AuditRecord) error {
+        now := time.Now().UTC()
+        var lines []byte
+        for _, r := range records {
+                if r.Time.IsZero() {
+                        r.Time = now
+                }
+                if r.Host == "" {
+                        r.Host = l.host
+                }
+                line, err := json.Marshal(r)
+                if err != nil {
+                        return err
+                }
+                lines = append(append(lines, line...), '\n')
+        }
+        l.mutex.Lock()
+        defer l.mutex.Unlock()
+        if l.size > 0 && l.size + int64(len(lines)) > l.maxSize {
+                if err := l.rotate(); err != nil {
+                        return err
+                }
+        }
+        n, err := l.file.Write(lines)
+        l.size += int64(n)
+        return err
+}
+
+// rotate shifts path.i to path.i+1, drops the oldest file and starts a new path.
+func (l *AuditLog) rotate() error {
+        if err := l.file.Close(); err != nil {
+                return err
+        }
+        os.Remove(fmt.Sprintf("%s.%d", l.path, l.maxBackups))
+        for i := l.maxBackups - 1; i >= 1; i-- {
+                os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i + 1))
+        }
+        if err := os.Rename(l.path, l.path + ".1"); err != nil {
+                return err
+        }
+        return l.open()
+}
+
+// Close closes the current file.
+func (l *AuditLog) Close() error {
+        l.mutex.Lock()
+        defer l.mutex.Unlock()
+        return l.file.Close()
+}
+
+// FindIssuers returns the records of the audit log read from r whose range contains id.
+// An empty namespace matches every namespace.
+func FindIssuers(r io.Reader, id uint64, namespace string) ([]AuditRecord, error) {
+        var found []AuditRecord
+        scanner := bufio.NewScanner(r)
+        for scanner.Scan() {
+                var record AuditRecord
+                if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+                        return nil, err
+                }
+                if record.LowerBound <= id && id <= record.UpperBound && (namespace == "" || record.Namespace == namespace) {
+                        found = append(found, record)
+                }
+        }
+        return found, scanner.Err()
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+        "testing"
+        "bytes"
+        "encoding/json"
+        "io/ioutil"
+        "os"
+        "path/filepath"
+        "strings"
+        "github.com/stretchr/testify/assert"
+)
+
+func TestAuditLogRotation(t *testing.T) {
+        path := filepath.Join(t.TempDir(), "audit.log")
+        l, err := OpenAuditLog(AuditLogConfig{Path: path, MaxSizeMB: 1, MaxBackups: 2})
+        if err != nil {
+                t.Fatal("audit log not opened: ", err)
+        }
+        // shrink the max size so that a few records rotate
+        l.maxSize = 400
+        for i := uint64(0); i < 10; i++ {
+                err := l.Record(AuditRecord{MachineId: 321, Namespace: "default", LowerBound: i * 256, UpperBound: i * 256 + 255})
+                assert.Nil(t, err, "record not written")
+        }
+        l.Close()
+        for _, name := range []string{path, path + ".1", path + ".2"} {
+                _, err := os.Stat(name)
+                assert.Nil(t, err, name + " should exist")
+        }
+        _, err = os.Stat(path + ".3")
+        assert.NotNil(t, err, "Only 2 backups should be kept")
+
+        data, _ := ioutil.ReadFile(path)
+        lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+        var last AuditRecord
+        json.Unmarshal([]byte(lines[len(lines) - 1]), &last)
+        assert.Equal(t, uint64(9 * 256), last.LowerBound, "Last record mismatch")
+        assert.NotEqual(t, "", last.Host, "Host should be filled in")
+        assert.Equal(t, false, last.Time.IsZero(), "Time should be filled in")
+}
+
+func TestFindIssuers(t *testing.T) {
+        log := `{"machine_id":1,"namespace":"default","lower_bound":0,"upper_bound":255,"client":"billing"}
+{"machine_id":2,"namespace":"orders","lower_bound":256,"upper_bound":511,"client":"search"}
+{"machine_id":3,"namespace":"default","lower_bound":300,"upper_bound":300}
+`
+        records, err := FindIssuers(strings.NewReader(log), 300, "")
+        assert.Nil(t, err, "audit log should be read")
+        assert.Equal(t, 2, len(records), "Both ranges contain 300")
+        assert.Equal(t, "search", records[0].Client, "Client mismatch")
+
+        records, _ = FindIssuers(strings.NewReader(log), 300, "default")
+        assert.Equal(t, 1, len(records), "Namespace should filter")
+        assert.Equal(t, uint16(3), records[0].MachineId, "Machine id mismatch")
+
+        _, err = FindIssuers(strings.NewReader("not json\n"), 1, "")
+        assert.NotNil(t, err, "Broken lines should be an error")
+}
+
+func TestLongIdsAudited(t *testing.T) {
+        path := filepath.Join(t.TempDir(), "audit.log")
+        l, err := OpenAuditLog(AuditLogConfig{Path: path})
+        if err != nil {
+                t.Fatal("audit log not opened: ", err)
+        }
+        auditLog = l
+        defer func() { auditLog = nil; l.Close() }()
+        router := getAuthRouter(t, []APIKey{{Key: "secret", Client: "billing"}})
+        res := serveWithHeader(router, "/ns/orders/longidrange", "X-API-Key", "secret")
+        idRange := &IDRange{}
+        json.NewDecoder(res.Body).Decode(idRange)
+
+        var out bytes.Buffer
+        err = whoIssuedCommand([]string{"-ns", "orders", "-format", "hex", mustEncode(idRange.LowerBound + 5, IDFormatHex), path}, &out)
+        assert.Nil(t, err, "id should be found")
+        record := &AuditRecord{}
+        json.Unmarshal(out.Bytes(), record)
+        assert.Equal(t, "billing", record.Client, "Client mismatch")
+        assert.Equal(t, "orders", record.Namespace, "Namespace mismatch")
+        assert.Equal(t, idRange.LowerBound, record.LowerBound, "LowerBound mismatch")
+        assert.Equal(t, idRange.UpperBound, record.UpperBound, "UpperBound mismatch")
+
+        err = whoIssuedCommand([]string{"1", path}, &out)
+        assert.NotNil(t, err, "unknown id should not be found")
+}
+
+func TestUnorderedListsAuditedPerRun(t *testing.T) {
+        path := filepath.Join(t.TempDir(), "audit.log")
+        l, err := OpenAuditLog(AuditLogConfig{Path: path})
+        if err != nil {
+                t.Fatal("audit log not opened: ", err)
+        }
+        auditLog = l
+        defer func() { auditLog = nil; l.Close() }()
+        router := getTestRouter(t)
+        registerNamespace(NewGeneratorNamespace("audited-random", NewRandomGenerator(0)))
+
+        idList := &IDList{}
+        json.Unmarshal(serve(router, "/ns/audited-random/longids").Body.Bytes(), idList)
+        serve(router, "/ns/orders/longids")
+        data, _ := ioutil.ReadFile(path)
+        lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+        assert.Equal(t, len(idList.List) + 1, len(lines), "a record per random id and one for the consecutive list")
+        var covered uint64
+        for _, line := range lines[:len(lines) - 1] {
+                record := &AuditRecord{}
+                json.Unmarshal([]byte(line), record)
+                covered += record.UpperBound - record.LowerBound + 1
+        }
+        assert.Equal(t, uint64(len(idList.List)), covered, "the records cover only the ids handed out")
+        records, err := FindIssuers(strings.NewReader(string(data)), idList.List[7], "audited-random")
+        assert.Nil(t, err, "audit log should be readable")
+        assert.Equal(t, 1, len(records), "the random id should be found once")
+}
+
+func mustEncode(id uint64, format string) string {
+        s, err := Encode(id, format)
+        if err != nil {
+                panic(err)
+        }
+        return s
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+        "bufio"
+        "container/heap"
+        "encoding/binary"
+        "encoding/json"
+        "fmt"
+        "io"
+        "os"
+        "sort"
+        "strings"
+        "time"
+)
+
+// Kinds of violations found by AuditIDs.
+const (
+        ViolationDuplicate         = "duplicate"
+        ViolationMachineIDMismatch = "machine_id_mismatch"
+        ViolationNonMonotonic      = "non_monotonic"
+        ViolationFutureTimestamp   = "future_timestamp"
+)
+
+// AuditConfig describes the generator whose ids are audited and bounds the memory of the audit.
+type AuditConfig struct {
+        Layout        Layout        // empty means DefaultLayout
+        StartTime     time.Time
+        TimeUnit      time.Duration // 0 means 10ms
+        Namespace     string        // only audit log records of this namespace are audited, required with audit logs
+        NoTime        bool          // the ids carry no time or machine id, like those of ticket, segment or random
+                                    // namespaces, only duplicates are checked
+        Now           time.Time     // ids after Now + MaxClockSkew are in the future, zero means time.Now()
+        MaxClockSkew  time.Duration
+        MaxInMemory   int           // ids kept in memory before sorted runs are spilled to TempDir, default 4M
+        TempDir       string
+        MaxViolations int           // violations listed in the report, all are counted, default 1000
+}
+
+// IDSource is a stream of ids issued by one pod: one id per line in Format, or the pod's audit log.
+// With ExpectMachineID every id has to carry MachineID, audit log records always carry their machine id.
+// Only the ids of a dump are checked to increase, records of concurrent requests may reach the audit log in
+// any order.
+type IDSource struct {
+        Name            string
+        Reader          io.Reader
+        Format          string // format of the ids, empty means IDFormatNumber
+        AuditLog        bool
+        ExpectMachineID bool
+        MachineID       uint16
+}
+
+// Violation is an id which breaks a uniqueness guarantee. Line is the line of the source, Detail explains it.
+type Violation struct {
+        Kind   string `json:"kind"`
+        ID     uint64 `json:"id"`
+        Source string `json:"source"`
+        Line   int    `json:"line"`
+        Detail string `json:"detail"`
+}
+
+// AuditReport is the outcome of AuditIDs.
+type AuditReport struct {
+        IDs        uint64         `json:"ids"`
+        Counts     map[string]int `json:"counts"`
+        Violations []Violation    `json:"violations"`
+}
+
+// OK reports whether no violation was found.
+func (r *AuditReport) OK() bool {
+        return len(r.Counts) == 0
+}
+
+// auditEntry is an id with its origin, spilled to disk as 16 bytes.
+type auditEntry struct {
+        id     uint64
+        source uint32
+        line   uint32
+}
+
+type machineKey struct {
+        source    int
+        machineID uint64
+}
+
+type auditor struct {
+        config    AuditConfig
+        sources   []IDSource
+        report    *AuditReport
+        startTick int64
+        timeUnit  int64
+        latest    int64 // last tick which is not in the future
+        last      map[machineKey]uint64
+        buffer    []auditEntry
+        runs      []*os.File
+}
+
+// AuditIDs checks the ids of many pods for duplicates, ids whose machine id does not match their pod,
+// ids of a machine which do not increase within a source and ids from the future.
+// Duplicates are found by sorting: ids are kept in memory up to config.MaxInMemory, beyond that sorted runs
+// are written to temporary files and merged, so memory stays bounded whatever the number of ids.
+func AuditIDs(config AuditConfig, sources []IDSource) (*AuditReport, error) {
+        if config.Layout == (Layout{}) {
+                config.Layout = DefaultLayout
+        }
+        if !config.Layout.valid() {
+                return nil, fmt.Errorf("invalid layout %+v", config.Layout)
+        }
+        if config.TimeUnit == 0 {
+                config.TimeUnit = snowFlakeTimeUnitScaleFactor
+        }
+        if config.Now.IsZero() {
+                config.Now = time.Now()
+        }
+        if config.MaxInMemory <= 0 {
+                config.MaxInMemory = 4 << 20
+        }
+        if config.MaxViolations <= 0 {
+                config.MaxViolations = 1000
+        }
+        for _, source := range sources {
+                // namespaces differ in layout and share no id space, their records cannot be checked together
+                if source.AuditLog && config.Namespace == "" {
+                        return nil, fmt.Errorf("%s: audit logs are audited per namespace, a namespace is required", source.Name)
+                }
+        }
+        a := &auditor{config: config, sources: sources, report: &AuditReport{Counts: map[string]int{}},
+                timeUnit: int64(config.TimeUnit), last: map[machineKey]uint64{}}
+        a.startTick = config.StartTime.UnixNano() / a.timeUnit
+        a.latest = config.Now.Add(config.MaxClockSkew).UnixNano() / a.timeUnit - a.startTick
+        defer a.removeRuns()
+
+        for i, source := range sources {
+                var err error
+                if source.AuditLog {
+                        err = a.readAuditLog(i, source)
+                } else {
+                        err = a.readDump(i, source)
+                }
+                if err != nil {
+                        return nil, fmt.Errorf("%s: %v", source.Name, err)
+                }
+        }
+        if err := a.findDuplicates(); err != nil {
+                return nil, err
+        }
+        return a.report, nil
+}
+
+func (a *auditor) readDump(i int, source IDSource) error {
+        format := source.Format
+        if format == "" {
+                format = IDFormatNumber
+        }
+        scanner := bufio.NewScanner(source.Reader)
+        line := 0
+        for scanner.Scan() {
+                line++
+                s := strings.TrimSpace(scanner.Text())
+                if s == "" || strings.HasPrefix(s, "#") {
+                        continue
+                }
+                id, err := Decode(s, format)
+                if err != nil {
+                        return fmt.Errorf("line %d: %v", line, err)
+                }
+                if err := a.add(i, line, id, true, source.ExpectMachineID, source.MachineID); err != nil {
+                        return err
+                }
+        }
+        return scanner.Err()
+}
+
+func (a *auditor) readAuditLog(i int, source IDSource) error {
+        scanner := bufio.NewScanner(source.Reader)
+        line := 0
+        for scanner.Scan() {
+                line++
+                var record AuditRecord
+                if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+                        return fmt.Errorf("line %d: %v", line, err)
+                }
+                if a.config.Namespace != "" && record.Namespace != a.config.Namespace {
+                        continue
+                }
+                if record.UpperBound < record.LowerBound {
+                        return fmt.Errorf("line %d: upper bound below lower bound", line)
+                }
+                for id := record.LowerBound; ; id++ {
+                        if err := a.add(i, line, id, false, true, record.MachineId); err != nil {
+                                return err
+                        }
+                        if id == record.UpperBound {
+                                break
+                        }
+                }
+        }
+        return scanner.Err()
+}
+
+func (a *auditor) violation(kind string, entry auditEntry, detail string) {
+        a.report.Counts[kind]++
+        if len(a.report.Violations) < a.config.MaxViolations {
+                a.report.Violations = append(a.report.Violations, Violation{Kind: kind, ID: entry.id,
+                        Source: a.sources[entry.source].Name, Line: int(entry.line), Detail: detail})
+        }
+}
+
+// add runs the checks which need no other ids and buffers the id for the duplicate check. With ordered the id
+// has to be above the previous id of its machine in the source.
+func (a *auditor) add(source int, line int, id uint64, ordered bool, expectMachineID bool, machineID uint16) error {
+        entry := auditEntry{id: id, source: uint32(source), line: uint32(line)}
+        a.report.IDs++
+        if !a.config.NoTime {
+                a.check(entry, ordered, expectMachineID, machineID)
+        }
+
+        a.buffer = append(a.buffer, entry)
+        if len(a.buffer) >= a.config.MaxInMemory {
+                return a.spill()
+        }
+        return nil
+}
+
+// check looks at the machine id and the time of a snowflake id.
+func (a *auditor) check(entry auditEntry, ordered bool, expectMachineID bool, machineID uint16) {
+        id := entry.id
+        parts := a.config.Layout.Decompose(id)
+        expected := uint64(machineID & a.config.Layout.maxMachineID())
+        if expectMachineID && parts["machine-id"] != expected {
+                a.violation(ViolationMachineIDMismatch, entry,
+                        fmt.Sprintf("machine id %d, expected %d", parts["machine-id"], expected))
+        }
+        if int64(parts["time"]) > a.latest {
+                a.violation(ViolationFutureTimestamp, entry,
+                        "issued at " + tickTime(a.config.StartTime, a.config.TimeUnit, parts["time"]).Format(time.RFC3339Nano))
+        }
+        if ordered {
+                key := machineKey{int(entry.source), parts["machine-id"]}
+                if last, ok := a.last[key]; ok && id < last {
+                        a.violation(ViolationNonMonotonic, entry, fmt.Sprintf("follows %d", last))
+                }
+                a.last[key] = id
+        }
+}
+
+func (a *auditor) sortBuffer() {
+        sort.Slice(a.buffer, func(i, j int) bool {
+                if a.buffer[i].id != a.buffer[j].id {
+                        return a.buffer[i].id < a.buffer[j].id
+                }
+                if a.buffer[i].source != a.buffer[j].source {
+                        return a.buffer[i].source < a.buffer[j].source
+                }
+                return a.buffer[i].line < a.buffer[j].line
+        })
+}
+
+// spill writes the buffer as a sorted run to a temporary file.
+func (a *auditor) spill() error {
+        a.sortBuffer()
+        f, err := os.CreateTemp(a.config.TempDir, "idaudit-*")
+        if err != nil {
+                return err
+        }
+        a.runs = append(a.runs, f)
+        w := bufio.NewWriter(f)
+        var b [16]byte
+        for _, entry := range a.buffer {
+                binary.BigEndian.PutUint64(b[0:], entry.id)
+                binary.BigEndian.PutUint32(b[8:], entry.source)
+                binary.BigEndian.PutUint32(b[12:], entry.line)
+                if _, err := w.Write(b[:]); err != nil {
+                        return err
+                }
+        }
+        if err := w.Flush(); err != nil {
+                return err
+        }
+        a.buffer = a.buffer[:0]
+        return nil
+}
+
+func (a *auditor) removeRuns() {
+        for _, f := range a.runs {
+                f.Close()
+                os.Remove(f.Name())
+        }
+}
+
+// findDuplicates walks all ids in sorted order, equal ids are next to each other.
+func (a *auditor) findDuplicates() error {
+        var first, previous auditEntry
+        started := false
+        check := func(entry auditEntry) {
+                if started && entry.id == previous.id {
+                        a.violation(ViolationDuplicate, entry,
+                                fmt.Sprintf("also issued at %s line %d", a.sources[first.source].Name, first.line))
+                } else {
+                        first = entry
+                }
+                previous = entry
+                started = true
+        }
+
+        if len(a.runs) == 0 {
+                a.sortBuffer()
+                for _, entry := range a.buffer {
+                        check(entry)
+                }
+                return nil
+        }
+        if len(a.buffer) > 0 {
+                if err := a.spill(); err != nil {
+                        return err
+                }
+        }
+        runs := &runHeap{}
+        for _, f := range a.runs {
+                if _, err := f.Seek(0, io.SeekStart); err != nil {
+                        return err
+                }
+                r := &runReader{r: bufio.NewReader(f)}
+                if err := r.next(); err != nil {
+                        return err
+                }
+                if r.ok {
+                        runs.readers = append(runs.readers, r)
+                }
+        }
+        heap.Init(runs)
+        for runs.Len() > 0 {
+                r := runs.readers[0]
+                check(r.entry)
+                if err := r.next(); err != nil {
+                        return err
+                }
+                if r.ok {
+                        heap.Fix(runs, 0)
+                } else {
+                        heap.Pop(runs)
+                }
+        }
+        return nil
+}
+
+// runReader reads the entries of a spilled run in order.
+type runReader struct {
+        r     *bufio.Reader
+        entry auditEntry
+        ok    bool
+}
+
+func (r *runReader) next() error {
+        var b [16]byte
+        _, err := io.ReadFull(r.r, b[:])
+        if err == io.EOF {
+                r.ok = false
+                return nil
+        }
+        if err != nil {
+                return err
+        }
+        r.entry = auditEntry{id: binary.BigEndian.Uint64(b[0:]), source: binary.BigEndian.Uint32(b[8:]),
+                line: binary.BigEndian.Uint32(b[12:])}
+        r.ok = true
+        return nil
+}
+
+// runHeap merges runs by their current entry.
+type runHeap struct {
+        readers []*runReader
+}
+
+func (h *runHeap) Len() int {
+        return len(h.readers)
+}
+
+func (h *runHeap) Less(i, j int) bool {
+        a, b := h.readers[i].entry, h.readers[j].entry
+        if a.id != b.id {
+                return a.id < b.id
+        }
+        if a.source != b.source {
+                return a.source < b.source
+        }
+        return a.line < b.line
+}
+
+func (h *runHeap) Swap(i, j int) {
+        h.readers[i], h.readers[j] = h.readers[j], h.readers[i]
+}
+
+func (h *runHeap) Push(x interface{}) {
+        h.readers = append(h.readers, x.(*runReader))
+}
+
+func (h *runHeap) Pop() interface{} {
+        r := h.readers[len(h.readers) - 1]
+        h.readers = h.readers[:len(h.readers) - 1]
+        return r
+}
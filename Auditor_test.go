@@ -0,0 +1,137 @@
+package main
+
+import (
+        "bytes"
+        "encoding/json"
+        "fmt"
+        "os"
+        "path/filepath"
+        "strings"
+        "testing"
+        "time"
+        "github.com/stretchr/testify/assert"
+)
+
+var auditStartTime = time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// auditID builds an id of the default layout issued ticks after auditStartTime.
+func auditID(tick uint64, machineID uint64, sequence uint64) uint64 {
+        return tick << 24 | machineID << 8 | sequence
+}
+
+func dump(ids ...uint64) *strings.Reader {
+        var b strings.Builder
+        for _, id := range ids {
+                fmt.Fprintln(&b, id)
+        }
+        return strings.NewReader(b.String())
+}
+
+func TestAuditCleanDumps(t *testing.T) {
+        sfA, sfB := getSnowFlake(), getSnowFlake()
+        sfB.machineID = 322
+        listA, _ := sfA.NextIDs(256)
+        listB, _ := sfB.NextIDs(256)
+        report, err := AuditIDs(AuditConfig{StartTime: time.Now().Add(-time.Second)}, []IDSource{
+                {Name: "pod-a", Reader: dump(listA...), ExpectMachineID: true, MachineID: 321},
+                {Name: "pod-b", Reader: dump(listB...), ExpectMachineID: true, MachineID: 322},
+        })
+        assert.Nil(t, err)
+        assert.True(t, report.OK(), "no violations expected: %v", report.Violations)
+        assert.Equal(t, uint64(512), report.IDs)
+}
+
+func TestAuditDuplicates(t *testing.T) {
+        for _, maxInMemory := range []int{0, 3} {
+                dir := t.TempDir()
+                report, err := AuditIDs(AuditConfig{StartTime: auditStartTime, MaxInMemory: maxInMemory, TempDir: dir},
+                        []IDSource{
+                                {Name: "pod-a", Reader: dump(auditID(1, 1, 0), auditID(1, 1, 1), auditID(2, 1, 0), auditID(3, 1, 0))},
+                                {Name: "pod-b", Reader: dump(auditID(1, 2, 0), auditID(1, 1, 1), auditID(4, 2, 0))},
+                                {Name: "pod-c", Reader: dump(auditID(1, 1, 1))},
+                        })
+                assert.Nil(t, err)
+                assert.Equal(t, map[string]int{ViolationDuplicate: 2}, report.Counts, "max in memory %d", maxInMemory)
+                assert.Equal(t, Violation{Kind: ViolationDuplicate, ID: auditID(1, 1, 1), Source: "pod-b", Line: 2,
+                        Detail: "also issued at pod-a line 2"}, report.Violations[0])
+                assert.Equal(t, "pod-c", report.Violations[1].Source)
+                files, _ := filepath.Glob(filepath.Join(dir, "idaudit-*"))
+                assert.Empty(t, files, "spilled runs should be removed")
+        }
+}
+
+func TestAuditMachineIDAndOrder(t *testing.T) {
+        report, err := AuditIDs(AuditConfig{StartTime: auditStartTime, Now: auditStartTime.Add(time.Minute)}, []IDSource{
+                {Name: "pod-a", Reader: dump(auditID(5, 1, 0), auditID(5, 2, 0), auditID(4, 1, 0), auditID(6001, 1, 0)),
+                        ExpectMachineID: true, MachineID: 1},
+        })
+        assert.Nil(t, err)
+        assert.False(t, report.OK())
+        assert.Equal(t, map[string]int{ViolationMachineIDMismatch: 1, ViolationNonMonotonic: 1, ViolationFutureTimestamp: 1},
+                report.Counts)
+        assert.Equal(t, Violation{Kind: ViolationMachineIDMismatch, ID: auditID(5, 2, 0), Source: "pod-a", Line: 2,
+                Detail: "machine id 2, expected 1"}, report.Violations[0])
+        assert.Equal(t, ViolationNonMonotonic, report.Violations[1].Kind)
+        assert.Equal(t, 3, report.Violations[1].Line)
+        assert.Equal(t, Violation{Kind: ViolationFutureTimestamp, ID: auditID(6001, 1, 0), Source: "pod-a", Line: 4,
+                Detail: "issued at 2016-01-01T00:01:00.01Z"}, report.Violations[2])
+}
+
+func TestAuditLogSource(t *testing.T) {
+        var log bytes.Buffer
+        for _, record := range []AuditRecord{
+                {MachineId: 1, Namespace: "default", LowerBound: auditID(1, 1, 0), UpperBound: auditID(1, 1, 255)},
+                {MachineId: 1, Namespace: "orders", LowerBound: auditID(1, 1, 0), UpperBound: auditID(1, 1, 0)},
+                {MachineId: 3, Namespace: "default", LowerBound: auditID(2, 2, 0), UpperBound: auditID(2, 2, 1)},
+                // a concurrent request of machine 1 whose record was appended late
+                {MachineId: 1, Namespace: "default", LowerBound: auditID(0, 1, 0), UpperBound: auditID(0, 1, 0)},
+        } {
+                line, _ := json.Marshal(record)
+                log.Write(append(line, '\n'))
+        }
+        report, err := AuditIDs(AuditConfig{StartTime: auditStartTime, Namespace: "default"}, []IDSource{
+                {Name: "audit.log", Reader: &log, AuditLog: true},
+                {Name: "dump", Reader: dump(auditID(1, 1, 7))},
+        })
+        assert.Nil(t, err)
+        assert.Equal(t, uint64(260), report.IDs)
+        assert.Equal(t, map[string]int{ViolationDuplicate: 1, ViolationMachineIDMismatch: 2}, report.Counts,
+                "records out of order are no violation")
+}
+
+func TestAuditLogPerNamespace(t *testing.T) {
+        var log bytes.Buffer
+        for _, record := range []AuditRecord{
+                {MachineId: 1, Namespace: "tickets", LowerBound: 1000, UpperBound: 1099},
+                {MachineId: 2, Namespace: "tickets", LowerBound: 1099, UpperBound: 1199},
+                {MachineId: 1, Namespace: "default", LowerBound: 1000, UpperBound: 1000},
+        } {
+                line, _ := json.Marshal(record)
+                log.Write(append(line, '\n'))
+        }
+        _, err := AuditIDs(AuditConfig{StartTime: auditStartTime}, []IDSource{{Name: "audit.log", Reader: strings.NewReader(log.String()), AuditLog: true}})
+        assert.NotNil(t, err, "audit logs of all namespaces share no layout")
+
+        report, err := AuditIDs(AuditConfig{StartTime: auditStartTime, Namespace: "tickets", NoTime: true},
+                []IDSource{{Name: "audit.log", Reader: &log, AuditLog: true}})
+        assert.Nil(t, err, "audit log should be read")
+        assert.Equal(t, uint64(201), report.IDs, "only the ids of the namespace")
+        assert.Equal(t, map[string]int{ViolationDuplicate: 1}, report.Counts, "ticket ids carry no machine id")
+}
+
+func TestAuditCommand(t *testing.T) {
+        dir := t.TempDir()
+        podA := filepath.Join(dir, "pod-a.txt")
+        podB := filepath.Join(dir, "pod-b.txt")
+        os.WriteFile(podA, []byte(fmt.Sprintf("%d\n%d\n", auditID(1, 1, 0), auditID(1, 1, 1))), 0644)
+        os.WriteFile(podB, []byte(fmt.Sprintf("# pod b\n%d\n", auditID(1, 2, 0))), 0644)
+
+        var out bytes.Buffer
+        assert.Nil(t, auditCommand([]string{"1@" + podA, "2@" + podB}, &out), out.String())
+        assert.True(t, strings.Contains(out.String(), `"ids": 3`), out.String())
+
+        out.Reset()
+        err := auditCommand([]string{"-o", "table", "2@" + podA, podB}, &out)
+        assert.NotNil(t, err, "machine ids of pod a do not match")
+        assert.True(t, strings.Contains(out.String(), ViolationMachineIDMismatch), out.String())
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+        "encoding/json"
+        "errors"
+        "fmt"
+        "io/ioutil"
+        "math"
+        "net/http"
+        "os"
+        "sort"
+        "strconv"
+        "strings"
+        "sync"
+        "sync/atomic"
+        "time"
+        "gopkg.in/gin-gonic/gin.v1"
+)
+
+// env variables holding the api keys, either the path of a JSON file with a list of APIKey
+// or a comma separated list of key:client:per_second:per_day:burst entries.
+const (
+        apiKeysFileEnvVarKey = "UNIQUE_ID_API_KEYS_FILE"
+        apiKeysEnvVarKey     = "UNIQUE_ID_API_KEYS"
+)
+
+// APIKey is a client credential and the quota of ids the client may ask for.
+// A zero PerSecond or PerDay means no limit. Burst is the size of the token bucket,
+// it defaults to PerSecond but at least defaultMinBurst. A request for more ids than Burst is never allowed.
+// An empty Key defines the quota of a client which authenticates with a TLS client certificate only.
+type APIKey struct {
+        Key       string  `json:"key"`
+        Client    string  `json:"client"`
+        PerSecond float64 `json:"per_second"`
+        Burst     float64 `json:"burst"`
+        PerDay    uint64  `json:"per_day"`
+}
+
+// clientQuota tracks the token bucket, the daily usage and the counters of a client.
+type clientQuota struct {
+        key       APIKey
+        mutex     sync.Mutex
+        tokens    float64
+        refilled  time.Time
+        day       string
+        usedToday uint64
+        issued    uint64 // atomic
+        rejected  uint64 // atomic
+}
+
+// Authenticator maps api keys and client certificate identities to clients.
+// A nil Authenticator lets every request through.
+type Authenticator struct {
+        clients  map[string]*clientQuota // by key
+        byClient map[string]*clientQuota // by client, for clients with a certificate
+}
+
+// defaultMinBurst is the smallest default Burst, enough for a range of /longids of the default layouts.
+const defaultMinBurst = 256
+
+// authenticator is set at startup when api keys are configured.
+var authenticator *Authenticator
+
+// NewAuthenticator returns an Authenticator for the given keys.
+func NewAuthenticator(keys []APIKey) (*Authenticator, error) {
+        a := &Authenticator{clients: map[string]*clientQuota{}, byClient: map[string]*clientQuota{}}
+        for _, k := range keys {
+                if k.Client == "" {
+                        return nil, errors.New("api keys need a client")
+                }
+                if _, ok := a.clients[k.Key]; ok && k.Key != "" {
+                        return nil, fmt.Errorf("api key of client %q defined twice", k.Client)
+                }
+                if k.Burst <= 0 {
+                        k.Burst = math.Max(k.PerSecond, defaultMinBurst)
+                }
+                q := &clientQuota{key: k, tokens: k.Burst, refilled: time.Now()}
+                if k.Key != "" {
+                        a.clients[k.Key] = q
+                }
+                // a certificate only quota wins over the quota of a key of the same client
+                if _, ok := a.byClient[k.Client]; !ok || k.Key == "" {
+                        a.byClient[k.Client] = q
+                }
+        }
+        return a, nil
+}
+
+// loadAPIKeys reads the keys from UNIQUE_ID_API_KEYS_FILE or UNIQUE_ID_API_KEYS.
+// It returns nil if neither is set, which leaves the service open.
+func loadAPIKeys() ([]APIKey, error) {
+        if path := os.Getenv(apiKeysFileEnvVarKey); path != "" {
+                data, err := ioutil.ReadFile(path)
+                if err != nil {
+                        return nil, err
+                }
+                var keys []APIKey
+                if err := json.Unmarshal(data, &keys); err != nil {
+                        return nil, err
+                }
+                return keys, nil
+        }
+        if env := os.Getenv(apiKeysEnvVarKey); env != "" {
+                return parseAPIKeys(env)
+        }
+        return nil, nil
+}
+
+// parseAPIKeys parses key:client[:per_second[:per_day[:burst]]] entries separated by commas.
+func parseAPIKeys(s string) ([]APIKey, error) {
+        var keys []APIKey
+        for _, entry := range strings.Split(s, ",") {
+                parts := strings.Split(strings.TrimSpace(entry), ":")
+                if len(parts) < 2 || len(parts) > 5 {
+                        return nil, errors.New("api keys have to be key:client[:per_second[:per_day[:burst]]]")
+                }
+                k := APIKey{Key: parts[0], Client: parts[1]}
+                var err error
+                if len(parts) > 2 && parts[2] != "" {
+                        if k.PerSecond, err = strconv.ParseFloat(parts[2], 64); err != nil {
+                                return nil, err
+                        }
+                }
+                if len(parts) > 3 && parts[3] != "" {
+                        if k.PerDay, err = strconv.ParseUint(parts[3], 10, 64); err != nil {
+                                return nil, err
+                        }
+                }
+                if len(parts) > 4 && parts[4] != "" {
+                        if k.Burst, err = strconv.ParseFloat(parts[4], 64); err != nil {
+                                return nil, err
+                        }
+                }
+                keys = append(keys, k)
+        }
+        return keys, nil
+}
+
+// requestKey returns the key of the X-API-Key header or of a bearer token.
+func requestKey(r *http.Request) string {
+        if key := r.Header.Get("X-API-Key"); key != "" {
+                return key
+        }
+        auth := r.Header.Get("Authorization")
+        if len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+                return strings.TrimSpace(auth[7:])
+        }
+        return ""
+}
+
+// paths which stay open for probes and scrapers
+var unauthenticatedPaths = map[string]bool{"/status": true, "/metrics": true, "/info": true}
+
+// authMiddleware rejects requests with a 401 unless they carry a known api key, or a verified client
+// certificate whose identity has a quota. The client is stored in the context.
+// With a nil Authenticator every request passes and only the certificate identity is stored.
+func authMiddleware(a *Authenticator) gin.HandlerFunc {
+        return func(c *gin.Context) {
+                identity := certIdentity(c.Request)
+                if identity != "" {
+                        c.Set(identityContextKey, identity)
+                }
+                if a == nil || unauthenticatedPaths[c.Request.URL.Path] {
+                        c.Next()
+                        return
+                }
+                var q *clientQuota
+                var ok bool
+                if key := requestKey(c.Request); key != "" {
+                        q, ok = a.clients[key]
+                } else if identity != "" {
+                        q, ok = a.byClient[identity]
+                }
+                if !ok {
+                        c.JSON(http.StatusUnauthorized, &ErrorResponse{Result: "Missing or unknown api key", Code: "unauthorized"})
+                        c.Abort()
+                        return
+                }
+                c.Set(clientContextKey, q)
+                c.Set(identityContextKey, q.key.Client)
+                c.Next()
+        }
+}
+
+const (
+        clientContextKey   = "client"
+        identityContextKey = "identity"
+)
+
+// requestIdentity returns the name of the authenticated client of the request, or "".
+func requestIdentity(c *gin.Context) string {
+        if v, ok := c.Get(identityContextKey); ok {
+                return v.(string)
+        }
+        return ""
+}
+
+// chargeQuota takes numIds from the quota of the client of the request and sets the X-RateLimit-* headers.
+// Requests over the quota get a 429 and false is returned, requests larger than the burst or the daily quota of the
+// client a 403 as they would never pass. Without authentication it always returns true.
+func chargeQuota(c *gin.Context, numIds int) bool {
+        v, ok := c.Get(clientContextKey)
+        if !ok {
+                return true
+        }
+        q := v.(*clientQuota)
+        result := q.take(float64(numIds), time.Now())
+        header := c.Writer.Header()
+        if q.key.PerSecond > 0 {
+                header.Set("X-RateLimit-Limit", strconv.FormatFloat(q.key.PerSecond, 'f', -1, 64))
+                header.Set("X-RateLimit-Remaining", strconv.FormatInt(int64(result.remaining), 10))
+                header.Set("X-RateLimit-Reset", strconv.FormatInt(int64(math.Ceil(result.reset.Seconds())), 10))
+        }
+        if q.key.PerDay > 0 {
+                header.Set("X-RateLimit-Limit-Day", strconv.FormatUint(q.key.PerDay, 10))
+                header.Set("X-RateLimit-Remaining-Day", strconv.FormatUint(result.remainingToday, 10))
+        }
+        if result.exceedsBurst {
+                c.JSON(http.StatusForbidden, &ErrorResponse{Result: fmt.Sprintf("Request for %d ids exceeds the burst of %g ids of client %s",
+                        numIds, q.key.Burst, q.key.Client), Code: "quota_burst_exceeded"})
+                return false
+        }
+        if result.exceedsDay {
+                c.JSON(http.StatusForbidden, &ErrorResponse{Result: fmt.Sprintf("Request for %d ids exceeds the daily quota of %d ids of client %s",
+                        numIds, q.key.PerDay, q.key.Client), Code: "quota_day_exceeded"})
+                return false
+        }
+        if !result.allowed {
+                header.Set("Retry-After", strconv.FormatInt(int64(math.Ceil(result.retryAfter.Seconds())), 10))
+                c.JSON(http.StatusTooManyRequests, &ErrorResponse{Result: "Quota of client " + q.key.Client + " exceeded", Code: "quota_exceeded"})
+                return false
+        }
+        return true
+}
+
+type quotaResult struct {
+        allowed        bool
+        remaining      float64       // tokens left in the bucket
+        reset          time.Duration // until the bucket is full again
+        retryAfter     time.Duration
+        remainingToday uint64
+        exceedsBurst   bool // the bucket never holds n tokens
+        exceedsDay     bool // a day never has n ids
+}
+
+// take removes n tokens from the bucket and n ids from the daily quota if both have enough left.
+func (q *clientQuota) take(n float64, now time.Time) quotaResult {
+        q.mutex.Lock()
+        defer q.mutex.Unlock()
+        var result quotaResult
+        day := now.UTC().Format("2006-01-02")
+        if day != q.day {
+                q.day = day
+                q.usedToday = 0
+        }
+        if q.key.PerSecond > 0 {
+                q.tokens = math.Min(q.key.Burst, q.tokens + now.Sub(q.refilled).Seconds() * q.key.PerSecond)
+        }
+        q.refilled = now
+        result.allowed = true
+        if q.key.PerSecond > 0 && n > q.key.Burst {
+                result.allowed = false
+                result.exceedsBurst = true
+        } else if q.key.PerSecond > 0 && q.tokens < n {
+                result.allowed = false
+                result.retryAfter = time.Duration((n - q.tokens) / q.key.PerSecond * float64(time.Second))
+        }
+        if q.key.PerDay > 0 && uint64(n) > q.key.PerDay {
+                result.allowed = false
+                result.exceedsDay = true
+        } else if q.key.PerDay > 0 && q.usedToday + uint64(n) > q.key.PerDay {
+                result.allowed = false
+                midnight := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+                result.retryAfter = midnight.Sub(now)
+        }
+        if result.allowed {
+                if q.key.PerSecond > 0 {
+                        q.tokens -= n
+                }
+                q.usedToday += uint64(n)
+                atomic.AddUint64(&q.issued, uint64(n))
+        } else {
+                atomic.AddUint64(&q.rejected, 1)
+        }
+        if q.key.PerSecond > 0 {
+                result.remaining = q.tokens
+                result.reset = time.Duration((q.key.Burst - q.tokens) / q.key.PerSecond * float64(time.Second))
+        }
+        if q.key.PerDay > q.usedToday {
+                result.remainingToday = q.key.PerDay - q.usedToday
+        }
+        return result
+}
+
+// sortedClients returns the quotas of api keys and certificates ordered by client name, each quota once.
+func (a *Authenticator) sortedClients() []*clientQuota {
+        list := make([]*clientQuota, 0, len(a.clients) + len(a.byClient))
+        seen := map[*clientQuota]bool{}
+        for _, quotas := range []map[string]*clientQuota{a.clients, a.byClient} {
+                for _, q := range quotas {
+                        if !seen[q] {
+                                seen[q] = true
+                                list = append(list, q)
+                        }
+                }
+        }
+        sort.Slice(list, func(i, j int) bool { return list[i].key.Client < list[j].key.Client })
+        return list
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+        "testing"
+        "bytes"
+        "net/http"
+        "net/http/httptest"
+        "strings"
+        "time"
+        "gopkg.in/gin-gonic/gin.v1"
+        "github.com/stretchr/testify/assert"
+)
+
+func getAuthRouter(t *testing.T, keys []APIKey) *gin.Engine {
+        a, err := NewAuthenticator(keys)
+        if err != nil {
+                t.Fatal("authenticator not created: ", err)
+        }
+        authenticator = a
+        t.Cleanup(func() { authenticator = nil })
+        return getTestRouter(t)
+}
+
+func serveWithHeader(router *gin.Engine, url string, header string, value string) *http.Response {
+        req, _ := http.NewRequest("GET", url, nil)
+        req.Header.Set(header, value)
+        w := httptest.NewRecorder()
+        router.ServeHTTP(w, req)
+        return w.Result()
+}
+
+func TestAuthRejectsUnknownKeys(t *testing.T) {
+        router := getAuthRouter(t, []APIKey{{Key: "secret", Client: "billing"}})
+        assert.Equal(t, http.StatusUnauthorized, serve(router, "/longids").Code, "Missing key should be a 401")
+        assert.Equal(t, http.StatusUnauthorized, serveWithHeader(router, "/longids", "X-API-Key", "wrong").StatusCode, "Unknown key should be a 401")
+        assert.Equal(t, http.StatusOK, serveWithHeader(router, "/longids", "X-API-Key", "secret").StatusCode, "Known key should pass")
+        assert.Equal(t, http.StatusOK, serveWithHeader(router, "/longid", "Authorization", "Bearer secret").StatusCode, "Bearer token should pass")
+        assert.Equal(t, http.StatusOK, serve(router, "/status").Code, "Status should stay open")
+}
+
+func TestAuthQuota(t *testing.T) {
+        router := getAuthRouter(t, []APIKey{{Key: "secret", Client: "billing", PerSecond: 1, Burst: 300, PerDay: 1000}})
+        res := serveWithHeader(router, "/longids", "X-API-Key", "secret")
+        assert.Equal(t, http.StatusOK, res.StatusCode, "First request should pass")
+        assert.Equal(t, "1", res.Header.Get("X-RateLimit-Limit"), "Limit header mismatch")
+        assert.Equal(t, "44", res.Header.Get("X-RateLimit-Remaining"), "Remaining header mismatch")
+        assert.Equal(t, "744", res.Header.Get("X-RateLimit-Remaining-Day"), "Daily remaining header mismatch")
+
+        res = serveWithHeader(router, "/longids", "X-API-Key", "secret")
+        assert.Equal(t, http.StatusTooManyRequests, res.StatusCode, "Second request should be over the quota")
+        assert.NotEqual(t, "", res.Header.Get("Retry-After"), "Retry-After should be set")
+        assert.Equal(t, http.StatusOK, serveWithHeader(router, "/ulids?num=10", "X-API-Key", "secret").StatusCode, "Small request should pass")
+
+        body := serve(router, "/metrics").Body.String()
+        assert.Condition(t, func() bool { return strings.Contains(body, `unique_id_client_issued_total{client="billing"} 266`) },
+                "usage of the client should be recorded")
+        assert.Condition(t, func() bool { return strings.Contains(body, `unique_id_client_rejected_total{client="billing"} 1`) },
+                "rejected requests of the client should be recorded")
+}
+
+func TestCertificateClientMetrics(t *testing.T) {
+        a, _ := NewAuthenticator([]APIKey{{Key: "k", Client: "billing"}, {Client: "search", PerSecond: 10}})
+        a.byClient["search"].take(5, time.Now())
+        var buf bytes.Buffer
+        writeClientMetrics(&buf, a)
+        body := buf.String()
+        assert.Condition(t, func() bool { return strings.Contains(body, `unique_id_client_issued_total{client="search"} 5`) },
+                "usage of a certificate only client should be recorded")
+        assert.Condition(t, func() bool { return strings.Contains(body, `unique_id_client_issued_total{client="billing"} 0`) },
+                "clients with a key should be listed once")
+        assert.Equal(t, 1, strings.Count(body, `unique_id_client_issued_total{client="billing"}`), "every client once")
+}
+
+func TestDailyQuota(t *testing.T) {
+        a, _ := NewAuthenticator([]APIKey{{Key: "k", Client: "c", PerDay: 10}})
+        q := a.clients["k"]
+        day := time.Date(2020, 1, 1, 23, 0, 0, 0, time.UTC)
+        assert.Equal(t, true, q.take(10, day).allowed, "Daily quota should allow 10")
+        result := q.take(1, day)
+        assert.Equal(t, false, result.allowed, "Daily quota should be used up")
+        assert.Equal(t, time.Hour, result.retryAfter, "Retry after midnight")
+        assert.Equal(t, true, q.take(1, day.Add(time.Hour)).allowed, "Daily quota should reset at midnight")
+}
+
+func TestBurst(t *testing.T) {
+        a, _ := NewAuthenticator([]APIKey{{Key: "slow", Client: "c", PerSecond: 10}, {Key: "small", Client: "d", PerSecond: 1, Burst: 10}})
+        now := time.Now()
+        assert.Equal(t, true, a.clients["slow"].take(256, now).allowed, "the default burst should hold a range of longids")
+        result := a.clients["small"].take(11, now)
+        assert.Equal(t, false, result.allowed, "more ids than the burst should not pass")
+        assert.Equal(t, true, result.exceedsBurst, "more ids than the burst should never pass")
+
+        router := getAuthRouter(t, []APIKey{{Key: "small", Client: "d", PerSecond: 1, Burst: 10}})
+        res := serveWithHeader(router, "/longids", "X-API-Key", "small")
+        assert.Equal(t, http.StatusForbidden, res.StatusCode, "a range larger than the burst should be forbidden")
+        assert.Equal(t, "", res.Header.Get("Retry-After"), "retrying would not help")
+
+        router = getAuthRouter(t, []APIKey{{Key: "daily", Client: "e", PerDay: 100}})
+        res = serveWithHeader(router, "/longids", "X-API-Key", "daily")
+        assert.Equal(t, http.StatusForbidden, res.StatusCode, "a range larger than the daily quota should be forbidden")
+        assert.Equal(t, "", res.Header.Get("Retry-After"), "retrying tomorrow would not help either")
+        assert.Equal(t, http.StatusOK, serveWithHeader(router, "/ulids?num=100", "X-API-Key", "daily").StatusCode,
+                "the rejected request should not use up the daily quota")
+}
+
+func TestParseAPIKeys(t *testing.T) {
+        keys, err := parseAPIKeys("k1:billing:100:100000, k2:search")
+        assert.Nil(t, err, "keys should parse")
+        assert.Equal(t, 2, len(keys), "Number of keys mismatch")
+        assert.Equal(t, APIKey{Key: "k1", Client: "billing", PerSecond: 100, PerDay: 100000}, keys[0], "Key mismatch")
+        assert.Equal(t, APIKey{Key: "k2", Client: "search"}, keys[1], "Key mismatch")
+        keys, err = parseAPIKeys("k3:batch:10::5000")
+        assert.Nil(t, err, "key with burst should parse")
+        assert.Equal(t, APIKey{Key: "k3", Client: "batch", PerSecond: 10, Burst: 5000}, keys[0], "Burst mismatch")
+        _, err = parseAPIKeys("k1")
+        assert.NotNil(t, err, "key without client should be rejected")
+        _, err = NewAuthenticator([]APIKey{{Key: "k", Client: "a"}, {Key: "k", Client: "b"}})
+        assert.NotNil(t, err, "duplicate keys should be rejected")
+}
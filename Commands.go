@@ -0,0 +1,169 @@
+package main
+
+import (
+        "encoding/json"
+        "flag"
+        "fmt"
+        "io"
+        "os"
+        "strconv"
+        "strings"
+        "time"
+        "github.com/spinaki/distributed-unique-id/internal/cli"
+)
+
+var commands = map[string]cli.Command{
+        "whoissued": {"whoissued [-ns namespace] [-format number] <id> <audit log file>...", whoIssuedCommand},
+        "audit":     {"audit [-format number] [-ns default] [-strategy snowflake] [-audit-log file]... [generator flags] [machine_id@]file|-...", auditCommand},
+}
+
+// runCommand runs the named command and returns the exit code.
+func runCommand(name string, args []string) int {
+        cmd, ok := commands[name]
+        if !ok {
+                fmt.Fprintf(os.Stderr, "unknown command %q, commands:\n", name)
+                for _, c := range commands {
+                        fmt.Fprintln(os.Stderr, "  " + c.Usage)
+                }
+                return 2
+        }
+        if err := cmd.Run(args, os.Stdout); err != nil {
+                fmt.Fprintln(os.Stderr, err)
+                fmt.Fprintln(os.Stderr, "usage: " + cmd.Usage)
+                return 1
+        }
+        return 0
+}
+
+// whoIssuedCommand prints the audit records of the ranges containing an id.
+func whoIssuedCommand(args []string, stdout io.Writer) error {
+        flags := flag.NewFlagSet("whoissued", flag.ContinueOnError)
+        namespace := flags.String("ns", "", "only search this namespace")
+        format := flags.String("format", IDFormatNumber, "format of the id: number, decimal, hex, base32, base58 or base62")
+        if err := flags.Parse(args); err != nil {
+                return err
+        }
+        if flags.NArg() < 2 {
+                return fmt.Errorf("whoissued needs an id and at least one audit log file")
+        }
+        id, err := Decode(flags.Arg(0), *format)
+        if err != nil {
+                return err
+        }
+        encoder := json.NewEncoder(stdout)
+        found := 0
+        for _, path := range flags.Args()[1:] {
+                f, err := os.Open(path)
+                if err != nil {
+                        return err
+                }
+                records, err := FindIssuers(f, id, *namespace)
+                f.Close()
+                if err != nil {
+                        return fmt.Errorf("%s: %v", path, err)
+                }
+                for _, record := range records {
+                        encoder.Encode(record)
+                }
+                found += len(records)
+        }
+        if found == 0 {
+                return fmt.Errorf("id %d not found in the audit log", id)
+        }
+        return nil
+}
+
+// stringsFlag collects the values of a repeated flag.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+        return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+        *f = append(*f, value)
+        return nil
+}
+
+// auditCommand audits id dumps and audit logs of many pods, see AuditIDs. A dump is a file with one id per line,
+// - reads stdin, machine_id@file checks that every id of the file carries that machine id.
+func auditCommand(args []string, stdout io.Writer) error {
+        flags := flag.NewFlagSet("audit", flag.ContinueOnError)
+        format := flags.String("format", IDFormatNumber, "format of the ids in the dumps")
+        namespace := flags.String("ns", defaultNamespaceName, "namespace of the audit log records to audit, whose layout the generator flags describe")
+        strategy := flags.String("strategy", StrategySnowFlake, "strategy of the namespace, only duplicates are checked for ids without time")
+        maxSkew := flags.Duration("max-clock-skew", time.Second, "ids up to this far in the future are accepted")
+        maxInMemory := flags.Int("max-in-memory", 4 << 20, "ids kept in memory before sorted runs are spilled to disk")
+        output := flags.String("o", "json", "output: json or table")
+        var auditLogs stringsFlag
+        flags.Var(&auditLogs, "audit-log", "audit log file, may be repeated")
+        generator := cli.AddGeneratorFlags(flags)
+        if err := flags.Parse(args); err != nil {
+                return err
+        }
+        if flags.NArg() == 0 && len(auditLogs) == 0 {
+                return fmt.Errorf("audit needs at least one dump or audit log")
+        }
+        switch *strategy {
+        case StrategySnowFlake, StrategyTicket, StrategySegment, StrategyRandom:
+        default:
+                return fmt.Errorf("unknown strategy %q", *strategy)
+        }
+        layout, err := generator.Layout()
+        if err != nil {
+                return err
+        }
+        startTime, err := generator.StartTime()
+        if err != nil {
+                return err
+        }
+
+        var sources []IDSource
+        for _, arg := range flags.Args() {
+                source := IDSource{Name: arg, Format: *format}
+                path := arg
+                if i := strings.Index(arg, "@"); i > 0 {
+                        machineID, err := strconv.ParseUint(arg[:i], 10, 16)
+                        if err != nil {
+                                return fmt.Errorf("invalid machine id in %q", arg)
+                        }
+                        source.ExpectMachineID, source.MachineID, path = true, uint16(machineID), arg[i + 1:]
+                }
+                sources = append(sources, source)
+                if path == "-" {
+                        sources[len(sources) - 1].Reader = os.Stdin
+                        continue
+                }
+                f, err := os.Open(path)
+                if err != nil {
+                        return err
+                }
+                defer f.Close()
+                sources[len(sources) - 1].Reader = f
+        }
+        for _, path := range auditLogs {
+                f, err := os.Open(path)
+                if err != nil {
+                        return err
+                }
+                defer f.Close()
+                sources = append(sources, IDSource{Name: path, Reader: f, AuditLog: true})
+        }
+
+        report, err := AuditIDs(AuditConfig{Layout: Layout(layout), StartTime: startTime, TimeUnit: *generator.TimeUnit,
+                Namespace: *namespace, NoTime: *strategy != StrategySnowFlake, MaxClockSkew: *maxSkew, MaxInMemory: *maxInMemory}, sources)
+        if err != nil {
+                return err
+        }
+        rows := [][]string{{"KIND", "ID", "SOURCE", "LINE", "DETAIL"}}
+        for _, v := range report.Violations {
+                rows = append(rows, []string{v.Kind, strconv.FormatUint(v.ID, 10), v.Source, strconv.Itoa(v.Line), v.Detail})
+        }
+        if err := cli.PrintOutput(stdout, *output, report, rows); err != nil {
+                return err
+        }
+        if !report.OK() {
+                return fmt.Errorf("%d ids audited, violations: %v", report.IDs, report.Counts)
+        }
+        return nil
+}
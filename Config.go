@@ -0,0 +1,186 @@
+package main
+
+import (
+        "encoding/json"
+        "errors"
+        "fmt"
+        "io/ioutil"
+        "os"
+        "time"
+)
+
+// configEnvVarKey names the env variable holding the path of the JSON service config.
+const configEnvVarKey = "UNIQUE_ID_CONFIG"
+
+// ServiceConfig is the optional JSON config of the ID service. Example:
+//
+//     {
+//       "limits": {"max_num": 1000, "max_len": 256, "max_size": 256},
+//       "namespaces": [
+//         {"name": "orders", "start_time": "2020-01-01T00:00:00Z", "time_unit": "1ms",
+//          "layout": {"bit_len_time": 41, "bit_len_machine_id": 12, "bit_len_sequence": 10}}
+//       ]
+//     }
+//
+// CORSAllowedOrigins restricts the origins browsers may call the service from, all origins are allowed if empty.
+// TLS turns on https, see TLSConfig. AuditLog records every id range handed out, see AuditLogConfig.
+// Log configures the format, level and sampling of the logs, see LogConfig. Tracing configures the
+// OpenTelemetry exporter, see TracingConfig. PublicIDs holds the keys of /publicids, see PublicIDConfig.
+// Exhaustion configures the warnings about the end of the epoch, see ExhaustionConfig.
+type ServiceConfig struct {
+        Limits             Limits            `json:"limits"`
+        Namespaces         []NamespaceConfig `json:"namespaces"`
+        CORSAllowedOrigins []string          `json:"cors_allowed_origins"`
+        TLS                *TLSConfig        `json:"tls"`
+        AuditLog           *AuditLogConfig   `json:"audit_log"`
+        Log                *LogConfig        `json:"log"`
+        Tracing            *TracingConfig    `json:"tracing"`
+        PublicIDs          *PublicIDConfig   `json:"public_ids"`
+        Exhaustion         *ExhaustionConfig `json:"exhaustion"`
+}
+
+// NamespaceConfig defines a named generator with its own epoch and layout.
+// A namespace called "default" replaces the generator behind /longids and /longidrange.
+// LockFree picks the compare-and-swap based AtomicSnowFlake, which scales better under concurrent requests.
+// Types maps the resource types of /typedids to the prefix of their ids, e.g. {"order": "ord"}.
+// Strategy picks the IDGenerator of the namespace: snowflake, ticket, segment or random. Empty means ticket if
+// Ticket is set and snowflake otherwise. Ticket configures the ticket strategy, see TicketConfig, and Segment
+// the segment strategy, see SegmentConfig.
+// SequencePolicy decides what a snowflake namespace does once the sequence of a tick is used up, see
+// SequencePolicy. Lock free namespaces cannot borrow ticks.
+// RandomSequenceStart and SequenceMultiplier make the low bits of the ids less predictable, see Settings. Lock
+// free namespaces cannot scramble their sequence.
+type NamespaceConfig struct {
+        Name                string                `json:"name"`
+        StartTime           time.Time             `json:"start_time"`
+        TimeUnit            string                `json:"time_unit"` // parsed by time.ParseDuration, empty means 10ms
+        Layout              Layout                `json:"layout"`    // empty means DefaultLayout
+        LockFree            bool                  `json:"lock_free"`
+        Types               map[string]string     `json:"types"`
+        Strategy            string                `json:"strategy"`
+        Ticket              *TicketConfig         `json:"ticket"`
+        Segment             *SegmentConfig        `json:"segment"`
+        SequencePolicy      *SequencePolicyConfig `json:"sequence_policy"`
+        RandomSequenceStart bool                  `json:"random_sequence_start"`
+        SequenceMultiplier  uint16                `json:"sequence_multiplier"`
+}
+
+// loadServiceConfig reads the config file named by UNIQUE_ID_CONFIG.
+// If the env variable is not set an empty config is returned.
+func loadServiceConfig() (*ServiceConfig, error) {
+        path := os.Getenv(configEnvVarKey)
+        if path == "" {
+                return &ServiceConfig{}, nil
+        }
+        data, err := ioutil.ReadFile(path)
+        if err != nil {
+                return nil, err
+        }
+        return parseServiceConfig(data)
+}
+
+func parseServiceConfig(data []byte) (*ServiceConfig, error) {
+        config := &ServiceConfig{}
+        if err := json.Unmarshal(data, config); err != nil {
+                return nil, err
+        }
+        seen := map[string]bool{}
+        for _, nc := range config.Namespaces {
+                if !validNamespaceName(nc.Name) {
+                        return nil, fmt.Errorf("invalid namespace name %q", nc.Name)
+                }
+                if seen[nc.Name] {
+                        return nil, fmt.Errorf("namespace %q defined twice", nc.Name)
+                }
+                seen[nc.Name] = true
+                if _, err := nc.strategy(); err != nil {
+                        return nil, fmt.Errorf("namespace %q: %v", nc.Name, err)
+                }
+                prefixes := map[string]string{}
+                for typ, prefix := range nc.Types {
+                        if !validNamespaceName(typ) || !ValidTypedIDPrefix(prefix) {
+                                return nil, fmt.Errorf("namespace %q: invalid type %q with prefix %q", nc.Name, typ, prefix)
+                        }
+                        if other, ok := prefixes[prefix]; ok {
+                                return nil, fmt.Errorf("namespace %q: types %q and %q share the prefix %q", nc.Name, typ, other, prefix)
+                        }
+                        prefixes[prefix] = typ
+                }
+        }
+        return config, nil
+}
+
+// settings converts the namespace config to the Settings of its SnowFlake.
+func (nc NamespaceConfig) settings() (Settings, error) {
+        st := Settings{StartTime: nc.StartTime, Layout: nc.Layout, RandomSequenceStart: nc.RandomSequenceStart,
+                SequenceMultiplier: nc.SequenceMultiplier}
+        if nc.SequenceMultiplier % 2 == 0 && nc.SequenceMultiplier != 0 {
+                return st, errors.New("sequence multiplier has to be odd")
+        }
+        if nc.LockFree && nc.SequenceMultiplier != 0 {
+                return st, errors.New("lock free namespaces cannot scramble the sequence")
+        }
+        if nc.TimeUnit != "" {
+                unit, err := time.ParseDuration(nc.TimeUnit)
+                if err != nil {
+                        return st, err
+                }
+                if unit <= 0 {
+                        return st, errors.New("time unit has to be positive")
+                }
+                st.TimeUnit = unit
+        }
+        if nc.SequencePolicy != nil {
+                policy, err := nc.SequencePolicy.policy()
+                if err != nil {
+                        return st, err
+                }
+                if nc.LockFree && policy.MaxBorrow > 0 {
+                        return st, errors.New("lock free namespaces cannot borrow ticks")
+                }
+                st.SequencePolicy = policy
+        }
+        return st, nil
+}
+
+// strategy returns the strategy of the namespace, checking that its config is present.
+func (nc NamespaceConfig) strategy() (string, error) {
+        strategy := nc.Strategy
+        if strategy == "" {
+                strategy = StrategySnowFlake
+                if nc.Ticket != nil {
+                        strategy = StrategyTicket
+                }
+        }
+        switch strategy {
+        case StrategySnowFlake, StrategyRandom:
+        case StrategyTicket:
+                if nc.Ticket == nil {
+                        return "", errors.New("ticket strategy needs a ticket config")
+                }
+        case StrategySegment:
+                if nc.Segment == nil {
+                        return "", errors.New("segment strategy needs a segment config")
+                }
+        default:
+                return "", fmt.Errorf("unknown strategy %q", strategy)
+        }
+        if nc.Ticket != nil && strategy != StrategyTicket || nc.Segment != nil && strategy != StrategySegment ||
+                nc.SequencePolicy != nil && strategy != StrategySnowFlake {
+                return "", fmt.Errorf("config of another strategy than %s", strategy)
+        }
+        return strategy, nil
+}
+
+// namespace names end up in urls and metric labels, so keep them simple
+func validNamespaceName(name string) bool {
+        if name == "" || len(name) > 64 {
+                return false
+        }
+        for _, r := range name {
+                if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+                        return false
+                }
+        }
+        return true
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+        "github.com/spinaki/distributed-unique-id/client"
+)
+
+// String formats of 64 bit ids. JSON numbers above 2^53 lose precision in javascript, so clients
+// can ask for one of the string formats instead.
+// Apart from decimal every format has a fixed width and an alphabet in ascii order, so the strings
+// sort in the same order as the ids. The formats live in the client package, so that clients and
+// cmd/idctl parse them like the service.
+const (
+        IDFormatNumber  = client.FormatNumber  // JSON number, the default
+        IDFormatDecimal = client.FormatDecimal // decimal string without leading zeros, does not sort like the ids
+        IDFormatHex     = client.FormatHex     // 16 lower case hex digits
+        IDFormatBase32  = client.FormatBase32  // 13 Crockford base32 digits
+        IDFormatBase58  = client.FormatBase58  // 11 base58 (bitcoin alphabet) digits
+        IDFormatBase62  = client.FormatBase62  // 11 base62 digits
+)
+
+// ValidIDFormat reports whether format is one of the IDFormat constants.
+func ValidIDFormat(format string) bool {
+        return client.ValidFormat(format)
+}
+
+// Encode returns the id in the given string format. For IDFormatNumber the decimal form is returned.
+func Encode(id uint64, format string) (string, error) {
+        return client.Encode(id, format)
+}
+
+// Decode parses a string produced by Encode. Leading zero digits may be left out.
+func Decode(s string, format string) (uint64, error) {
+        return client.Decode(s, format)
+}
+
+// EncodeIDs returns the ids in the given string format.
+func EncodeIDs(ids []uint64, format string) ([]string, error) {
+        return client.EncodeIDs(ids, format)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+        "testing"
+        "sort"
+        "github.com/stretchr/testify/assert"
+)
+
+var testFormats = []string{IDFormatDecimal, IDFormatHex, IDFormatBase32, IDFormatBase58, IDFormatBase62}
+
+func TestEncodeRoundTrip(t *testing.T) {
+        sf := getSnowFlake()
+        ids, err := sf.NextIDs(256)
+        if err != nil {
+                t.Fatal("id list not generated")
+        }
+        ids = append(ids, 0, 1, 1 << 53 + 1, ^uint64(0))
+        for _, format := range testFormats {
+                for _, id := range ids {
+                        s, err := Encode(id, format)
+                        assert.Nil(t, err, "Encode failed")
+                        decoded, err := Decode(s, format)
+                        assert.Nil(t, err, "Decode failed")
+                        assert.Equal(t, id, decoded, "Round trip mismatch for " + format)
+                }
+        }
+}
+
+func TestEncodeKeepsOrder(t *testing.T) {
+        ids := []uint64{0, 1, 57, 58, 61, 62, 255, 256, 1 << 40, 1 << 53 + 1, 1 << 63, ^uint64(0)}
+        for _, format := range testFormats[1:] {
+                list, err := EncodeIDs(ids, format)
+                assert.Nil(t, err, "Encode failed")
+                assert.Equal(t, true, sort.StringsAreSorted(list), "Encoded ids should be sorted for " + format)
+                for _, s := range list {
+                        assert.Equal(t, len(list[0]), len(s), "Encoded ids should have a fixed width for " + format)
+                }
+        }
+}
+
+func TestEncodeKnownValues(t *testing.T) {
+        s, _ := Encode(^uint64(0), IDFormatHex)
+        assert.Equal(t, "ffffffffffffffff", s, "Hex mismatch")
+        s, _ = Encode(^uint64(0), IDFormatBase32)
+        assert.Equal(t, "FZZZZZZZZZZZZ", s, "Base32 mismatch")
+        s, _ = Encode(^uint64(0), IDFormatBase62)
+        assert.Equal(t, "LygHa16AHYF", s, "Base62 mismatch")
+        s, _ = Encode(9007199254740993, IDFormatDecimal)
+        assert.Equal(t, "9007199254740993", s, "Decimal mismatch")
+
+        id, err := Decode("FF", IDFormatHex)
+        assert.Nil(t, err, "Upper case hex should decode")
+        assert.Equal(t, uint64(255), id, "Hex decode mismatch")
+        id, err = Decode("1o", IDFormatBase32)
+        assert.Nil(t, err, "Crockford aliases should decode")
+        assert.Equal(t, uint64(32), id, "Base32 decode mismatch")
+}
+
+func TestDecodeErrors(t *testing.T) {
+        _, err := Decode("LygHa16AHYG", IDFormatBase62)
+        assert.NotNil(t, err, "Overflow should be rejected")
+        _, err = Decode("0l", IDFormatBase58)
+        assert.NotNil(t, err, "l is not a base58 char")
+        _, err = Decode("", IDFormatHex)
+        assert.NotNil(t, err, "Empty id should be rejected")
+        _, err = Encode(1, "base64")
+        assert.NotNil(t, err, "Unknown format should be rejected")
+        assert.Equal(t, false, ValidIDFormat("base64"), "base64 is not a format")
+        assert.Equal(t, true, ValidIDFormat(IDFormatNumber), "number is a format")
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+        "fmt"
+        "log/slog"
+        "sort"
+        "strconv"
+        "strings"
+        "time"
+)
+
+// ExhaustionConfig configures the checks of the epoch of the snowflake namespaces, whose ids run out once the
+// elapsed ticks no longer fit the time bits, see Descriptor.OverflowTime.
+//
+// WarnWithin lists the horizons at which a warning is logged, default ["5y", "1y"]. The service refuses to start
+// if a namespace overflows within RefuseWithin, the safety window, default 0, i.e. only once it has overflowed.
+// Horizons are parsed by time.ParseDuration or given in days ("30d") or years of 365 days ("5y").
+type ExhaustionConfig struct {
+        WarnWithin   []string `json:"warn_within"`
+        RefuseWithin string   `json:"refuse_within"`
+}
+
+var defaultWarnWithin = []string{"5y", "1y"}
+
+// exhaustionCheckInterval is how often a running service checks the horizons again.
+const exhaustionCheckInterval = 24 * time.Hour
+
+// exhaustionWatcher warns about namespaces approaching the end of their epoch. Every horizon is logged once per
+// namespace.
+type exhaustionWatcher struct {
+        warnWithin   []time.Duration // longest first
+        refuseWithin time.Duration
+        warned       map[string]time.Duration // shortest horizon logged by namespace
+        logger       *slog.Logger
+}
+
+func newExhaustionWatcher(config ExhaustionConfig, logger *slog.Logger) (*exhaustionWatcher, error) {
+        w := &exhaustionWatcher{warned: map[string]time.Duration{}, logger: logger}
+        warnWithin := config.WarnWithin
+        if warnWithin == nil {
+                warnWithin = defaultWarnWithin
+        }
+        for _, s := range warnWithin {
+                horizon, err := parseHorizon(s)
+                if err != nil {
+                        return nil, err
+                }
+                w.warnWithin = append(w.warnWithin, horizon)
+        }
+        sort.Slice(w.warnWithin, func(i, j int) bool { return w.warnWithin[i] > w.warnWithin[j] })
+        if config.RefuseWithin != "" {
+                var err error
+                if w.refuseWithin, err = parseHorizon(config.RefuseWithin); err != nil {
+                        return nil, err
+                }
+        }
+        return w, nil
+}
+
+// parseHorizon parses a duration which may also be given in days or years.
+func parseHorizon(s string) (time.Duration, error) {
+        units := map[string]time.Duration{"d": 24 * time.Hour, "y": 365 * 24 * time.Hour}
+        for suffix, unit := range units {
+                if n, ok := strings.CutSuffix(s, suffix); ok {
+                        v, err := strconv.ParseFloat(n, 64)
+                        if err != nil || v < 0 {
+                                return 0, fmt.Errorf("invalid horizon %q", s)
+                        }
+                        return time.Duration(v * float64(unit)), nil
+                }
+        }
+        d, err := time.ParseDuration(s)
+        if err != nil || d < 0 {
+                return 0, fmt.Errorf("invalid horizon %q", s)
+        }
+        return d, nil
+}
+
+// check logs a warning for every namespace which has crossed a horizon since the last check. It returns an error
+// if a namespace overflows within the safety window.
+func (w *exhaustionWatcher) check(list []*Namespace, now time.Time) error {
+        for _, ns := range list {
+                d := ns.generator.Describe().SnowFlake
+                if d == nil {
+                        continue
+                }
+                overflow := d.OverflowTime()
+                remaining := overflow.Sub(now)
+                if remaining <= w.refuseWithin {
+                        return fmt.Errorf("ids of namespace %q overflow at %s, within the safety window of %s",
+                                ns.Name, overflow.Format(time.RFC3339), w.refuseWithin)
+                }
+                var crossed time.Duration
+                for _, horizon := range w.warnWithin {
+                        if remaining <= horizon {
+                                crossed = horizon
+                        }
+                }
+                if crossed > 0 && (w.warned[ns.Name] == 0 || crossed < w.warned[ns.Name]) {
+                        w.warned[ns.Name] = crossed
+                        w.logger.Warn("epoch exhaustion approaching", "namespace", ns.Name, "overflow_time", overflow,
+                                "remaining", remaining.Round(time.Hour).String(), "horizon", crossed.String())
+                }
+        }
+        return nil
+}
+
+// watch checks the namespaces at every interval. The service keeps running within the safety window, but logs
+// an error.
+func (w *exhaustionWatcher) watch(interval time.Duration) {
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+        for now := range ticker.C {
+                if err := w.check(sortedNamespaces(), now); err != nil {
+                        w.logger.Error("epoch exhaustion imminent", "error", err)
+                }
+        }
+}
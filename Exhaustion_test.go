@@ -0,0 +1,112 @@
+package main
+
+import (
+        "bytes"
+        "encoding/json"
+        "fmt"
+        "net/http"
+        "strings"
+        "testing"
+        "time"
+        "github.com/stretchr/testify/assert"
+)
+
+func TestOverflowTime(t *testing.T) {
+        d := &Descriptor{Layout: DefaultLayout, StartTime: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC), TimeUnit: 10 * time.Millisecond}
+        assert.Equal(t, time.Date(2190, 3, 18, 3, 28, 58, 880000000, time.UTC), d.OverflowTime())
+        // the last tick still fits the time bits
+        assert.Equal(t, d.OverflowTime(), d.Time(uint64(1 << 39 - 1) << 24).Add(10 * time.Millisecond))
+
+        d = &Descriptor{Layout: Layout{BitLenTime: 41, BitLenMachineID: 12, BitLenSequence: 10},
+                StartTime: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), TimeUnit: time.Millisecond}
+        assert.Equal(t, 2089, d.OverflowTime().Year())
+        d.TimeUnit = time.Second
+        assert.Equal(t, 71704, d.OverflowTime().Year(), "beyond the years time.Duration can count")
+}
+
+func TestParseHorizon(t *testing.T) {
+        for s, want := range map[string]time.Duration{"5y": 5 * 365 * 24 * time.Hour, "30d": 30 * 24 * time.Hour,
+                "0.5y": 4380 * time.Hour, "36h": 36 * time.Hour} {
+                horizon, err := parseHorizon(s)
+                assert.Nil(t, err)
+                assert.Equal(t, want, horizon, s)
+        }
+        for _, s := range []string{"", "y", "-1d", "soon"} {
+                _, err := parseHorizon(s)
+                assert.NotNil(t, err, s)
+        }
+}
+
+// nearlyExhausted returns a namespace whose ids run out about 3 years from now.
+func nearlyExhausted(t *testing.T) *Namespace {
+        layout := Layout{BitLenTime: 31, BitLenMachineID: 16, BitLenSequence: 16}
+        lifetime := time.Duration(1 << 31) * time.Second
+        ns, err := NewNamespace("nearly-exhausted", Settings{StartTime: time.Now().Add(3 * 365 * 24 * time.Hour - lifetime),
+                TimeUnit: time.Second, Layout: layout, MachineID: mockMachineId}, false)
+        if err != nil {
+                t.Fatal(err)
+        }
+        return ns
+}
+
+func TestExhaustionWarnings(t *testing.T) {
+        var buf bytes.Buffer
+        l, _ := newLogger(LogConfig{}, &buf)
+        w, err := newExhaustionWatcher(ExhaustionConfig{RefuseWithin: "180d"}, l)
+        assert.Nil(t, err)
+        ns := nearlyExhausted(t)
+        list := []*Namespace{ns}
+        now := time.Now()
+
+        assert.Nil(t, w.check(list, now))
+        assert.Nil(t, w.check(list, now.Add(24 * time.Hour)))
+        assert.Equal(t, 1, strings.Count(buf.String(), "\n"), "the 5y horizon is logged once")
+        line := map[string]interface{}{}
+        json.Unmarshal(buf.Bytes(), &line)
+        assert.Equal(t, "epoch exhaustion approaching", line["msg"])
+        assert.Equal(t, "43800h0m0s", line["horizon"])
+        assert.Equal(t, "nearly-exhausted", line["namespace"])
+
+        buf.Reset()
+        assert.Nil(t, w.check(list, now.Add(2 * 365 * 24 * time.Hour + 48 * time.Hour)))
+        assert.Contains(t, buf.String(), `"horizon":"8760h0m0s"`)
+        assert.NotNil(t, w.check(list, now.Add(2 * 365 * 24 * time.Hour + 200 * 24 * time.Hour)), "within the safety window")
+
+        w, _ = newExhaustionWatcher(ExhaustionConfig{}, l)
+        assert.Nil(t, w.check(list, now.Add(2 * 365 * 24 * time.Hour)))
+        assert.NotNil(t, w.check(list, now.Add(4 * 365 * 24 * time.Hour)), "an overflowed epoch is always refused")
+
+        w, _ = newExhaustionWatcher(ExhaustionConfig{WarnWithin: []string{}}, l)
+        buf.Reset()
+        assert.Nil(t, w.check(list, now))
+        assert.Equal(t, "", buf.String(), "no horizons, no warnings")
+
+        _, err = newExhaustionWatcher(ExhaustionConfig{WarnWithin: []string{"soon"}}, l)
+        assert.NotNil(t, err)
+}
+
+func TestInfoEpoch(t *testing.T) {
+        router := getTestRouter(t)
+        w := serve(router, "/info")
+        assert.Equal(t, http.StatusOK, w.Code)
+        info := &ServiceInfo{}
+        assert.Nil(t, json.Unmarshal(w.Body.Bytes(), info))
+        var orders *NamespaceInfo
+        for i := range info.Namespaces {
+                if info.Namespaces[i].Name == "orders" {
+                        orders = &info.Namespaces[i]
+                }
+        }
+        if orders == nil {
+                t.Fatal("orders namespace missing")
+        }
+        assert.Equal(t, StrategySnowFlake, orders.Strategy)
+        ns, _ := lookupNamespace("orders")
+        overflow := ns.generator.Describe().SnowFlake.OverflowTime()
+        assert.Equal(t, overflow, *orders.OverflowTime)
+        assert.InDelta(t, orders.OverflowTime.Unix() - time.Now().Unix(), orders.RemainingSeconds, 5)
+
+        body := serve(router, "/metrics").Body.String()
+        assert.Contains(t, body, fmt.Sprintf(`unique_id_epoch_overflow_timestamp_seconds{namespace="orders"} %d`, overflow.Unix()))
+        assert.Contains(t, body, `unique_id_epoch_remaining_seconds{namespace="default"}`)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+        "context"
+        "errors"
+        "fmt"
+        "math"
+        "math/bits"
+        "time"
+)
+
+// Strategies of IDGenerator, selected per namespace with the strategy field of NamespaceConfig.
+const (
+        StrategySnowFlake = "snowflake" // time, machine id and sequence, see SnowFlake
+        StrategyTicket    = "ticket"    // blocks reserved from a Redis counter, see TicketGenerator
+        StrategySegment   = "segment"   // prefetched blocks of a Redis or file counter, see SegmentGenerator
+        StrategyRandom    = "random"    // random 63-bit ids, see RandomGenerator
+)
+
+// IDGenerator is a strategy for unique 64-bit ids.
+//
+// NextIDs returns n ids in increasing order. NextIDRange returns the bounds of n consecutive ids, n is at most
+// the RangeSize of the Description. Ids of later calls are larger than ids of earlier calls, except for
+// RandomGenerator, whose ids have no order.
+type IDGenerator interface {
+        NextID() (uint64, error)
+        NextIDs(n int) ([]uint64, error)
+        NextIDRange(n int) (uint64, uint64, error)
+        Describe() Description
+}
+
+// ContextIDGenerator is implemented by generators which trace their waits as children of a context.
+type ContextIDGenerator interface {
+        IDGenerator
+        NextIDContext(ctx context.Context) (uint64, error)
+        NextIDsContext(ctx context.Context, n int) ([]uint64, error)
+        NextIDRangeContext(ctx context.Context, n int) (uint64, uint64, error)
+}
+
+// Description describes the ids of a generator. RangeSize is the size of the lists and ranges handed out by
+// the id endpoints, a tick of a SnowFlake. MachineIDSource tells where the machine id came from, one of the
+// MachineIDFrom constants. SnowFlake is set for the strategies whose ids carry a time.
+type Description struct {
+        Strategy        string
+        RangeSize       int
+        MachineID       uint16
+        MachineIDSource string
+        SnowFlake       *Descriptor
+}
+
+// Descriptor is the layout, epoch and time unit needed to take SnowFlake ids apart. MaxBorrow is the number of
+// ticks ahead of the clock the generator may issue ids of, see SequencePolicy.
+type Descriptor struct {
+        Layout    Layout
+        StartTime time.Time
+        TimeUnit  time.Duration
+        MaxBorrow int
+}
+
+// Decompose returns the parts of an id.
+func (d *Descriptor) Decompose(id uint64) map[string]uint64 {
+        return d.Layout.Decompose(id)
+}
+
+// Time returns the start of the tick an id was issued in.
+func (d *Descriptor) Time(id uint64) time.Time {
+        return tickTime(d.StartTime, d.TimeUnit, d.Layout.Decompose(id)["time"])
+}
+
+// OverflowTime returns the start of the first tick which does not fit the time bits, from then on no id can be
+// issued. It is StartTime plus 2^BitLenTime ticks, March 2190 for the default layout and an epoch of 2016-01-01.
+func (d *Descriptor) OverflowTime() time.Time {
+        hi, lo := bits.Mul64(uint64(1) << d.Layout.BitLenTime, uint64(d.TimeUnit))
+        var secs, nsec uint64
+        if hi < uint64(time.Second) {
+                secs, nsec = bits.Div64(hi, lo, uint64(time.Second))
+        }
+        if hi >= uint64(time.Second) || secs > math.MaxInt64 / 2 {
+                // further than time.Time can count, i.e. never
+                return time.Unix(math.MaxInt64 / 2, 0).UTC()
+        }
+        return time.Unix(d.StartTime.Unix() + int64(secs), int64(d.StartTime.Nanosecond()) + int64(nsec)).UTC()
+}
+
+// MinIDForTime returns the lowest id any machine can issue at t or later: the first id of the tick of t, with
+// machine id and sequence 0. Ticks are counted like SnowFlake does, from StartTime rounded down to the time unit.
+// Times before the epoch give 0, times after the last tick an error.
+func (d *Descriptor) MinIDForTime(t time.Time) (uint64, error) {
+        if t.Before(d.epoch()) {
+                return 0, nil
+        }
+        tick, ok := d.tickOf(t)
+        if !ok {
+                return 0, fmt.Errorf("%s is after the ids overflow", t.Format(time.RFC3339))
+        }
+        return tick << (d.Layout.BitLenMachineID + d.Layout.BitLenSequence), nil
+}
+
+// MaxIDForTime returns the highest id any machine can issue at t or earlier: the last id of the tick MaxBorrow
+// ticks after the tick of t, with all machine id and sequence bits set. Times before the epoch give an error,
+// times after the last tick the largest id.
+func (d *Descriptor) MaxIDForTime(t time.Time) (uint64, error) {
+        if t.Before(d.epoch()) {
+                return 0, fmt.Errorf("%s is before the epoch", t.Format(time.RFC3339))
+        }
+        tick, ok := d.tickOf(t)
+        if !ok || tick + uint64(d.MaxBorrow) >= 1 << d.Layout.BitLenTime {
+                return 1 << 63 - 1, nil
+        }
+        return (tick + uint64(d.MaxBorrow) + 1) << (d.Layout.BitLenMachineID + d.Layout.BitLenSequence) - 1, nil
+}
+
+// epoch is the start of tick 0, StartTime rounded down to the time unit.
+func (d *Descriptor) epoch() time.Time {
+        return tickTime(d.StartTime, d.TimeUnit, 0)
+}
+
+// tickOf returns the tick t falls in, t must not be before the epoch. It returns false if the tick does not fit
+// the time bits. The elapsed nanoseconds are counted in 128 bits, time.Duration ends after 292 years.
+func (d *Descriptor) tickOf(t time.Time) (uint64, bool) {
+        if !t.Before(d.OverflowTime()) {
+                return 0, false
+        }
+        epoch := d.epoch()
+        secs, nsec := t.Unix() - epoch.Unix(), int64(t.Nanosecond() - epoch.Nanosecond())
+        if nsec < 0 {
+                secs, nsec = secs - 1, nsec + int64(time.Second)
+        }
+        hi, lo := bits.Mul64(uint64(secs), uint64(time.Second))
+        lo, carry := bits.Add64(lo, uint64(nsec), 0)
+        tick, _ := bits.Div64(hi + carry, lo, uint64(d.TimeUnit))
+        return tick, tick < 1 << d.Layout.BitLenTime
+}
+
+// checkCount returns an error if n ids cannot be handed out at once, max 0 means no limit.
+func checkCount(n int, max int) error {
+        if n < 1 {
+                return errors.New("number of ids has to be positive")
+        }
+        if max > 0 && n > max {
+                return fmt.Errorf("number of ids has to be at most %d", max)
+        }
+        return nil
+}
+
+// collectRanges returns n ids taken from ranges of at most RangeSize ids.
+func collectRanges(ctx context.Context, g ContextIDGenerator, n int) ([]uint64, error) {
+        if err := checkCount(n, 0); err != nil {
+                return nil, err
+        }
+        rangeSize := g.Describe().RangeSize
+        idList := make([]uint64, 0, n)
+        for len(idList) < n {
+                chunk := n - len(idList)
+                if chunk > rangeSize {
+                        chunk = rangeSize
+                }
+                lower, upper, err := g.NextIDRangeContext(ctx, chunk)
+                if err != nil {
+                        return nil, err
+                }
+                for id := lower; id <= upper; id++ {
+                        idList = append(idList, id)
+                }
+        }
+        return idList, nil
+}
+
+// tracedNextID, tracedNextIDs and tracedNextIDRange trace the waits of generators which support it.
+func tracedNextID(ctx context.Context, g IDGenerator) (uint64, error) {
+        if cg, ok := g.(ContextIDGenerator); ok {
+                return cg.NextIDContext(ctx)
+        }
+        return g.NextID()
+}
+
+func tracedNextIDs(ctx context.Context, g IDGenerator, n int) ([]uint64, error) {
+        if cg, ok := g.(ContextIDGenerator); ok {
+                return cg.NextIDsContext(ctx, n)
+        }
+        return g.NextIDs(n)
+}
+
+func tracedNextIDRange(ctx context.Context, g IDGenerator, n int) (uint64, uint64, error) {
+        if cg, ok := g.(ContextIDGenerator); ok {
+                return cg.NextIDRangeContext(ctx, n)
+        }
+        return g.NextIDRange(n)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+        "encoding/json"
+        "net/http"
+        "os"
+        "path/filepath"
+        "sync"
+        "testing"
+        "time"
+        "github.com/stretchr/testify/assert"
+)
+
+var (
+        _ ContextIDGenerator = (*SnowFlake)(nil)
+        _ ContextIDGenerator = (*AtomicSnowFlake)(nil)
+        _ ContextIDGenerator = (*TicketGenerator)(nil)
+        _ ContextIDGenerator = (*SegmentGenerator)(nil)
+        _ IDGenerator        = (*RandomGenerator)(nil)
+)
+
+func TestSnowFlakeGenerators(t *testing.T) {
+        st := Settings{StartTime: time.Now().Add(-time.Hour), MachineID: mockMachineId}
+        for _, g := range []IDGenerator{NewSnowFlake(st), NewAtomicSnowFlake(st)} {
+                d := g.Describe()
+                assert.Equal(t, StrategySnowFlake, d.Strategy)
+                assert.Equal(t, 256, d.RangeSize)
+                assert.Equal(t, uint16(321), d.MachineID)
+                assert.Equal(t, DefaultLayout, d.SnowFlake.Layout)
+                assert.Equal(t, 10 * time.Millisecond, d.SnowFlake.TimeUnit)
+
+                lower, upper, err := g.NextIDRange(10)
+                assert.Nil(t, err)
+                assert.Equal(t, uint64(9), upper - lower)
+                assert.WithinDuration(t, time.Now(), d.SnowFlake.Time(lower), time.Second)
+                lower2, upper2, err := g.NextIDRange(256)
+                assert.Nil(t, err)
+                assert.Equal(t, uint64(0), d.SnowFlake.Decompose(lower2)["sequence"], "a whole tick starts a new tick")
+                assert.True(t, lower2 > upper)
+
+                ids, err := g.NextIDs(600)
+                assert.Nil(t, err)
+                assert.Equal(t, 600, len(ids))
+                for i, id := range ids {
+                        if i == 0 {
+                                assert.True(t, id > upper2)
+                        } else if id <= ids[i - 1] {
+                                t.Fatalf("ids not increasing at %d", i)
+                        }
+                }
+
+                _, _, err = g.NextIDRange(257)
+                assert.NotNil(t, err, "a range is at most a tick")
+                _, err = g.NextIDs(0)
+                assert.NotNil(t, err)
+        }
+}
+
+func TestSegmentFileCounter(t *testing.T) {
+        file := filepath.Join(t.TempDir(), "counter")
+        g, err := NewSegmentGenerator(SegmentConfig{TicketConfig{RangeSize: 16, BlockSize: 64}, file}, nil)
+        assert.Nil(t, err)
+        assert.Equal(t, Description{Strategy: StrategySegment, RangeSize: 16}, g.Describe())
+
+        lower, upper, err := g.NextIDRange(16)
+        assert.Nil(t, err)
+        assert.Equal(t, []uint64{1, 16}, []uint64{lower, upper})
+        lower, upper, _ = g.NextIDRange(16)
+        assert.Equal(t, []uint64{17, 32}, []uint64{lower, upper})
+        // the first half is used, the next segment is fetched in the background
+        <-waitPrefetch(g)
+        data, _ := os.ReadFile(file)
+        assert.Equal(t, "128\n", string(data))
+
+        ids, err := g.NextIDs(40)
+        assert.Nil(t, err)
+        assert.Equal(t, uint64(33), ids[0])
+        assert.Equal(t, uint64(64), ids[31])
+        assert.Equal(t, uint64(65), ids[32], "the prefetched segment follows")
+
+        // a restart skips the rest of the segments
+        g, _ = NewSegmentGenerator(SegmentConfig{TicketConfig{RangeSize: 16, BlockSize: 64}, file}, nil)
+        id, err := g.NextID()
+        assert.Nil(t, err)
+        assert.True(t, id > 128)
+
+        os.WriteFile(file, []byte("garbage"), 0644)
+        g, _ = NewSegmentGenerator(SegmentConfig{TicketConfig{}, file}, nil)
+        _, err = g.NextID()
+        assert.NotNil(t, err)
+}
+
+// waitPrefetch returns a channel closed once the prefetch of g has finished, without taking its result.
+func waitPrefetch(g *SegmentGenerator) <-chan struct{} {
+        g.mutex.Lock()
+        prefetch := g.prefetch
+        g.mutex.Unlock()
+        done := make(chan struct{})
+        go func() {
+                result := <-prefetch
+                prefetch <- result
+                close(done)
+        }()
+        return done
+}
+
+func TestSegmentRedis(t *testing.T) {
+        redis := newFakeRedis(t)
+        g, err := NewSegmentGenerator(SegmentConfig{TicketConfig: TicketConfig{Addr: redis.addr(), Key: "segments",
+                RangeSize: 16, BlockSize: 256}}, nil)
+        assert.Nil(t, err)
+
+        var wg sync.WaitGroup
+        var mutex sync.Mutex
+        seen := map[uint64]bool{}
+        for i := 0; i < 8; i++ {
+                wg.Add(1)
+                go func() {
+                        defer wg.Done()
+                        for j := 0; j < 50; j++ {
+                                lower, upper, err := g.NextIDRange(16)
+                                if err != nil {
+                                        t.Error(err)
+                                        return
+                                }
+                                mutex.Lock()
+                                for id := lower; id <= upper; id++ {
+                                        if seen[id] {
+                                                t.Errorf("duplicated id %d", id)
+                                        }
+                                        seen[id] = true
+                                }
+                                mutex.Unlock()
+                        }
+                }()
+        }
+        wg.Wait()
+        assert.Equal(t, 8 * 50 * 16, len(seen))
+        assert.True(t, redis.numCommands("INCRBY segments 256") >= 25)
+
+        _, err = NewSegmentGenerator(SegmentConfig{}, nil)
+        assert.NotNil(t, err, "a segment needs a counter")
+}
+
+func TestRandomGenerator(t *testing.T) {
+        g := NewRandomGenerator(0)
+        assert.Equal(t, Description{Strategy: StrategyRandom, RangeSize: 256}, g.Describe())
+        ids, err := g.NextIDs(1000)
+        assert.Nil(t, err)
+        seen := map[uint64]bool{}
+        for _, id := range ids {
+                assert.True(t, id < 1 << 63)
+                seen[id] = true
+        }
+        assert.Equal(t, 1000, len(seen))
+        lower, upper, err := g.NextIDRange(256)
+        assert.Nil(t, err)
+        assert.Equal(t, uint64(255), upper - lower)
+        assert.True(t, upper < 1 << 63)
+        _, _, err = g.NextIDRange(257)
+        assert.NotNil(t, err)
+}
+
+func TestNamespaceStrategies(t *testing.T) {
+        file := filepath.Join(t.TempDir(), "counter")
+        config, err := parseServiceConfig([]byte(`{"namespaces": [
+                {"name": "random-ids", "strategy": "random"},
+                {"name": "segments", "strategy": "segment", "segment": {"file": "` + file + `", "range_size": 64}}]}`))
+        assert.Nil(t, err)
+        err = setupNamespaces(&Settings{StartTime: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC), MachineID: mockMachineId}, config)
+        assert.Nil(t, err)
+        router := newRouter(config)
+
+        idRange := &IDRange{}
+        w := serve(router, "/ns/segments/longidrange")
+        assert.Equal(t, http.StatusOK, w.Code)
+        json.Unmarshal(w.Body.Bytes(), idRange)
+        assert.Equal(t, IDRange{LowerBound: 1, UpperBound: 64}, *idRange)
+
+        idList := &IDList{}
+        w = serve(router, "/ns/random-ids/longids")
+        assert.Equal(t, http.StatusOK, w.Code)
+        json.Unmarshal(w.Body.Bytes(), idList)
+        assert.Equal(t, 256, len(idList.List))
+
+        for _, body := range []string{
+                `{"namespaces": [{"name": "a", "strategy": "uuid"}]}`,
+                `{"namespaces": [{"name": "a", "strategy": "ticket"}]}`,
+                `{"namespaces": [{"name": "a", "strategy": "segment"}]}`,
+                `{"namespaces": [{"name": "a", "strategy": "random", "ticket": {"addr": "redis:6379"}}]}`,
+        } {
+                _, err := parseServiceConfig([]byte(body))
+                assert.NotNil(t, err, body)
+        }
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+        "net/http"
+        "time"
+        "gopkg.in/gin-gonic/gin.v1"
+)
+
+// IDBounds is the response of /idbounds. Every id issued from From to To, by any machine, lies within the inclusive
+// bounds, so a range scan over them finds all rows of the time window.
+type IDBounds struct {
+        From       time.Time `json:"from"`
+        To         time.Time `json:"to"`
+        LowerBound uint64    `json:"lower_bound"`
+        UpperBound uint64    `json:"upper_bound"`
+}
+
+// EncodedIDBounds is IDBounds with the bounds in one of the string formats.
+type EncodedIDBounds struct {
+        From       time.Time `json:"from"`
+        To         time.Time `json:"to"`
+        LowerBound string    `json:"lower_bound"`
+        UpperBound string    `json:"upper_bound"`
+        Format     string    `json:"format"`
+}
+
+// Encode returns the bounds in the given string format.
+func (b *IDBounds) Encode(format string) (*EncodedIDBounds, error) {
+        lower, err := Encode(b.LowerBound, format)
+        if err != nil {
+                return nil, err
+        }
+        upper, err := Encode(b.UpperBound, format)
+        if err != nil {
+                return nil, err
+        }
+        return &EncodedIDBounds{From: b.From, To: b.To, LowerBound: lower, UpperBound: upper, Format: format}, nil
+}
+
+// timeQuery parses the query param name as an RFC 3339 time or a date, which means midnight UTC. If the param is
+// missing def is used. Invalid values get a 400 and false is returned.
+func timeQuery(c *gin.Context, name string, def time.Time) (time.Time, bool) {
+        s := c.Query(name)
+        if s == "" {
+                return def, true
+        }
+        t, err := time.Parse(time.RFC3339Nano, s)
+        if err != nil {
+                if t, err = time.Parse(time.DateOnly, s); err != nil {
+                        badRequest(c, errorCodeInvalidParam, name, name + " has to be an RFC 3339 time or a date like 2024-03-01")
+                        return time.Time{}, false
+                }
+        }
+        return t, true
+}
+
+func idBoundsHandler(c *gin.Context) {
+        format, ok := requestIDFormat(c)
+        if !ok {
+                return
+        }
+        if c.Query("from") == "" {
+                badRequest(c, errorCodeInvalidParam, "from", "from is required")
+                return
+        }
+        from, ok := timeQuery(c, "from", time.Time{})
+        if !ok {
+                return
+        }
+        to, ok := timeQuery(c, "to", time.Now())
+        if !ok {
+                return
+        }
+        if to.Before(from) {
+                badRequest(c, errorCodeParamOutOfRange, "to", "to has to be at or after from")
+                return
+        }
+        ns := requestNamespace(c)
+        if ns == nil {
+                return
+        }
+        d := ns.generator.Describe().SnowFlake
+        if d == nil {
+                badRequest(c, errorCodeInvalidParam, "name", "ids of namespace " + ns.Name + " carry no time")
+                return
+        }
+        lower, err := d.MinIDForTime(from)
+        if err != nil {
+                badRequest(c, errorCodeParamOutOfRange, "from", err.Error())
+                return
+        }
+        upper, err := d.MaxIDForTime(to)
+        if err != nil {
+                badRequest(c, errorCodeParamOutOfRange, "to", err.Error())
+                return
+        }
+        bounds := &IDBounds{From: from.UTC(), To: to.UTC(), LowerBound: lower, UpperBound: upper}
+        if format == IDFormatNumber {
+                writeJSON(c, http.StatusOK, bounds)
+                return
+        }
+        encoded, err := bounds.Encode(format)
+        if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"result": "Failed to encode id bounds"})
+                return
+        }
+        writeJSON(c, http.StatusOK, encoded)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+        "encoding/json"
+        "net/http"
+        "path/filepath"
+        "testing"
+        "time"
+        "github.com/stretchr/testify/assert"
+)
+
+func TestIDForTime(t *testing.T) {
+        d := &Descriptor{Layout: DefaultLayout, StartTime: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC), TimeUnit: 10 * time.Millisecond}
+        at := time.Date(2024, 3, 15, 7, 30, 12, 345000000, time.UTC)
+        tick := int64(at.Sub(d.StartTime) / d.TimeUnit)
+        lower, err := d.MinIDForTime(at)
+        assert.Nil(t, err)
+        upper, err := d.MaxIDForTime(at)
+        assert.Nil(t, err)
+        first, _ := d.Layout.toID(tick, 0, 0)
+        last, _ := d.Layout.toID(tick, 0xffff, 255)
+        assert.Equal(t, first, lower)
+        assert.Equal(t, last, upper, "the bounds cover all machine ids")
+        assert.Equal(t, at.Add(-5 * time.Millisecond), d.Time(lower), "the tick of the time")
+
+        // ids of a SnowFlake lie within the bounds of the time they were issued
+        sf := NewSnowFlake(Settings{StartTime: d.StartTime, MachineID: mockMachineId})
+        before := time.Now()
+        id := nextID(t, sf)
+        after := time.Now()
+        lower, _ = d.MinIDForTime(before)
+        upper, _ = d.MaxIDForTime(after)
+        assert.True(t, lower <= id && id <= upper)
+
+        // borrowed ids are issued ahead of their tick
+        borrowing := *d
+        borrowing.MaxBorrow = 3
+        upper, _ = borrowing.MaxIDForTime(at)
+        last, _ = d.Layout.toID(tick + 3, 0xffff, 255)
+        assert.Equal(t, last, upper, "the upper bound covers the borrowed ticks")
+        borrower := NewSnowFlake(Settings{StartTime: d.StartTime, MachineID: mockMachineId,
+                SequencePolicy: SequencePolicy{Mode: SequenceBorrow, MaxBorrow: 3, StateFile: filepath.Join(t.TempDir(), "borrowed")}})
+        assert.Equal(t, 3, borrower.Describe().SnowFlake.MaxBorrow)
+
+        // the start time is rounded down to the time unit like SnowFlake does
+        d = &Descriptor{Layout: Layout{BitLenTime: 41, BitLenMachineID: 12, BitLenSequence: 10},
+                StartTime: time.Date(2020, 1, 1, 0, 0, 0, 500000, time.UTC), TimeUnit: time.Millisecond}
+        lower, _ = d.MinIDForTime(time.Date(2020, 1, 1, 0, 0, 0, 1500000, time.UTC))
+        assert.Equal(t, uint64(1) << 22, lower)
+        lower, err = d.MinIDForTime(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+        assert.Nil(t, err)
+        assert.Equal(t, uint64(0), lower, "times before the epoch")
+        _, err = d.MaxIDForTime(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+        assert.NotNil(t, err)
+        _, err = d.MinIDForTime(time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC))
+        assert.NotNil(t, err, "after the ids overflow in 2089")
+        upper, err = d.MaxIDForTime(time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC))
+        assert.Nil(t, err)
+        assert.Equal(t, uint64(1 << 63 - 1), upper)
+
+        // ticks further than time.Duration counts
+        d = &Descriptor{Layout: Layout{BitLenTime: 45, BitLenMachineID: 16, BitLenSequence: 2},
+                StartTime: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), TimeUnit: time.Hour}
+        far := time.Date(2520, 1, 1, 0, 30, 0, 0, time.UTC)
+        lower, _ = d.MinIDForTime(far)
+        assert.Equal(t, uint64(far.Unix() - d.StartTime.Unix()) / 3600, lower >> 18)
+}
+
+func TestIDBoundsEndpoint(t *testing.T) {
+        router := getTestRouter(t)
+        registerNamespace(NewGeneratorNamespace("bounds-random", NewRandomGenerator(0)))
+        ns, _ := lookupNamespace("orders")
+        d := ns.generator.Describe().SnowFlake
+        from, to := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 31, 23, 59, 59, 999000000, time.UTC)
+        lower, _ := d.MinIDForTime(from)
+        upper, _ := d.MaxIDForTime(to)
+
+        w := serve(router, "/ns/orders/idbounds?from=2024-03-01&to=2024-03-31T23:59:59.999Z")
+        assert.Equal(t, http.StatusOK, w.Code)
+        bounds := &IDBounds{}
+        json.Unmarshal(w.Body.Bytes(), bounds)
+        assert.Equal(t, IDBounds{From: from, To: to, LowerBound: lower, UpperBound: upper}, *bounds)
+
+        w = serve(router, "/ns/orders/idbounds?from=2024-03-01T00:00:00Z&to=2024-03-31T23:59:59.999Z&format=hex")
+        assert.Equal(t, http.StatusOK, w.Code)
+        encoded := &EncodedIDBounds{}
+        json.Unmarshal(w.Body.Bytes(), encoded)
+        assert.Equal(t, "hex", encoded.Format)
+        assert.Equal(t, lower, mustDecode(t, encoded.LowerBound, IDFormatHex))
+        assert.Equal(t, upper, mustDecode(t, encoded.UpperBound, IDFormatHex))
+
+        w = serve(router, "/idbounds?from=2024-03-01")
+        assert.Equal(t, http.StatusOK, w.Code, "to defaults to now")
+
+        for _, path := range []string{"/idbounds", "/idbounds?from=yesterday", "/idbounds?from=2024-03-02&to=2024-03-01",
+                "/idbounds?from=2000-01-01&to=2001-01-01", "/ns/bounds-random/idbounds?from=2024-03-01"} {
+                assert.Equal(t, http.StatusBadRequest, serve(router, path).Code, path)
+        }
+}
+
+func mustDecode(t *testing.T, s string, format string) uint64 {
+        id, err := Decode(s, format)
+        if err != nil {
+                t.Fatal(err)
+        }
+        return id
+}
@@ -3,7 +3,7 @@ package main
 import (
         "time"
         "crypto/rand"
-        "encoding/base64"
+        "github.com/spinaki/distributed-unique-id/stringid"
 )
 
 type IDRange struct {
@@ -17,8 +17,36 @@ type IDList struct {
         MachineId uint16 `json:"machine_id"`
 }
 
+// SingleID is a single 64 bit id and the machine that generated it.
+type SingleID struct {
+        ID uint64 `json:"id"`
+        MachineId uint16 `json:"machine_id"`
+}
+
+// EncodedIDRange, EncodedIDList and EncodedID carry the ids as strings in one of the IDFormat formats.
+type EncodedIDRange struct {
+        LowerBound string `json:"lower_bound"`
+        UpperBound string `json:"upper_bound"`
+        MachineId uint16 `json:"machine_id"`
+        Format string `json:"format"`
+}
+
+type EncodedIDList struct {
+        List []string `json:"id_list"`
+        MachineId uint16 `json:"machine_id"`
+        Format string `json:"format"`
+}
+
+type EncodedID struct {
+        ID string `json:"id"`
+        MachineId uint16 `json:"machine_id"`
+        Format string `json:"format"`
+}
+
 type StringIDList struct {
         List []string `json:"id_list"`
+        // probability that any two of the requested volume of ids collide, only set if a volume was requested
+        CollisionProbability *float64 `json:"collision_probability,omitempty"`
 }
 
 const KeyLengthInBytes = 32
@@ -37,36 +65,69 @@ func initSnowFlake(st *Settings ) *SnowFlake {
 
 }
 
-func GenerateIDRange(settings *Settings ) (*IDRange, error) {
-        snowFlake := initSnowFlake(settings)
-        lower, upper, err := snowFlake.NextIDRange()
+// GenerateIDRange returns the bounds of a range of the generator, a tick of a SnowFlake.
+func GenerateIDRange(g IDGenerator) (*IDRange, error) {
+        d := g.Describe()
+        lower, upper, err := g.NextIDRange(d.RangeSize)
         if err != nil {
                 return nil, err
         }
-        idRange := &IDRange{LowerBound:lower, UpperBound:upper, MachineId:snowFlake.machineID}
+        idRange := &IDRange{LowerBound:lower, UpperBound:upper, MachineId:d.MachineID}
         return idRange, nil
 }
 
-
-func GenerateIDList(settings *Settings) (*IDList, error) {
-        snowFlake := initSnowFlake(settings)
-        ids, err := snowFlake.NextIDs()
+// GenerateIDList returns the ids of a range of the generator.
+func GenerateIDList(g IDGenerator) (*IDList, error) {
+        d := g.Describe()
+        ids, err := g.NextIDs(d.RangeSize)
         if err != nil {
                 return nil, err
         }
-        idList := &IDList{List:ids, MachineId:snowFlake.machineID}
+        idList := &IDList{List:ids, MachineId:d.MachineID}
         return idList, nil
 }
 
-// returns a set of random string ids
-func GenerateRandomStringId(keyLength int, numIds int) []string {
-        ids := make([]string, 0, numIds)
-        i := 0
-        for; i < numIds; {
-                ids = append(ids, generateRandomString(keyLength))
-                i++
+// Encode returns the range with both bounds in the given string format.
+func (r *IDRange) Encode(format string) (*EncodedIDRange, error) {
+        lower, err := Encode(r.LowerBound, format)
+        if err != nil {
+                return nil, err
         }
-        return ids
+        upper, err := Encode(r.UpperBound, format)
+        if err != nil {
+                return nil, err
+        }
+        return &EncodedIDRange{LowerBound:lower, UpperBound:upper, MachineId:r.MachineId, Format:format}, nil
+}
+
+// Encode returns the list with every id in the given string format.
+func (l *IDList) Encode(format string) (*EncodedIDList, error) {
+        ids, err := EncodeIDs(l.List, format)
+        if err != nil {
+                return nil, err
+        }
+        return &EncodedIDList{List:ids, MachineId:l.MachineId, Format:format}, nil
+}
+
+// Encode returns the id in the given string format.
+func (id *SingleID) Encode(format string) (*EncodedID, error) {
+        s, err := Encode(id.ID, format)
+        if err != nil {
+                return nil, err
+        }
+        return &EncodedID{ID:s, MachineId:id.MachineId, Format:format}, nil
+}
+
+// returns a set of random string ids
+// It will return an error if the system's secure random
+// number generator fails or keyLength is not positive.
+func GenerateRandomStringId(keyLength int, numIds int) ([]string, error) {
+        return stringid.Base64(keyLength, numIds, true)
+}
+
+// GenerateUnpaddedRandomStringId is GenerateRandomStringId without the trailing "=" padding.
+func GenerateUnpaddedRandomStringId(keyLength int, numIds int) ([]string, error) {
+        return stringid.Base64(keyLength, numIds, false)
 }
 
 // source https://elithrar.github.io/article/generating-secure-random-numbers-crypto-rand/
@@ -85,17 +146,3 @@ func generateRandomBytes(n int) ([]byte, error) {
 
         return b, nil
 }
-
-// GenerateRandomString returns a URL-safe, base64 encoded
-// securely generated random string.
-// It will return an error if the system's secure random
-// number generator fails to function correctly, in which
-// case the caller should not continue.
-func generateRandomString(s int) string {
-        b, err := generateRandomBytes(s)
-        if (err != nil) {
-                panic ("error while generating random bytes")
-        }
-        return base64.URLEncoding.EncodeToString(b)
-}
-
@@ -10,7 +10,7 @@ import (
 )
 
 func TestIDRange(t *testing.T) {
-        idRange, err := GenerateIDRange(nil)
+        idRange, err := GenerateIDRange(initSnowFlake(nil))
         s, err := json.Marshal(idRange)
         fmt.Println(string(s))
         if (err != nil) {
@@ -24,7 +24,7 @@ func TestIDRange(t *testing.T) {
                 "UpperBound should be greater than previous upperbound")
         assert.Equal(t, uint64(255), (idRange.UpperBound - idRange.LowerBound), "Upper and Lower Bound Difference Mismatch")
 
-        idRange, err = GenerateIDRange(&Settings{StartTime:time.Now()})
+        idRange, err = GenerateIDRange(initSnowFlake(&Settings{StartTime:time.Now()}))
         s, err = json.Marshal(idRange)
         if (err != nil) {
                 t.Fatal("id range cannot be marshalled")
@@ -35,7 +35,7 @@ func TestIDRange(t *testing.T) {
 }
 
 func TestIDList(t *testing.T) {
-        idList, err := GenerateIDList(nil)
+        idList, err := GenerateIDList(initSnowFlake(nil))
         if (err != nil) {
                 t.Fatal("idList not generated")
         }
@@ -68,7 +68,10 @@ func TestIDList(t *testing.T) {
 }
 
 func TestStringId(t *testing.T) {
-        ids := GenerateRandomStringId(32, 2)
+        ids, err := GenerateRandomStringId(32, 2)
+        if (err != nil) {
+                t.Fatal("string ids not generated")
+        }
         assert.Equal(t, 44, len(ids[0]), "ID length should be 44")
         assert.Condition(t, func() bool {return strings.HasSuffix(ids[0], "=")}, "ID  should end with =")
         strIdList := &StringIDList{List:ids}
@@ -79,11 +82,36 @@ func TestStringId(t *testing.T) {
         fmt.Println(string(s))
 }
 
+func TestUnpaddedStringId(t *testing.T) {
+        ids, err := GenerateUnpaddedRandomStringId(32, 2)
+        if (err != nil) {
+                t.Fatal("string ids not generated")
+        }
+        assert.Equal(t, 43, len(ids[0]), "ID length should be 43")
+        assert.Condition(t, func() bool {return !strings.HasSuffix(ids[0], "=")}, "ID should not end with =")
+}
+
+func TestInvalidStringId(t *testing.T) {
+        _, err := GenerateRandomStringId(-1, 2)
+        assert.NotNil(t, err, "Negative length should be an error")
+        _, err = GenerateRandomStringId(0, 2)
+        assert.NotNil(t, err, "Zero length should be an error")
+        _, err = GenerateRandomStringId(32, -2)
+        assert.NotNil(t, err, "Negative number of ids should be an error")
+}
+
 func TestSingleID(t *testing.T) {
-        idRange, err := GenerateIDRange(nil)
+        idRange, err := GenerateIDRange(initSnowFlake(nil))
         s, err := json.Marshal(idRange)
         if err != nil {
                 fmt.Println(err)
         }
         fmt.Println(string(s))
-}
\ No newline at end of file
+}
+func BenchmarkGenerateRandomStringId(b *testing.B) {
+        for i := 0; i < b.N; i++ {
+                if _, err := GenerateRandomStringId(16, 10); err != nil {
+                        b.Fatal(err)
+                }
+        }
+}
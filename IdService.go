@@ -3,36 +3,166 @@ package main
 import (
         "gopkg.in/gin-gonic/gin.v1"
         "gopkg.in/gin-contrib/cors.v1"
+        "context"
+        "errors"
+        "math"
         "net/http"
+        "os"
+        "os/signal"
+        "syscall"
+        "github.com/spinaki/distributed-unique-id/stringid"
         "time"
         "strconv"
 )
 
 var idGeneratorSettings *Settings
 func main() {
+        if len(os.Args) > 1 {
+                os.Exit(runCommand(os.Args[1], os.Args[2:]))
+        }
         // build snowflake using the IdGenerator API
         idGeneratorSettings = &Settings{}
         idGeneratorSettings.StartTime = time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
 
+        config, err := loadServiceConfig()
+        if err != nil {
+                fatal("failed to load config", err)
+        }
+        logConfig := LogConfig{}
+        if config.Log != nil {
+                logConfig = *config.Log
+        }
+        if logger, err = newLogger(logConfig, os.Stdout); err != nil {
+                fatal("failed to create logger", err)
+        }
+        idGeneratorSettings.Logger = logger
+        tracingConfig := TracingConfig{}
+        if config.Tracing != nil {
+                tracingConfig = *config.Tracing
+        }
+        shutdownTracing, err := setupTracing(tracingConfig)
+        if err != nil {
+                fatal("failed to setup tracing", err)
+        }
+        stopTracing := func() {
+                if err := shutdownTracing(context.Background()); err != nil {
+                        logger.Error("failed to flush spans", "error", err)
+                }
+        }
+        beforeExit = stopTracing
+        if err := setupNamespaces(idGeneratorSettings, config); err != nil {
+                fatal("failed to setup namespaces", err)
+        }
+        exhaustionConfig := ExhaustionConfig{}
+        if config.Exhaustion != nil {
+                exhaustionConfig = *config.Exhaustion
+        }
+        exhaustion, err := newExhaustionWatcher(exhaustionConfig, logger)
+        if err != nil {
+                fatal("invalid exhaustion config", err)
+        }
+        if err := exhaustion.check(sortedNamespaces(), time.Now()); err != nil {
+                fatal("epoch exhausted", err)
+        }
+        go exhaustion.watch(exhaustionCheckInterval)
+        serviceLimits = config.Limits.withDefaults()
+        if ns, ok := lookupNamespace(defaultNamespaceName); ok {
+                logger = logger.With("machine_id", ns.machineID())
+        }
+        keys, err := loadAPIKeys()
+        if err != nil {
+                fatal("failed to load api keys", err)
+        }
+        if keys != nil {
+                if authenticator, err = NewAuthenticator(keys); err != nil {
+                        fatal("failed to load api keys", err)
+                }
+        }
+
+        if config.AuditLog != nil {
+                if auditLog, err = OpenAuditLog(*config.AuditLog); err != nil {
+                        fatal("failed to open audit log", err)
+                }
+        }
+
+        if config.PublicIDs != nil {
+                if publicIDs, err = config.PublicIDs.obfuscator(); err != nil {
+                        fatal("failed to load public id keys", err)
+                }
+                publicIDRevealClients = config.PublicIDs.revealClients()
+        }
+
         // build
         gin.SetMode(gin.ReleaseMode)
-        router := gin.Default()
+        router := newRouter(config)
+        // have a status endpoint too
+        server, err := newServer(":8080", router, config.TLS)
+        if err != nil {
+                fatal("failed to load certificates", err)
+        }
+        stop := make(chan os.Signal, 1)
+        signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+        logger.Info("listening", "addr", ":8080", "tls", config.TLS != nil)
+        if err := serveUntil(server, stop); err != nil {
+                fatal("server stopped", err)
+        }
+        stopTracing()
+        if auditLog != nil {
+                auditLog.Close()
+        }
+        logger.Info("stopped")
+}
+
+func newRouter(config *ServiceConfig) *gin.Engine {
+        router := gin.New()
+        router.Use(gin.Recovery())
+        sampleEvery := uint64(1)
+        if config.Log != nil {
+                sampleEvery = config.Log.SampleEvery
+        }
+        router.Use(tracingMiddleware())
+        router.Use(requestLogMiddleware(logger, sampleEvery))
         corsConfig := cors.DefaultConfig()
-        corsConfig.AllowAllOrigins = true
+        if len(config.CORSAllowedOrigins) > 0 {
+                corsConfig.AllowOrigins = config.CORSAllowedOrigins
+        } else {
+                corsConfig.AllowAllOrigins = true
+        }
         corsConfig.ExposeHeaders = []string{"Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, " +
-                "accept, origin, Cache-Control, X-Requested-With"}
-        corsConfig.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type"}
+                "accept, origin, Cache-Control, X-Requested-With, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, " +
+                "X-RateLimit-Limit-Day, X-RateLimit-Remaining-Day, Retry-After"}
+        corsConfig.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization", "X-API-Key"}
         corsConfig.AllowMethods = []string{"GET"}
         newCors := cors.New(corsConfig)
         router.Use(newCors)
-        router.Use(gin.Logger())
+        router.Use(authMiddleware(authenticator))
 
         router.GET("/status", statusHandler)
+        router.GET("/metrics", metricsHandler)
+        router.GET("/info", infoHandler)
         router.GET("/stringids", stringIdsHandler)
+        router.GET("/ulids", ulidsHandler)
+        router.GET("/uuids", uuidsHandler)
         router.GET("/longids", longIdsHandler)
         router.GET("/longidrange", longIdRangeHandler)
-        // have a status endpoint too
-        router.Run(":8080")
+        router.GET("/longid", longIdHandler)
+        router.GET("/ns/:name/longids", longIdsHandler)
+        router.GET("/ns/:name/longidrange", longIdRangeHandler)
+        router.GET("/ns/:name/longid", longIdHandler)
+        router.GET("/publicids", publicIdsHandler)
+        router.GET("/publicid", publicIdHandler)
+        router.GET("/publicid/reveal", revealPublicIdHandler)
+        router.GET("/ns/:name/publicids", publicIdsHandler)
+        router.GET("/ns/:name/publicid", publicIdHandler)
+        router.GET("/typedids", typedIdsHandler)
+        router.GET("/typedid", typedIdHandler)
+        router.GET("/ns/:name/typedids", typedIdsHandler)
+        router.GET("/ns/:name/typedid", typedIdHandler)
+        router.GET("/shard", shardHandler)
+        router.GET("/ns/:name/shard", shardHandler)
+        router.GET("/idbounds", idBoundsHandler)
+        router.GET("/ns/:name/idbounds", idBoundsHandler)
+        return router
 }
 
 func statusHandler(c *gin.Context) {
@@ -41,31 +171,319 @@ func statusHandler(c *gin.Context) {
 
 func stringIdsHandler(c *gin.Context) {
         // num of ids and length of ids
-        num := c.DefaultQuery("num", "10") // default num of ids = 10
-        len := c.DefaultQuery("len", "32") // number of bytes used to generate random id = 32
-        // NOTE: the char size of base64 encoded string will be different from the num of bytes used.
-        l, _ := strconv.Atoi(len)
-        n, _ := strconv.Atoi(num)
-        ids := GenerateRandomStringId(l, n)
-        strIdList := &StringIDList{List:ids}
-        c.JSON(http.StatusOK, strIdList)
+        n, ok := numQuery(c)
+        if !ok {
+                return
+        }
+        // parsed before the quota is charged, so an invalid volume costs nothing
+        volume := -1.0
+        if q := c.Query("volume"); q != "" {
+                v, err := strconv.ParseFloat(q, 64)
+                if err != nil || v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+                        badRequest(c, errorCodeInvalidParam, "volume", "volume has to be a finite non negative number")
+                        return
+                }
+                volume = v
+        }
+        strIdList := &StringIDList{}
+        var randomBits float64
+        var err error
+        if c.Query("alphabet") == "" && c.Query("size") == "" {
+                // number of bytes used to generate random id = 32
+                // NOTE: the char size of base64 encoded string will be different from the num of bytes used.
+                l, ok := intQuery(c, "len", 32, 1, serviceLimits.MaxLen)
+                if !ok {
+                        return
+                }
+                if !chargeQuota(c, n) {
+                        return
+                }
+                if c.DefaultQuery("padding", "true") == "false" {
+                        strIdList.List, err = GenerateUnpaddedRandomStringId(l, n)
+                } else {
+                        strIdList.List, err = GenerateRandomStringId(l, n)
+                }
+                randomBits = float64(8 * l)
+        } else {
+                // NanoID style: size is in chars of the alphabet
+                alphabet, aerr := stringid.ResolveAlphabet(c.DefaultQuery("alphabet", "base64url"))
+                if aerr != nil {
+                        badRequest(c, errorCodeInvalidParam, "alphabet", aerr.Error())
+                        return
+                }
+                size, ok := intQuery(c, "size", stringid.DefaultSize, 1, serviceLimits.MaxSize)
+                if !ok {
+                        return
+                }
+                if !chargeQuota(c, n) {
+                        return
+                }
+                strIdList.List, err = stringid.Generate(alphabet, size, n)
+                randomBits = stringid.AlphabetBits(alphabet, size)
+        }
+        if err != nil {
+                // the secure random number generator failed, another replica may do better
+                requestLogger(c).Error("failed to generate string ids", "error", err)
+                c.JSON(http.StatusServiceUnavailable, gin.H{"result": "Failed to generate string ids"})
+                return
+        }
+        if volume >= 0 {
+                p := stringid.CollisionProbability(randomBits, volume)
+                strIdList.CollisionProbability = &p
+        }
+        writeJSON(c, http.StatusOK, strIdList)
+}
+
+func ulidsHandler(c *gin.Context) {
+        n, ok := numQuery(c)
+        if !ok {
+                return
+        }
+        if !chargeQuota(c, n) {
+                return
+        }
+        ids, err := GenerateULIDs(n)
+        if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"result": "Failed to generate ulids"})
+                return
+        }
+        writeJSON(c, http.StatusOK, &StringIDList{List:ids})
+}
+
+func uuidsHandler(c *gin.Context) {
+        n, ok := numQuery(c)
+        if !ok {
+                return
+        }
+        version, ok := intQuery(c, "version", 4, 4, 7)
+        if !ok {
+                return
+        }
+        if version != 4 && version != 7 {
+                badRequest(c, errorCodeInvalidParam, "version", "version has to be 4 or 7")
+                return
+        }
+        format := c.DefaultQuery("format", UUIDFormatCanonical)
+        if _, err := (UUID{}).Format(format); err != nil {
+                badRequest(c, errorCodeInvalidParam, "format", "format has to be canonical, compact or base62")
+                return
+        }
+        if !chargeQuota(c, n) {
+                return
+        }
+        ids, err := GenerateUUIDs(version, n, format)
+        if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"result": "Failed to generate uuids"})
+                return
+        }
+        writeJSON(c, http.StatusOK, &StringIDList{List:ids})
+}
+
+// requestNamespace returns the namespace named in the url, or the default namespace for the
+// un-namespaced endpoints. Unknown namespaces get a 404 and nil is returned.
+func requestNamespace(c *gin.Context) *Namespace {
+        name := c.Param("name")
+        if name == "" {
+                name = defaultNamespaceName
+        }
+        ns, ok := lookupNamespace(name)
+        if !ok {
+                c.JSON(http.StatusNotFound, gin.H{"result": "Unknown namespace " + name})
+                return nil
+        }
+        return ns
+}
+
+// recordIssued writes the ids handed out by a request to the audit log, if there is one.
+// Ids which cannot be audited are not handed out: the request gets a 500 and false is returned.
+func recordIssued(c *gin.Context, ns *Namespace, lower uint64, upper uint64, machineId uint16) bool {
+        return recordAudit(c, ns, []AuditRecord{{MachineId: machineId, Namespace: ns.Name, LowerBound: lower, UpperBound: upper}})
+}
+
+// recordIssuedList audits the ids of a list with one record per run of consecutive ids. The lists of strategies
+// like random are neither consecutive nor sorted, a single range from the first to the last id would claim ids
+// which were never handed out.
+func recordIssuedList(c *gin.Context, ns *Namespace, ids []uint64, machineId uint16) bool {
+        var records []AuditRecord
+        for i := 0; i < len(ids); {
+                j := i
+                for j + 1 < len(ids) && ids[j + 1] == ids[j] + 1 {
+                        j++
+                }
+                records = append(records, AuditRecord{MachineId: machineId, Namespace: ns.Name, LowerBound: ids[i], UpperBound: ids[j]})
+                i = j + 1
+        }
+        return recordAudit(c, ns, records)
+}
+
+func recordAudit(c *gin.Context, ns *Namespace, records []AuditRecord) bool {
+        if auditLog == nil {
+                return true
+        }
+        client := requestIdentity(c)
+        for i := range records {
+                records[i].Client = client
+        }
+        if err := auditLog.RecordAll(records); err != nil {
+                requestLogger(c).Error("failed to write audit log", "namespace", ns.Name, "error", err)
+                c.JSON(http.StatusInternalServerError, gin.H{"result": "Failed to audit unique integer ids"})
+                return false
+        }
+        return true
+}
+
+// requestIDFormat returns the format query param. Unknown formats get a 400 and false is returned.
+func requestIDFormat(c *gin.Context) (string, bool) {
+        format := c.DefaultQuery("format", IDFormatNumber)
+        if !ValidIDFormat(format) {
+                badRequest(c, errorCodeInvalidParam, "format", "format has to be one of number, decimal, hex, base32, base58 or base62")
+                return "", false
+        }
+        return format, true
+}
+
+// requestGenerateContext returns the context to generate the ids of a request with. The on_exhausted and
+// max_wait query params override the sequence policy of the namespace, see WithSequencePolicy.
+// Invalid values get a 400 and false is returned.
+func requestGenerateContext(c *gin.Context) (context.Context, bool) {
+        ctx := c.Request.Context()
+        mode, maxWait := c.Query("on_exhausted"), c.Query("max_wait")
+        if mode == "" && maxWait == "" {
+                return ctx, true
+        }
+        policy := SequencePolicy{Mode: mode}
+        if maxWait != "" {
+                var err error
+                if policy.MaxWait, err = time.ParseDuration(maxWait); err != nil || policy.MaxWait <= 0 {
+                        badRequest(c, errorCodeInvalidParam, "max_wait", "max_wait has to be a positive duration like 50ms")
+                        return nil, false
+                }
+        }
+        if !policy.valid() {
+                badRequest(c, errorCodeInvalidParam, "on_exhausted", "on_exhausted has to be one of block, fail or borrow")
+                return nil, false
+        }
+        return WithSequencePolicy(ctx, policy), true
+}
+
+// generateFailed answers a request whose ids could not be generated. If the sequence policy refused to wait
+// for the next tick the request gets a 503 with Retry-After, otherwise a 500.
+func generateFailed(c *gin.Context, ns *Namespace, err error, what string) {
+        var exhausted *SequenceExhaustedError
+        if errors.As(err, &exhausted) {
+                c.Header("Retry-After", strconv.FormatInt(int64(math.Ceil(exhausted.RetryAfter.Seconds())), 10))
+                c.JSON(http.StatusServiceUnavailable, &ErrorResponse{Result: "Sequence of namespace " + ns.Name + " exhausted",
+                        Code: errorCodeSequenceExhausted, RetryAfterMs: int64(math.Ceil(float64(exhausted.RetryAfter) / float64(time.Millisecond)))})
+                return
+        }
+        requestLogger(c).Error("failed to generate " + what, "namespace", ns.Name, "error", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"result": "Failed to generate " + what})
 }
 
 func longIdsHandler(c *gin.Context) {
-        idList, err := GenerateIDList(idGeneratorSettings)
+        format, ok := requestIDFormat(c)
+        if !ok {
+                return
+        }
+        ctx, ok := requestGenerateContext(c)
+        if !ok {
+                return
+        }
+        ns := requestNamespace(c)
+        if ns == nil {
+                return
+        }
+        if !chargeQuota(c, ns.tickSize()) {
+                return
+        }
+        idList, err := ns.GenerateIDList(ctx)
+        if err != nil {
+                generateFailed(c, ns, err, "unique integer id list")
+                return
+        }
+        if !recordIssuedList(c, ns, idList.List, idList.MachineId) {
+                return
+        }
+        if format == IDFormatNumber {
+                writeJSON(c, http.StatusOK, idList)
+                return
+        }
+        encoded, err := idList.Encode(format)
         if err != nil {
-                c.JSON(http.StatusInternalServerError, gin.H{"result": "Failed to generate unique integer id list"})
+                c.JSON(http.StatusInternalServerError, gin.H{"result": "Failed to encode unique integer id list"})
                 return
         }
-        c.JSON(http.StatusOK, idList)
+        writeJSON(c, http.StatusOK, encoded)
 }
 
 func longIdRangeHandler(c *gin.Context) {
-        idRange, err := GenerateIDRange(idGeneratorSettings)
+        format, ok := requestIDFormat(c)
+        if !ok {
+                return
+        }
+        ctx, ok := requestGenerateContext(c)
+        if !ok {
+                return
+        }
+        ns := requestNamespace(c)
+        if ns == nil {
+                return
+        }
+        if !chargeQuota(c, ns.tickSize()) {
+                return
+        }
+        idRange, err := ns.GenerateIDRange(ctx)
         if err != nil {
-                c.JSON(http.StatusInternalServerError, gin.H{"result": "Failed to generate unique integer id range"})
+                generateFailed(c, ns, err, "unique integer id range")
                 return
         }
-        c.JSON(http.StatusOK, idRange)
+        if !recordIssued(c, ns, idRange.LowerBound, idRange.UpperBound, idRange.MachineId) {
+                return
+        }
+        if format == IDFormatNumber {
+                writeJSON(c, http.StatusOK, idRange)
+                return
+        }
+        encoded, err := idRange.Encode(format)
+        if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"result": "Failed to encode unique integer id range"})
+                return
+        }
+        writeJSON(c, http.StatusOK, encoded)
 }
 
+func longIdHandler(c *gin.Context) {
+        format, ok := requestIDFormat(c)
+        if !ok {
+                return
+        }
+        ctx, ok := requestGenerateContext(c)
+        if !ok {
+                return
+        }
+        ns := requestNamespace(c)
+        if ns == nil {
+                return
+        }
+        if !chargeQuota(c, 1) {
+                return
+        }
+        id, err := ns.GenerateID(ctx)
+        if err != nil {
+                generateFailed(c, ns, err, "unique integer id")
+                return
+        }
+        if !recordIssued(c, ns, id.ID, id.ID, id.MachineId) {
+                return
+        }
+        if format == IDFormatNumber {
+                writeJSON(c, http.StatusOK, id)
+                return
+        }
+        encoded, err := id.Encode(format)
+        if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"result": "Failed to encode unique integer id"})
+                return
+        }
+        writeJSON(c, http.StatusOK, encoded)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+        "testing"
+        "fmt"
+        "encoding/json"
+        "io"
+        "log/slog"
+        "net/http"
+        "net/http/httptest"
+        "strings"
+        "time"
+        "gopkg.in/gin-gonic/gin.v1"
+        "github.com/stretchr/testify/assert"
+)
+
+func getTestRouter(t testing.TB) *gin.Engine {
+        gin.SetMode(gin.TestMode)
+        config, err := parseServiceConfig([]byte(`{"namespaces": [
+                {"name": "orders", "start_time": "2020-01-01T00:00:00Z", "time_unit": "1ms",
+                 "layout": {"bit_len_time": 41, "bit_len_machine_id": 12, "bit_len_sequence": 10},
+                 "types": {"order": "ord", "invoice": "inv"}}]}`))
+        if err != nil {
+                t.Fatal("config not parsed: ", err)
+        }
+        err = setupNamespaces(&Settings{StartTime: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC), MachineID: mockMachineId}, config)
+        if err != nil {
+                t.Fatal("namespaces not created: ", err)
+        }
+        return newRouter(config)
+}
+
+func serve(router *gin.Engine, url string) *httptest.ResponseRecorder {
+        w := httptest.NewRecorder()
+        req, _ := http.NewRequest("GET", url, nil)
+        router.ServeHTTP(w, req)
+        return w
+}
+
+func TestNamespaceLongIds(t *testing.T) {
+        router := getTestRouter(t)
+        w := serve(router, "/ns/orders/longids")
+        assert.Equal(t, http.StatusOK, w.Code, "Status mismatch")
+        idList := &IDList{}
+        if err := json.Unmarshal(w.Body.Bytes(), idList); err != nil {
+                t.Fatal("id list cannot be unmarshalled")
+        }
+        // 10 bit sequence in the orders layout
+        assert.Equal(t, 1024, len(idList.List), "Length of ID List should be 1024")
+        assert.Equal(t, uint64(1023), idList.List[1023] - idList.List[0], "Upper and Lower Bound Difference Mismatch")
+
+        w = serve(router, "/ns/orders/longidrange")
+        idRange := &IDRange{}
+        if err := json.Unmarshal(w.Body.Bytes(), idRange); err != nil {
+                t.Fatal("id range cannot be unmarshalled")
+        }
+        assert.Equal(t, true, idRange.LowerBound > idList.List[1023], "Range should follow the list")
+}
+
+func TestDefaultNamespaceDoesNotRepeat(t *testing.T) {
+        router := getTestRouter(t)
+        first := &IDList{}
+        second := &IDList{}
+        json.Unmarshal(serve(router, "/longids").Body.Bytes(), first)
+        json.Unmarshal(serve(router, "/longids").Body.Bytes(), second)
+        assert.Equal(t, 256, len(first.List), "Length of ID List should be 256")
+        assert.Equal(t, true, first.List[255] < second.List[0], "ID lists should not overlap")
+}
+
+func TestUnknownNamespace(t *testing.T) {
+        router := getTestRouter(t)
+        w := serve(router, "/ns/unknown/longids")
+        assert.Equal(t, http.StatusNotFound, w.Code, "Unknown namespace should be a 404")
+        w = serve(router, "/ns/unknown/longidrange")
+        assert.Equal(t, http.StatusNotFound, w.Code, "Unknown namespace should be a 404")
+}
+
+func TestNamespaceMetrics(t *testing.T) {
+        router := getTestRouter(t)
+        serve(router, "/ns/orders/longidrange")
+        w := serve(router, "/metrics")
+        body := w.Body.String()
+        fmt.Println(body)
+        assert.Equal(t, http.StatusOK, w.Code, "Status mismatch")
+        assert.Condition(t, func() bool { return strings.Contains(body, `unique_id_requests_total{namespace="orders"}`) },
+                "metrics should contain the orders namespace")
+        assert.Condition(t, func() bool { return strings.Contains(body, `unique_id_issued_total{namespace="default"}`) },
+                "metrics should contain the default namespace")
+}
+
+func TestInvalidNamespaceConfig(t *testing.T) {
+        _, err := parseServiceConfig([]byte(`{"namespaces": [{"name": "a"}, {"name": "a"}]}`))
+        assert.NotNil(t, err, "duplicate namespaces should be rejected")
+        _, err = parseServiceConfig([]byte(`{"namespaces": [{"name": "Bad Name"}]}`))
+        assert.NotNil(t, err, "invalid names should be rejected")
+
+        st, err := NamespaceConfig{Name: "a", Layout: Layout{40, 16, 8}}.settings()
+        assert.Nil(t, err, "settings should be created")
+        assert.Nil(t, NewSnowFlake(st), "layout with 64 bits should be rejected")
+}
+
+func TestLongIdsFormat(t *testing.T) {
+        router := getTestRouter(t)
+        w := serve(router, "/longids?format=decimal")
+        assert.Equal(t, http.StatusOK, w.Code, "Status mismatch")
+        encoded := &EncodedIDList{}
+        if err := json.Unmarshal(w.Body.Bytes(), encoded); err != nil {
+                t.Fatal("encoded id list cannot be unmarshalled")
+        }
+        assert.Equal(t, 256, len(encoded.List), "Length of ID List should be 256")
+        assert.Equal(t, "decimal", encoded.Format, "Format mismatch")
+
+        w = serve(router, "/ns/orders/longidrange?format=base62")
+        encodedRange := &EncodedIDRange{}
+        json.Unmarshal(w.Body.Bytes(), encodedRange)
+        lower, _ := Decode(encodedRange.LowerBound, IDFormatBase62)
+        upper, _ := Decode(encodedRange.UpperBound, IDFormatBase62)
+        assert.Equal(t, uint64(1023), upper - lower, "Upper and Lower Bound Difference Mismatch")
+
+        w = serve(router, "/longid?format=hex")
+        encodedID := &EncodedID{}
+        json.Unmarshal(w.Body.Bytes(), encodedID)
+        assert.Equal(t, 16, len(encodedID.ID), "Hex id length mismatch")
+
+        w = serve(router, "/longid?format=base64")
+        assert.Equal(t, http.StatusBadRequest, w.Code, "Unknown format should be a 400")
+}
+
+func TestStringIdsAlphabet(t *testing.T) {
+        router := getTestRouter(t)
+        w := serve(router, "/stringids?alphabet=hex&size=12&num=3&volume=1000000")
+        assert.Equal(t, http.StatusOK, w.Code, "Status mismatch")
+        strIdList := &StringIDList{}
+        json.Unmarshal(w.Body.Bytes(), strIdList)
+        assert.Equal(t, 3, len(strIdList.List), "Number of ids mismatch")
+        assert.Equal(t, 12, len(strIdList.List[0]), "ID length should be 12 chars")
+        assert.NotNil(t, strIdList.CollisionProbability, "Collision probability should be reported")
+
+        w = serve(router, "/stringids?len=32&padding=false")
+        strIdList = &StringIDList{}
+        json.Unmarshal(w.Body.Bytes(), strIdList)
+        assert.Equal(t, 43, len(strIdList.List[0]), "Unpadded ID length should be 43")
+        assert.Nil(t, strIdList.CollisionProbability, "Collision probability should only be reported on request")
+
+        w = serve(router, "/stringids?alphabet=a")
+        assert.Equal(t, http.StatusBadRequest, w.Code, "Invalid alphabet should be a 400")
+        w = serve(router, "/stringids?alphabet=%CE%B1%CE%B2%CE%B3")
+        assert.Equal(t, http.StatusBadRequest, w.Code, "Non ascii alphabet should be a 400")
+        for _, volume := range []string{"NaN", "Inf", "-1", "many"} {
+                w = serve(router, "/stringids?alphabet=hex&volume=" + volume)
+                assert.Equal(t, http.StatusBadRequest, w.Code, "volume " + volume + " should be a 400")
+        }
+}
+
+func TestStringIdsInvalidVolumeIsFree(t *testing.T) {
+        router := getAuthRouter(t, []APIKey{{Key: "secret", Client: "billing", PerSecond: 1, Burst: 10, PerDay: 10}})
+        res := serveWithHeader(router, "/stringids?num=10&volume=NaN", "X-API-Key", "secret")
+        assert.Equal(t, http.StatusBadRequest, res.StatusCode, "NaN volume should be a 400")
+        res = serveWithHeader(router, "/stringids?num=10", "X-API-Key", "secret")
+        assert.Equal(t, http.StatusOK, res.StatusCode, "the rejected request should not use up the quota")
+}
+
+func TestStringIdsValidation(t *testing.T) {
+        router := getTestRouter(t)
+        for _, url := range []string{"/stringids?num=abc", "/stringids?num=100000000&len=1000000", "/stringids?len=-1",
+                "/stringids?len=0", "/stringids?size=100000", "/ulids?num=-1", "/uuids?version=5"} {
+                w := serve(router, url)
+                assert.Equal(t, http.StatusBadRequest, w.Code, "Invalid params should be a 400 for " + url)
+                errResponse := &ErrorResponse{}
+                if err := json.Unmarshal(w.Body.Bytes(), errResponse); err != nil {
+                        t.Fatal("error response cannot be unmarshalled")
+                }
+                assert.NotEqual(t, "", errResponse.Code, "Error code should be set for " + url)
+                assert.NotEqual(t, "", errResponse.Param, "Error param should be set for " + url)
+        }
+        w := serve(router, "/stringids?num=100000000")
+        errResponse := &ErrorResponse{}
+        json.Unmarshal(w.Body.Bytes(), errResponse)
+        assert.Equal(t, "num", errResponse.Param, "Param mismatch")
+        assert.Equal(t, errorCodeParamOutOfRange, errResponse.Code, "Code mismatch")
+}
+
+// BenchmarkHandlers measures each endpoint through the full middleware chain. The id list and range endpoints of
+// the default namespace hand out a whole 10ms tick per request, so they are bound by the tick, not by the handler.
+func BenchmarkHandlers(b *testing.B) {
+        defer func(l *slog.Logger) { logger = l }(logger)
+        logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+        router := getTestRouter(b)
+        for _, url := range []string{
+                "/longid", "/longid?format=base62", "/longids", "/longidrange", "/ns/orders/longid",
+                "/ns/orders/longidrange", "/stringids?num=10&len=16", "/stringids?num=10&alphabet=alphanumeric",
+                "/ulids?num=10", "/uuids?version=4&num=10", "/uuids?version=7&num=10", "/status",
+        } {
+                b.Run(strings.TrimPrefix(url, "/"), func(b *testing.B) {
+                        for i := 0; i < b.N; i++ {
+                                if w := serve(router, url); w.Code != http.StatusOK {
+                                        b.Fatalf("status %d for %s", w.Code, url)
+                                }
+                        }
+                })
+        }
+}
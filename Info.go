@@ -0,0 +1,95 @@
+package main
+
+import (
+        "net/http"
+        "runtime/debug"
+        "time"
+        "gopkg.in/gin-gonic/gin.v1"
+)
+
+// version and commit are set at build time:
+//
+//     go build -ldflags "-X main.version=1.4.0 -X main.commit=$(git rev-parse HEAD)"
+//
+// Without ldflags the commit is taken from the vcs info go build embeds, if any.
+var (
+        version = "dev"
+        commit  = ""
+)
+
+// serviceStart is the time the process started, the base of the uptime.
+var serviceStart = time.Now()
+
+// ServiceInfo is the response of /info. It describes the default generator, behind /longids, at the top level
+// so that clients can decode its ids, and every namespace in Namespaces.
+type ServiceInfo struct {
+        NamespaceInfo
+        Version       string          `json:"version"`
+        Commit        string          `json:"commit"`
+        StartedAt     time.Time       `json:"started_at"`
+        UptimeSeconds int64           `json:"uptime_seconds"`
+        Namespaces    []NamespaceInfo `json:"namespaces"`
+}
+
+// NamespaceInfo describes the generator of a namespace. The epoch, layout and time unit needed to decompose
+// the ids and OverflowTime, the time the ids run out, are only set for the snowflake strategy. TimeUnit is
+// formatted like the time_unit of the config.
+type NamespaceInfo struct {
+        Name             string     `json:"name"`
+        Strategy         string     `json:"strategy"`
+        RangeSize        int        `json:"range_size"`
+        MachineID        uint16     `json:"machine_id"`
+        MachineIDSource  string     `json:"machine_id_source,omitempty"`
+        StartTime        *time.Time `json:"start_time,omitempty"`
+        TimeUnit         string     `json:"time_unit,omitempty"`
+        Layout           *Layout    `json:"layout,omitempty"`
+        OverflowTime     *time.Time `json:"overflow_time,omitempty"`
+        RemainingSeconds int64      `json:"remaining_seconds,omitempty"`
+}
+
+func namespaceInfo(ns *Namespace, now time.Time) NamespaceInfo {
+        d := ns.generator.Describe()
+        info := NamespaceInfo{Name: ns.Name, Strategy: d.Strategy, RangeSize: d.RangeSize, MachineID: d.MachineID,
+                MachineIDSource: d.MachineIDSource}
+        if sf := d.SnowFlake; sf != nil {
+                startTime, layout, overflow := sf.StartTime, sf.Layout, sf.OverflowTime()
+                info.StartTime, info.TimeUnit, info.Layout = &startTime, sf.TimeUnit.String(), &layout
+                info.OverflowTime = &overflow
+                info.RemainingSeconds = remainingSeconds(overflow, now)
+        }
+        return info
+}
+
+// remainingSeconds counts the seconds until t, time.Time.Sub saturates after 292 years.
+func remainingSeconds(t time.Time, now time.Time) int64 {
+        return t.Unix() - now.Unix()
+}
+
+// buildCommit returns the commit set by ldflags or else the vcs revision embedded by go build.
+func buildCommit() string {
+        if commit != "" {
+                return commit
+        }
+        if info, ok := debug.ReadBuildInfo(); ok {
+                for _, setting := range info.Settings {
+                        if setting.Key == "vcs.revision" {
+                                return setting.Value
+                        }
+                }
+        }
+        return "unknown"
+}
+
+func infoHandler(c *gin.Context) {
+        now := time.Now()
+        info := ServiceInfo{Version: version, Commit: buildCommit(), StartedAt: serviceStart.UTC(),
+                UptimeSeconds: int64(now.Sub(serviceStart) / time.Second), Namespaces: []NamespaceInfo{}}
+        for _, ns := range sortedNamespaces() {
+                nsInfo := namespaceInfo(ns, now)
+                if ns.Name == defaultNamespaceName {
+                        info.NamespaceInfo = nsInfo
+                }
+                info.Namespaces = append(info.Namespaces, nsInfo)
+        }
+        c.JSON(http.StatusOK, info)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+        "context"
+        "encoding/json"
+        "net/http"
+        "net/http/httptest"
+        "testing"
+        "time"
+        "github.com/spinaki/distributed-unique-id/client"
+        "github.com/stretchr/testify/assert"
+)
+
+func TestInfo(t *testing.T) {
+        router := getTestRouter(t)
+        w := serve(router, "/info")
+        assert.Equal(t, http.StatusOK, w.Code)
+        info := &ServiceInfo{}
+        assert.Nil(t, json.Unmarshal(w.Body.Bytes(), info))
+
+        ns, _ := lookupNamespace(defaultNamespaceName)
+        d := ns.generator.Describe()
+        assert.Equal(t, defaultNamespaceName, info.Name)
+        assert.Equal(t, d.MachineID, info.MachineID)
+        assert.Equal(t, MachineIDFromSettings, info.MachineIDSource)
+        assert.Equal(t, d.SnowFlake.StartTime, *info.StartTime)
+        assert.Equal(t, "10ms", info.TimeUnit)
+        assert.Equal(t, DefaultLayout, *info.Layout)
+        assert.Equal(t, 256, info.RangeSize)
+        assert.Equal(t, "dev", info.Version)
+        assert.NotEmpty(t, info.Commit)
+        assert.True(t, info.UptimeSeconds >= 0)
+        assert.Equal(t, serviceStart.Unix(), info.StartedAt.Unix())
+
+        for _, nsInfo := range info.Namespaces {
+                if nsInfo.Name == "orders" {
+                        assert.Equal(t, "1ms", nsInfo.TimeUnit)
+                        assert.Equal(t, uint8(10), nsInfo.Layout.BitLenSequence)
+                }
+        }
+}
+
+func TestClientDecomposesWithInfo(t *testing.T) {
+        server := httptest.NewServer(getTestRouter(t))
+        defer server.Close()
+        c := client.New(server.URL)
+        ctx := context.Background()
+
+        for _, name := range []string{defaultNamespaceName, "orders"} {
+                ns, _ := lookupNamespace(name)
+                id, err := ns.GenerateID(ctx)
+                assert.Nil(t, err)
+                d, err := c.NamespaceDecoder(ctx, name)
+                assert.Nil(t, err)
+                parts := d.Decompose(id.ID)
+                want := ns.generator.Describe().SnowFlake
+                assert.Equal(t, want.Time(id.ID), parts.Time, name)
+                assert.WithinDuration(t, time.Now(), parts.Time, time.Second, name)
+                assert.Equal(t, id.MachineId, parts.MachineID, name)
+                assert.Equal(t, want.Decompose(id.ID)["sequence"], uint64(parts.Sequence), name)
+        }
+}
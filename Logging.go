@@ -0,0 +1,128 @@
+package main
+
+import (
+        "encoding/hex"
+        "errors"
+        "io"
+        "log/slog"
+        "os"
+        "strings"
+        "sync/atomic"
+        "time"
+        "gopkg.in/gin-gonic/gin.v1"
+)
+
+// LogConfig configures the structured logger.
+//
+// Format is "json" (default) or "text", Level one of "debug", "info" (default), "warn" and "error".
+// SampleEvery logs only every n-th successful request of the id endpoints, so that busy pods do not
+// spend their time logging. Failed requests and every other endpoint are always logged. 0 or 1 logs all requests.
+type LogConfig struct {
+        Format      string `json:"format"`
+        Level       string `json:"level"`
+        SampleEvery uint64 `json:"sample_every"`
+}
+
+// logger is the service logger, replaced at startup by the configured one.
+var logger = slog.Default()
+
+// newLogger returns a logger writing to w as configured.
+func newLogger(config LogConfig, w io.Writer) (*slog.Logger, error) {
+        var level slog.Level
+        switch strings.ToLower(config.Level) {
+        case "debug":
+                level = slog.LevelDebug
+        case "", "info":
+                level = slog.LevelInfo
+        case "warn":
+                level = slog.LevelWarn
+        case "error":
+                level = slog.LevelError
+        default:
+                return nil, errors.New("unknown log level " + config.Level)
+        }
+        options := &slog.HandlerOptions{Level: level}
+        switch strings.ToLower(config.Format) {
+        case "", "json":
+                return slog.New(slog.NewJSONHandler(w, options)), nil
+        case "text":
+                return slog.New(slog.NewTextHandler(w, options)), nil
+        }
+        return nil, errors.New("unknown log format " + config.Format)
+}
+
+// beforeExit is run by fatal, it flushes what would be lost by os.Exit, like the spans of the tracer.
+var beforeExit = func() {}
+
+// fatal logs the error and exits, the structured replacement of log.Fatal.
+func fatal(msg string, err error) {
+        logger.Error(msg, "error", err)
+        beforeExit()
+        os.Exit(1)
+}
+
+const (
+        requestIdHeader  = "X-Request-Id"
+        loggerContextKey = "logger"
+)
+
+// paths of the high volume id endpoints whose successful requests are sampled
+var sampledPaths = map[string]bool{
+        "/longids": true, "/longidrange": true, "/longid": true, "/stringids": true, "/ulids": true, "/uuids": true,
+        "/publicids": true, "/publicid": true, "/typedids": true, "/typedid": true,
+}
+
+// requestLogMiddleware gives every request an id, taken from the X-Request-Id header or generated,
+// stores a logger carrying the id in the context and logs the request once it is done.
+func requestLogMiddleware(base *slog.Logger, sampleEvery uint64) gin.HandlerFunc {
+        var count uint64
+        return func(c *gin.Context) {
+                start := time.Now()
+                requestId := c.Request.Header.Get(requestIdHeader)
+                if requestId == "" || len(requestId) > 64 {
+                        requestId = newRequestId()
+                }
+                c.Writer.Header().Set(requestIdHeader, requestId)
+                reqLogger := base.With("request_id", requestId)
+                c.Set(loggerContextKey, reqLogger)
+                c.Next()
+
+                status := c.Writer.Status()
+                path := c.Request.URL.Path
+                if status < 400 && sampleEvery > 1 && (sampledPaths[path] || strings.HasPrefix(path, "/ns/")) {
+                        if atomic.AddUint64(&count, 1) % sampleEvery != 0 {
+                                return
+                        }
+                }
+                level := slog.LevelInfo
+                if status >= 500 {
+                        level = slog.LevelError
+                } else if status >= 400 {
+                        level = slog.LevelWarn
+                }
+                reqLogger.Log(c.Request.Context(), level, "request",
+                        "method", c.Request.Method,
+                        "path", path,
+                        "query", c.Request.URL.RawQuery,
+                        "status", status,
+                        "latency", time.Since(start),
+                        "client_ip", c.ClientIP(),
+                        "client", requestIdentity(c))
+        }
+}
+
+func newRequestId() string {
+        b, err := generateRandomBytes(8)
+        if err != nil {
+                return "unknown"
+        }
+        return hex.EncodeToString(b)
+}
+
+// requestLogger returns the logger of the request, which carries the request id.
+func requestLogger(c *gin.Context) *slog.Logger {
+        if v, ok := c.Get(loggerContextKey); ok {
+                return v.(*slog.Logger)
+        }
+        return logger
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+        "testing"
+        "bytes"
+        "encoding/json"
+        "net/http"
+        "net/http/httptest"
+        "strings"
+        "gopkg.in/gin-gonic/gin.v1"
+        "github.com/stretchr/testify/assert"
+)
+
+func TestNewLogger(t *testing.T) {
+        var buf bytes.Buffer
+        l, err := newLogger(LogConfig{Format: "json", Level: "warn"}, &buf)
+        assert.Nil(t, err, "logger should be created")
+        l.Info("dropped")
+        l.Warn("kept", "machine_id", 321)
+        line := map[string]interface{}{}
+        assert.Nil(t, json.Unmarshal(buf.Bytes(), &line), "log line should be json")
+        assert.Equal(t, "kept", line["msg"], "Only warnings should be logged")
+        assert.Equal(t, float64(321), line["machine_id"], "Machine id field mismatch")
+
+        buf.Reset()
+        l, _ = newLogger(LogConfig{Format: "text"}, &buf)
+        l.Info("hello")
+        assert.Condition(t, func() bool { return strings.Contains(buf.String(), "msg=hello") }, "text format mismatch")
+
+        _, err = newLogger(LogConfig{Format: "xml"}, &buf)
+        assert.NotNil(t, err, "unknown format should be rejected")
+        _, err = newLogger(LogConfig{Level: "loud"}, &buf)
+        assert.NotNil(t, err, "unknown level should be rejected")
+}
+
+func getLoggedRouter(buf *bytes.Buffer, sampleEvery uint64) *gin.Engine {
+        gin.SetMode(gin.TestMode)
+        l, _ := newLogger(LogConfig{}, buf)
+        router := gin.New()
+        router.Use(requestLogMiddleware(l, sampleEvery))
+        router.GET("/longids", func(c *gin.Context) {
+                requestLogger(c).Info("handler")
+                c.String(http.StatusOK, "OK")
+        })
+        router.GET("/fail", func(c *gin.Context) { c.String(http.StatusInternalServerError, "fail") })
+        return router
+}
+
+func logLines(buf *bytes.Buffer) []map[string]interface{} {
+        var lines []map[string]interface{}
+        for _, s := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+                if s == "" {
+                        continue
+                }
+                line := map[string]interface{}{}
+                json.Unmarshal([]byte(s), &line)
+                lines = append(lines, line)
+        }
+        return lines
+}
+
+func TestRequestId(t *testing.T) {
+        var buf bytes.Buffer
+        router := getLoggedRouter(&buf, 1)
+        w := httptest.NewRecorder()
+        req, _ := http.NewRequest("GET", "/longids", nil)
+        req.Header.Set("X-Request-Id", "abc123")
+        router.ServeHTTP(w, req)
+        assert.Equal(t, "abc123", w.Header().Get("X-Request-Id"), "Request id should be echoed")
+        lines := logLines(&buf)
+        assert.Equal(t, 2, len(lines), "Handler and request should be logged")
+        for _, line := range lines {
+                assert.Equal(t, "abc123", line["request_id"], "Request id field mismatch")
+        }
+        assert.Equal(t, float64(200), lines[1]["status"], "Status field mismatch")
+
+        w = serve(router, "/longids")
+        assert.Equal(t, 16, len(w.Header().Get("X-Request-Id")), "Request id should be generated")
+}
+
+func TestRequestLogSampling(t *testing.T) {
+        var buf bytes.Buffer
+        router := getLoggedRouter(&buf, 10)
+        for i := 0; i < 100; i++ {
+                serve(router, "/longids")
+        }
+        serve(router, "/fail")
+        requests := 0
+        failures := 0
+        for _, line := range logLines(&buf) {
+                if line["msg"] == "request" {
+                        requests++
+                        if line["status"] == float64(500) {
+                                failures++
+                        }
+                }
+        }
+        assert.Equal(t, 11, requests, "Every 10th success and every failure should be logged")
+        assert.Equal(t, 1, failures, "Failures should always be logged")
+}
+
+func TestSampledPaths(t *testing.T) {
+        for _, path := range []string{"/publicids", "/publicid", "/typedids", "/typedid"} {
+                assert.Equal(t, true, sampledPaths[path], path + " should be sampled")
+        }
+        assert.Equal(t, false, sampledPaths["/publicid/reveal"], "reveals should always be logged")
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+        "gopkg.in/gin-gonic/gin.v1"
+        "bytes"
+        "fmt"
+        "net/http"
+        "sync/atomic"
+        "time"
+)
+
+// namespaceMetrics are the counters of a single namespace.
+type namespaceMetrics struct {
+        requests uint64
+        ids      uint64
+        errors   uint64
+}
+
+func (m *namespaceMetrics) record(numIds int, err error) {
+        atomic.AddUint64(&m.requests, 1)
+        if err != nil {
+                atomic.AddUint64(&m.errors, 1)
+                return
+        }
+        atomic.AddUint64(&m.ids, uint64(numIds))
+}
+
+// metricsHandler writes the counters in the prometheus text exposition format.
+func metricsHandler(c *gin.Context) {
+        var buf bytes.Buffer
+        list := sortedNamespaces()
+        writeCounter := func(name string, help string, value func(m *namespaceMetrics) uint64) {
+                fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+                for _, ns := range list {
+                        fmt.Fprintf(&buf, "%s{namespace=%q} %d\n", name, ns.Name, value(ns.metrics))
+                }
+        }
+        writeCounter("unique_id_requests_total", "Number of id requests per namespace.",
+                func(m *namespaceMetrics) uint64 { return atomic.LoadUint64(&m.requests) })
+        writeCounter("unique_id_issued_total", "Number of ids handed out per namespace.",
+                func(m *namespaceMetrics) uint64 { return atomic.LoadUint64(&m.ids) })
+        writeCounter("unique_id_errors_total", "Number of failed id requests per namespace.",
+                func(m *namespaceMetrics) uint64 { return atomic.LoadUint64(&m.errors) })
+        writeEpochMetrics(&buf, list, time.Now())
+        if authenticator != nil {
+                writeClientMetrics(&buf, authenticator)
+        }
+        c.Data(http.StatusOK, "text/plain; version=0.0.4", buf.Bytes())
+}
+
+// writeEpochMetrics writes when the ids of the snowflake namespaces run out, see Descriptor.OverflowTime.
+func writeEpochMetrics(buf *bytes.Buffer, list []*Namespace, now time.Time) {
+        overflow := map[string]time.Time{}
+        for _, ns := range list {
+                if d := ns.generator.Describe().SnowFlake; d != nil {
+                        overflow[ns.Name] = d.OverflowTime()
+                }
+        }
+        fmt.Fprintf(buf, "# HELP unique_id_epoch_overflow_timestamp_seconds Unix time at which the time bits of the ids overflow.\n")
+        fmt.Fprintf(buf, "# TYPE unique_id_epoch_overflow_timestamp_seconds gauge\n")
+        for _, ns := range list {
+                if t, ok := overflow[ns.Name]; ok {
+                        fmt.Fprintf(buf, "unique_id_epoch_overflow_timestamp_seconds{namespace=%q} %d\n", ns.Name, t.Unix())
+                }
+        }
+        fmt.Fprintf(buf, "# HELP unique_id_epoch_remaining_seconds Seconds until the time bits of the ids overflow.\n")
+        fmt.Fprintf(buf, "# TYPE unique_id_epoch_remaining_seconds gauge\n")
+        for _, ns := range list {
+                if t, ok := overflow[ns.Name]; ok {
+                        fmt.Fprintf(buf, "unique_id_epoch_remaining_seconds{namespace=%q} %d\n", ns.Name, remainingSeconds(t, now))
+                }
+        }
+}
+
+// writeClientMetrics writes the usage of every client, of api keys and certificates, summed over the quotas of a client.
+func writeClientMetrics(buf *bytes.Buffer, a *Authenticator) {
+        clients := []string{}
+        issued := map[string]uint64{}
+        rejected := map[string]uint64{}
+        for _, q := range a.sortedClients() {
+                if _, ok := issued[q.key.Client]; !ok {
+                        clients = append(clients, q.key.Client)
+                }
+                issued[q.key.Client] += atomic.LoadUint64(&q.issued)
+                rejected[q.key.Client] += atomic.LoadUint64(&q.rejected)
+        }
+        fmt.Fprintf(buf, "# HELP unique_id_client_issued_total Number of ids charged to the quota of a client.\n")
+        fmt.Fprintf(buf, "# TYPE unique_id_client_issued_total counter\n")
+        for _, client := range clients {
+                fmt.Fprintf(buf, "unique_id_client_issued_total{client=%q} %d\n", client, issued[client])
+        }
+        fmt.Fprintf(buf, "# HELP unique_id_client_rejected_total Number of requests rejected by the quota of a client.\n")
+        fmt.Fprintf(buf, "# TYPE unique_id_client_rejected_total counter\n")
+        for _, client := range clients {
+                fmt.Fprintf(buf, "unique_id_client_rejected_total{client=%q} %d\n", client, rejected[client])
+        }
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+        "context"
+        "fmt"
+        "log/slog"
+        "sort"
+)
+
+const defaultNamespaceName = "default"
+
+// Namespace is a named ID generator, served under /ns/:name.
+// Every namespace owns its generator so that ids of one namespace never depend on another.
+type Namespace struct {
+        Name      string
+        generator IDGenerator
+        metrics   *namespaceMetrics
+        types     map[string]string // prefix of the typed ids by type
+}
+
+// namespaces are registered at startup and only read afterwards.
+var namespaces = map[string]*Namespace{}
+
+// NewNamespace creates a namespace with a SnowFlake configured by the given Settings.
+// If lockFree is set the namespace uses an AtomicSnowFlake.
+func NewNamespace(name string, st Settings, lockFree bool) (*Namespace, error) {
+        if st.Logger == nil {
+                st.Logger = logger
+        }
+        st.Logger = st.Logger.With("namespace", name)
+        var sf IDGenerator
+        if lockFree {
+                if atomicSf := NewAtomicSnowFlake(st); atomicSf != nil {
+                        sf = atomicSf
+                }
+        } else if mutexSf := NewSnowFlake(st); mutexSf != nil {
+                sf = mutexSf
+        }
+        if sf == nil {
+                return nil, fmt.Errorf("snowFlake not created for namespace %q", name)
+        }
+        return NewGeneratorNamespace(name, sf), nil
+}
+
+// NewGeneratorNamespace creates a namespace served by any IDGenerator.
+func NewGeneratorNamespace(name string, g IDGenerator) *Namespace {
+        return &Namespace{Name: name, generator: g, metrics: &namespaceMetrics{}}
+}
+
+// newConfigNamespace creates the namespace of a config entry with the generator of its strategy.
+func newConfigNamespace(nc NamespaceConfig, base *slog.Logger) (*Namespace, error) {
+        strategy, err := nc.strategy()
+        if err != nil {
+                return nil, fmt.Errorf("namespace %q: %v", nc.Name, err)
+        }
+        if base == nil {
+                base = logger
+        }
+        var g IDGenerator
+        switch strategy {
+        case StrategySnowFlake:
+                st, err := nc.settings()
+                if err != nil {
+                        return nil, fmt.Errorf("namespace %q: %v", nc.Name, err)
+                }
+                st.Logger = base
+                return NewNamespace(nc.Name, st, nc.LockFree)
+        case StrategyTicket:
+                config := *nc.Ticket
+                if config.Key == "" {
+                        config.Key = "unique-id:" + nc.Name
+                }
+                g, err = NewTicketGenerator(config, base.With("namespace", nc.Name))
+        case StrategySegment:
+                config := *nc.Segment
+                if config.File == "" && config.Key == "" {
+                        config.Key = "unique-id:" + nc.Name
+                }
+                g, err = NewSegmentGenerator(config, base.With("namespace", nc.Name))
+        case StrategyRandom:
+                g = NewRandomGenerator(0)
+        }
+        if err != nil {
+                return nil, fmt.Errorf("namespace %q: %v", nc.Name, err)
+        }
+        return NewGeneratorNamespace(nc.Name, g), nil
+}
+
+func registerNamespace(ns *Namespace) {
+        namespaces[ns.Name] = ns
+}
+
+func lookupNamespace(name string) (*Namespace, bool) {
+        ns, ok := namespaces[name]
+        return ns, ok
+}
+
+// sortedNamespaces returns the registered namespaces ordered by name.
+func sortedNamespaces() []*Namespace {
+        list := make([]*Namespace, 0, len(namespaces))
+        for _, ns := range namespaces {
+                list = append(list, ns)
+        }
+        sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+        return list
+}
+
+// setupNamespaces registers the default namespace built from the default settings
+// and every namespace of the config. A config namespace called "default" wins.
+func setupNamespaces(defaultSettings *Settings, config *ServiceConfig) error {
+        if _, ok := lookupNamespace(defaultNamespaceName); !ok {
+                ns, err := NewNamespace(defaultNamespaceName, *defaultSettings, false)
+                if err != nil {
+                        return err
+                }
+                registerNamespace(ns)
+        }
+        for _, nc := range config.Namespaces {
+                ns, err := newConfigNamespace(nc, defaultSettings.Logger)
+                if err != nil {
+                        return err
+                }
+                ns.types = nc.Types
+                registerNamespace(ns)
+        }
+        return nil
+}
+
+// tickSize is the number of ids of a tick, the size of GenerateIDList and GenerateIDRange.
+func (ns *Namespace) tickSize() int {
+        return ns.generator.Describe().RangeSize
+}
+
+// machineID is the machine id reported with the ids, 0 for strategies without one.
+func (ns *Namespace) machineID() uint16 {
+        return ns.generator.Describe().MachineID
+}
+
+// GenerateID returns a single id of the namespace generator.
+func (ns *Namespace) GenerateID(ctx context.Context) (*SingleID, error) {
+        id, err := tracedNextID(ctx, ns.generator)
+        if err != nil {
+                ns.metrics.record(0, err)
+                return nil, err
+        }
+        ns.metrics.record(1, nil)
+        return &SingleID{ID: id, MachineId: ns.machineID()}, nil
+}
+
+// GenerateIDList returns the ids of a whole tick of the namespace generator.
+func (ns *Namespace) GenerateIDList(ctx context.Context) (*IDList, error) {
+        ids, err := tracedNextIDs(ctx, ns.generator, ns.tickSize())
+        ns.metrics.record(len(ids), err)
+        if err != nil {
+                return nil, err
+        }
+        return &IDList{List: ids, MachineId: ns.machineID()}, nil
+}
+
+// GenerateIDRange returns the bounds of a whole tick of the namespace generator.
+func (ns *Namespace) GenerateIDRange(ctx context.Context) (*IDRange, error) {
+        lower, upper, err := tracedNextIDRange(ctx, ns.generator, ns.tickSize())
+        if err != nil {
+                ns.metrics.record(0, err)
+                return nil, err
+        }
+        ns.metrics.record(int(upper - lower + 1), nil)
+        return &IDRange{LowerBound: lower, UpperBound: upper, MachineId: ns.machineID()}, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+        "fmt"
+        "net/http"
+        "strconv"
+        "gopkg.in/gin-gonic/gin.v1"
+)
+
+// Limits bounds the work a single request can ask for. Zero values fall back to defaultLimits.
+type Limits struct {
+        MaxNum  int `json:"max_num"`  // max number of ids per request
+        MaxLen  int `json:"max_len"`  // max number of random bytes of a base64 string id
+        MaxSize int `json:"max_size"` // max number of chars of an alphabet string id
+}
+
+var defaultLimits = Limits{MaxNum: 1000, MaxLen: 256, MaxSize: 256}
+
+// serviceLimits are the limits in effect, set from the config at startup.
+var serviceLimits = defaultLimits
+
+// withDefaults fills every unset limit from defaultLimits.
+func (l Limits) withDefaults() Limits {
+        if l.MaxNum <= 0 {
+                l.MaxNum = defaultLimits.MaxNum
+        }
+        if l.MaxLen <= 0 {
+                l.MaxLen = defaultLimits.MaxLen
+        }
+        if l.MaxSize <= 0 {
+                l.MaxSize = defaultLimits.MaxSize
+        }
+        return l
+}
+
+// ErrorResponse is the body of a rejected request. Result is the human readable message every
+// error response of the service carries, Code and Param tell clients what to fix. RetryAfterMs is the
+// Retry-After header in msec, for waits shorter than the second the header counts in.
+type ErrorResponse struct {
+        Result       string `json:"result"`
+        Code         string `json:"code"`
+        Param        string `json:"param,omitempty"`
+        RetryAfterMs int64  `json:"retry_after_ms,omitempty"`
+}
+
+const (
+        errorCodeInvalidParam      = "invalid_param"
+        errorCodeParamOutOfRange   = "param_out_of_range"
+        errorCodeSequenceExhausted = "sequence_exhausted"
+)
+
+func badRequest(c *gin.Context, code string, param string, message string) {
+        c.JSON(http.StatusBadRequest, &ErrorResponse{Result: message, Code: code, Param: param})
+}
+
+// intQuery parses the query param name as an int in [min, max]. If the param is missing def is used.
+// Invalid values get a 400 and false is returned.
+func intQuery(c *gin.Context, name string, def int, min int, max int) (int, bool) {
+        v, err := strconv.Atoi(c.DefaultQuery(name, strconv.Itoa(def)))
+        if err != nil {
+                badRequest(c, errorCodeInvalidParam, name, name + " has to be an integer")
+                return 0, false
+        }
+        if v < min || v > max {
+                badRequest(c, errorCodeParamOutOfRange, name, fmt.Sprintf("%s has to be between %d and %d", name, min, max))
+                return 0, false
+        }
+        return v, true
+}
+
+// numQuery parses the num param, the number of ids a request asks for.
+func numQuery(c *gin.Context) (int, bool) {
+        return intQuery(c, "num", 10, 1, serviceLimits.MaxNum) // default num of ids = 10
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+        "crypto/aes"
+        "crypto/cipher"
+        "encoding/binary"
+        "encoding/hex"
+        "errors"
+        "fmt"
+        "net/http"
+        "strings"
+        "gopkg.in/gin-gonic/gin.v1"
+)
+
+// feistelRounds is the number of rounds of the Feistel network. Four rounds with a pseudo random round function
+// already give a strong pseudo random permutation, the extra rounds are cheap.
+const feistelRounds = 8
+
+// maxKeyVersion is the largest key version, the version is the first base62 digit of a public id.
+const maxKeyVersion = 61
+
+// FeistelKey is a keyed, reversible permutation of 64-bit ids. The id is split into two 32-bit halves which
+// go through a balanced Feistel network whose round function is AES of the round number and the right half.
+type FeistelKey struct {
+        Version uint8
+        block   cipher.Block
+}
+
+// NewFeistelKey creates a key from 16, 24 or 32 bytes of secret. Version tags the ids obfuscated with the key.
+func NewFeistelKey(version uint8, secret []byte) (*FeistelKey, error) {
+        if version > maxKeyVersion {
+                return nil, fmt.Errorf("key version has to be at most %d", maxKeyVersion)
+        }
+        block, err := aes.NewCipher(secret)
+        if err != nil {
+                return nil, err
+        }
+        return &FeistelKey{Version: version, block: block}, nil
+}
+
+func (k *FeistelKey) round(r int, half uint32) uint32 {
+        var in, out [aes.BlockSize]byte
+        in[0] = byte(r)
+        binary.BigEndian.PutUint32(in[1:], half)
+        k.block.Encrypt(out[:], in[:])
+        return binary.BigEndian.Uint32(out[:])
+}
+
+// Permute maps an id to its obfuscated value. Distinct ids give distinct values.
+func (k *FeistelKey) Permute(id uint64) uint64 {
+        left, right := uint32(id >> 32), uint32(id)
+        for r := 0; r < feistelRounds; r++ {
+                left, right = right, left ^ k.round(r, right)
+        }
+        return uint64(left) << 32 | uint64(right)
+}
+
+// Unpermute is the inverse of Permute.
+func (k *FeistelKey) Unpermute(value uint64) uint64 {
+        left, right := uint32(value >> 32), uint32(value)
+        for r := feistelRounds - 1; r >= 0; r-- {
+                left, right = right ^ k.round(r, left), left
+        }
+        return uint64(left) << 32 | uint64(right)
+}
+
+// Obfuscator turns ids into public ids with the current key and reveals public ids of every key it knows,
+// so keys can be rotated: add the new key, make it current and keep the old ones as long as their ids are around.
+// A public id is the base62 digit of the key version followed by the 11 base62 digits of the permuted id.
+// Public ids do not sort like the ids. It is safe for concurrent use.
+type Obfuscator struct {
+        keys    map[uint8]*FeistelKey
+        current *FeistelKey
+}
+
+// NewObfuscator returns an Obfuscator which obfuscates with the key of version current.
+func NewObfuscator(keys []*FeistelKey, current uint8) (*Obfuscator, error) {
+        o := &Obfuscator{keys: map[uint8]*FeistelKey{}}
+        for _, k := range keys {
+                if _, ok := o.keys[k.Version]; ok {
+                        return nil, fmt.Errorf("key version %d defined twice", k.Version)
+                }
+                o.keys[k.Version] = k
+        }
+        o.current = o.keys[current]
+        if o.current == nil {
+                return nil, fmt.Errorf("no key of the current version %d", current)
+        }
+        return o, nil
+}
+
+// CurrentVersion returns the version of the key new public ids are obfuscated with.
+func (o *Obfuscator) CurrentVersion() uint8 {
+        return o.current.Version
+}
+
+// Obfuscate returns the public id of an id.
+func (o *Obfuscator) Obfuscate(id uint64) string {
+        body, _ := Encode(o.current.Permute(id), IDFormatBase62)
+        return string(base62Alphabet[o.current.Version]) + body
+}
+
+// Reveal returns the id behind a public id and the version of the key it was obfuscated with.
+// Only ids with the msb unset, like all SnowFlake ids, are revealed.
+func (o *Obfuscator) Reveal(publicID string) (uint64, uint8, error) {
+        if len(publicID) != 12 {
+                return 0, 0, errors.New("public ids have 12 characters")
+        }
+        version := strings.IndexByte(base62Alphabet, publicID[0])
+        k, ok := o.keys[uint8(version)]
+        if version < 0 || !ok {
+                return 0, 0, fmt.Errorf("unknown key version %q", publicID[0])
+        }
+        value, err := Decode(publicID[1:], IDFormatBase62)
+        if err != nil {
+                return 0, 0, err
+        }
+        id := k.Unpermute(value)
+        // the msb of a SnowFlake id is always 0, so half of the mistyped or forged public ids are caught here
+        if id >> 63 != 0 {
+                return 0, 0, errors.New("invalid public id")
+        }
+        return id, k.Version, nil
+}
+
+// PublicIDConfig enables /publicids. Keys are hex encoded AES keys of 16, 24 or 32 bytes, tagged with a version
+// between 0 and 61. New public ids use the key of CurrentVersion, the others are kept to reveal older public ids.
+// The config file holds the keys, so keep it secret.
+// RevealClients are the clients, by api key client or certificate identity, allowed to reveal public ids, "*"
+// allows every request. Without them /publicid/reveal is forbidden.
+type PublicIDConfig struct {
+        Keys           []PublicIDKey `json:"keys"`
+        CurrentVersion uint8         `json:"current_version"`
+        RevealClients  []string      `json:"reveal_clients"`
+}
+
+// PublicIDKey is a versioned key of PublicIDConfig.
+type PublicIDKey struct {
+        Version uint8  `json:"version"`
+        Key     string `json:"key"`
+}
+
+// obfuscator creates the Obfuscator of the config.
+func (pc *PublicIDConfig) obfuscator() (*Obfuscator, error) {
+        keys := make([]*FeistelKey, 0, len(pc.Keys))
+        for _, pk := range pc.Keys {
+                secret, err := hex.DecodeString(pk.Key)
+                if err != nil {
+                        return nil, fmt.Errorf("key version %d is not hex: %v", pk.Version, err)
+                }
+                k, err := NewFeistelKey(pk.Version, secret)
+                if err != nil {
+                        return nil, fmt.Errorf("key version %d: %v", pk.Version, err)
+                }
+                keys = append(keys, k)
+        }
+        return NewObfuscator(keys, pc.CurrentVersion)
+}
+
+// revealClients returns the set of RevealClients.
+func (pc *PublicIDConfig) revealClients() map[string]bool {
+        clients := map[string]bool{}
+        for _, client := range pc.RevealClients {
+                clients[client] = true
+        }
+        return clients
+}
+
+// publicIDs and publicIDRevealClients are set at startup if public ids are configured.
+var (
+        publicIDs             *Obfuscator
+        publicIDRevealClients map[string]bool
+)
+
+// PublicIDList is the response of /publicids.
+type PublicIDList struct {
+        List       []string `json:"id_list"`
+        KeyVersion uint8    `json:"key_version"`
+}
+
+// PublicID is the response of /publicid.
+type PublicID struct {
+        ID         string `json:"id"`
+        KeyVersion uint8  `json:"key_version"`
+}
+
+// RevealedID is the response of /publicid/reveal.
+type RevealedID struct {
+        ID         uint64 `json:"id"`
+        PublicID   string `json:"public_id"`
+        KeyVersion uint8  `json:"key_version"`
+}
+
+// requestObfuscator returns the Obfuscator, if public ids are not configured the request gets a 404 and nil.
+func requestObfuscator(c *gin.Context) *Obfuscator {
+        if publicIDs == nil {
+                c.JSON(http.StatusNotFound, gin.H{"result": "Public ids are not configured"})
+        }
+        return publicIDs
+}
+
+func publicIdsHandler(c *gin.Context) {
+        obfuscator := requestObfuscator(c)
+        if obfuscator == nil {
+                return
+        }
+        ctx, ok := requestGenerateContext(c)
+        if !ok {
+                return
+        }
+        ns := requestNamespace(c)
+        if ns == nil {
+                return
+        }
+        if !chargeQuota(c, ns.tickSize()) {
+                return
+        }
+        idList, err := ns.GenerateIDList(ctx)
+        if err != nil {
+                generateFailed(c, ns, err, "public id list")
+                return
+        }
+        if !recordIssuedList(c, ns, idList.List, idList.MachineId) {
+                return
+        }
+        publicIdList := &PublicIDList{List: make([]string, len(idList.List)), KeyVersion: obfuscator.CurrentVersion()}
+        for i, id := range idList.List {
+                publicIdList.List[i] = obfuscator.Obfuscate(id)
+        }
+        writeJSON(c, http.StatusOK, publicIdList)
+}
+
+func publicIdHandler(c *gin.Context) {
+        obfuscator := requestObfuscator(c)
+        if obfuscator == nil {
+                return
+        }
+        ctx, ok := requestGenerateContext(c)
+        if !ok {
+                return
+        }
+        ns := requestNamespace(c)
+        if ns == nil {
+                return
+        }
+        if !chargeQuota(c, 1) {
+                return
+        }
+        id, err := ns.GenerateID(ctx)
+        if err != nil {
+                generateFailed(c, ns, err, "public id")
+                return
+        }
+        if !recordIssued(c, ns, id.ID, id.ID, id.MachineId) {
+                return
+        }
+        writeJSON(c, http.StatusOK, &PublicID{ID: obfuscator.Obfuscate(id.ID), KeyVersion: obfuscator.CurrentVersion()})
+}
+
+func revealPublicIdHandler(c *gin.Context) {
+        obfuscator := requestObfuscator(c)
+        if obfuscator == nil {
+                return
+        }
+        if client := requestIdentity(c); !publicIDRevealClients["*"] && (client == "" || !publicIDRevealClients[client]) {
+                c.JSON(http.StatusForbidden, &ErrorResponse{Result: "Client may not reveal public ids", Code: "forbidden"})
+                return
+        }
+        if !chargeQuota(c, 1) {
+                return
+        }
+        publicID := c.Query("id")
+        id, version, err := obfuscator.Reveal(publicID)
+        if err != nil {
+                badRequest(c, errorCodeInvalidParam, "id", err.Error())
+                return
+        }
+        writeJSON(c, http.StatusOK, &RevealedID{ID: id, PublicID: publicID, KeyVersion: version})
+}
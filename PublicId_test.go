@@ -0,0 +1,149 @@
+package main
+
+import (
+        "bytes"
+        "encoding/json"
+        "math/rand"
+        "net/http"
+        "testing"
+        "testing/quick"
+        "github.com/stretchr/testify/assert"
+)
+
+func testFeistelKey(t *testing.T, version uint8, seed byte) *FeistelKey {
+        k, err := NewFeistelKey(version, bytes.Repeat([]byte{seed}, 16))
+        if err != nil {
+                t.Fatal("key not created: ", err)
+        }
+        return k
+}
+
+func TestFeistelRoundTrip(t *testing.T) {
+        k := testFeistelKey(t, 1, 7)
+        roundTrip := func(id uint64) bool {
+                return k.Unpermute(k.Permute(id)) == id
+        }
+        if err := quick.Check(roundTrip, &quick.Config{MaxCount: 10000}); err != nil {
+                t.Error(err)
+        }
+        for _, id := range []uint64{0, 1, 1 << 63 - 1, ^uint64(0)} {
+                assert.True(t, roundTrip(id), "round trip of %d", id)
+        }
+}
+
+func TestFeistelPermutes(t *testing.T) {
+        k := testFeistelKey(t, 1, 7)
+        other := testFeistelKey(t, 2, 8)
+        seen := map[uint64]bool{}
+        // consecutive ids, like the ids of a tick, must not give away their order
+        for id := uint64(1 << 40); id < 1 << 40 + 10000; id++ {
+                p := k.Permute(id)
+                assert.False(t, seen[p], "permutation should be injective")
+                seen[p] = true
+                assert.NotEqual(t, p, other.Permute(id), "keys should permute differently")
+        }
+        assert.NotEqual(t, k.Permute(1 << 40) + 1, k.Permute(1 << 40 + 1))
+
+        _, err := NewFeistelKey(62, bytes.Repeat([]byte{1}, 16))
+        assert.NotNil(t, err, "version 62 does not fit into a base62 digit")
+        _, err = NewFeistelKey(1, []byte("short"))
+        assert.NotNil(t, err, "key too short")
+}
+
+func TestObfuscatorRotation(t *testing.T) {
+        oldKey, newKey := testFeistelKey(t, 1, 7), testFeistelKey(t, 2, 8)
+        before, err := NewObfuscator([]*FeistelKey{oldKey}, 1)
+        assert.Nil(t, err)
+        after, err := NewObfuscator([]*FeistelKey{oldKey, newKey}, 2)
+        assert.Nil(t, err)
+
+        reveal := func(id uint64) bool {
+                id >>= 1
+                publicID := before.Obfuscate(id)
+                revealed, version, err := after.Reveal(publicID)
+                if err != nil || revealed != id || version != 1 {
+                        return false
+                }
+                revealed, version, err = after.Reveal(after.Obfuscate(id))
+                return err == nil && revealed == id && version == 2 && len(publicID) == 12
+        }
+        if err := quick.Check(reveal, &quick.Config{MaxCount: 10000}); err != nil {
+                t.Error(err)
+        }
+
+        _, _, err = before.Reveal(after.Obfuscate(12345))
+        assert.NotNil(t, err, "version 2 is unknown before the rotation")
+        _, err = NewObfuscator([]*FeistelKey{oldKey}, 2)
+        assert.NotNil(t, err, "current key missing")
+        _, err = NewObfuscator([]*FeistelKey{oldKey, oldKey}, 1)
+        assert.NotNil(t, err, "duplicate version")
+}
+
+func TestRevealRejectsForgedIds(t *testing.T) {
+        o, _ := NewObfuscator([]*FeistelKey{testFeistelKey(t, 1, 7)}, 1)
+        rejected := 0
+        r := rand.New(rand.NewSource(1))
+        for i := 0; i < 1000; i++ {
+                forged := "1" + mustEncode(r.Uint64(), IDFormatBase62)
+                if _, _, err := o.Reveal(forged); err != nil {
+                        rejected++
+                }
+        }
+        assert.True(t, rejected > 400, "about half of the forged ids should be rejected, got %d", rejected)
+        for _, invalid := range []string{"", "1abc", "2" + mustEncode(1, IDFormatBase62), "1!0000000000"} {
+                _, _, err := o.Reveal(invalid)
+                assert.NotNil(t, err, "%q should be invalid", invalid)
+        }
+}
+
+func TestPublicIdsEndpoints(t *testing.T) {
+        router := getTestRouter(t)
+        w := serve(router, "/publicids")
+        assert.Equal(t, http.StatusNotFound, w.Code, "public ids are not configured")
+
+        config := &PublicIDConfig{CurrentVersion: 3, Keys: []PublicIDKey{{Version: 3, Key: "000102030405060708090a0b0c0d0e0f"}}}
+        o, err := config.obfuscator()
+        assert.Nil(t, err)
+        publicIDs = o
+        t.Cleanup(func() { publicIDs, publicIDRevealClients = nil, nil })
+
+        publicIdList := &PublicIDList{}
+        w = serve(router, "/ns/orders/publicids")
+        assert.Equal(t, http.StatusOK, w.Code)
+        if err := json.Unmarshal(w.Body.Bytes(), publicIdList); err != nil {
+                t.Fatal("public id list cannot be unmarshalled")
+        }
+        assert.Equal(t, 1024, len(publicIdList.List))
+        assert.Equal(t, uint8(3), publicIdList.KeyVersion)
+
+        w = serve(router, "/publicid/reveal?id=" + publicIdList.List[1])
+        assert.Equal(t, http.StatusForbidden, w.Code, "revealing has to be allowed")
+        publicIDRevealClients = (&PublicIDConfig{RevealClients: []string{"*"}}).revealClients()
+
+        revealed := &RevealedID{}
+        w = serve(router, "/publicid/reveal?id=" + publicIdList.List[1])
+        assert.Equal(t, http.StatusOK, w.Code)
+        json.Unmarshal(w.Body.Bytes(), revealed)
+        first, _, _ := o.Reveal(publicIdList.List[0])
+        assert.Equal(t, first + 1, revealed.ID, "public ids should hide consecutive ids")
+
+        publicID := &PublicID{}
+        json.Unmarshal(serve(router, "/publicid").Body.Bytes(), publicID)
+        id, version, err := o.Reveal(publicID.ID)
+        assert.Nil(t, err)
+        assert.Equal(t, uint8(3), version)
+        assert.Equal(t, uint64(321), decompose(id)["machine-id"])
+
+        w = serve(router, "/publicid/reveal?id=4abc")
+        assert.Equal(t, http.StatusBadRequest, w.Code)
+
+        router = getAuthRouter(t, []APIKey{{Key: "k1", Client: "support"}, {Key: "k2", Client: "web"}})
+        publicIDRevealClients = (&PublicIDConfig{RevealClients: []string{"support"}}).revealClients()
+        path := "/publicid/reveal?id=" + publicIdList.List[1]
+        assert.Equal(t, http.StatusOK, serveWithHeader(router, path, "X-API-Key", "k1").StatusCode, "support may reveal")
+        assert.Equal(t, http.StatusForbidden, serveWithHeader(router, path, "X-API-Key", "k2").StatusCode, "web may not reveal")
+
+        config.Keys[0].Key = "xyz"
+        _, err = config.obfuscator()
+        assert.NotNil(t, err, "key is not hex")
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+        "crypto/rand"
+        "encoding/binary"
+)
+
+// RandomGenerator hands out random 63-bit ids from the secure random number generator. Ids need no
+// coordination between replicas, but they carry no order and collide with a probability of about k²/2⁶⁴
+// for k ids. A range starts at a random id, so ranges collide more often than single ids.
+type RandomGenerator struct {
+        rangeSize int
+}
+
+// NewRandomGenerator returns a RandomGenerator whose ranges hold up to rangeSize ids, 0 means 256.
+func NewRandomGenerator(rangeSize int) *RandomGenerator {
+        if rangeSize <= 0 {
+                rangeSize = 1 << BitLenSequence
+        }
+        return &RandomGenerator{rangeSize: rangeSize}
+}
+
+// NextID returns a random id.
+func (g *RandomGenerator) NextID() (uint64, error) {
+        return randomUint63()
+}
+
+// NextIDs returns n random ids in no particular order.
+func (g *RandomGenerator) NextIDs(n int) ([]uint64, error) {
+        if err := checkCount(n, 0); err != nil {
+                return nil, err
+        }
+        idList := make([]uint64, 0, n)
+        for len(idList) < n {
+                id, err := randomUint63()
+                if err != nil {
+                        return nil, err
+                }
+                idList = append(idList, id)
+        }
+        return idList, nil
+}
+
+// NextIDRange returns n consecutive ids starting at a random id.
+func (g *RandomGenerator) NextIDRange(n int) (uint64, uint64, error) {
+        if err := checkCount(n, g.rangeSize); err != nil {
+                return 0, 0, err
+        }
+        lower, err := randomUint63()
+        if err != nil {
+                return 0, 0, err
+        }
+        // keep the range below 2^63
+        lower %= 1 << 63 - uint64(n) + 1
+        return lower, lower + uint64(n - 1), nil
+}
+
+// Describe returns the random strategy.
+func (g *RandomGenerator) Describe() Description {
+        return Description{Strategy: StrategyRandom, RangeSize: g.rangeSize}
+}
+
+func randomUint63() (uint64, error) {
+        var b [8]byte
+        if _, err := rand.Read(b[:]); err != nil {
+                return 0, err
+        }
+        return binary.BigEndian.Uint64(b[:]) >> 1, nil
+}
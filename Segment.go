@@ -0,0 +1,222 @@
+package main
+
+import (
+        "context"
+        "errors"
+        "fmt"
+        "log/slog"
+        "os"
+        "path/filepath"
+        "strconv"
+        "strings"
+        "sync"
+        "go.opentelemetry.io/otel/attribute"
+        "go.opentelemetry.io/otel/trace"
+)
+
+// SegmentConfig configures a namespace whose ids come in segments of a counter, like Leaf-segment. The counter
+// lives in Redis, configured like TicketConfig with BlockSize as the segment size, or in File for a single
+// replica. Unlike a TicketGenerator, the next segment is fetched in the background once half of the current
+// one is used, so callers rarely wait for the counter.
+type SegmentConfig struct {
+        TicketConfig
+        File string `json:"file"` // counter file, used instead of Redis if set
+}
+
+// SegmentGenerator hands out ids of a segment reserved from a counter while the next segment is prefetched.
+// NextIDRange hands out up to RangeSize consecutive ids. It is safe for concurrent use.
+type SegmentGenerator struct {
+        mutex       sync.Mutex
+        counter     segmentCounter
+        rangeSize   uint64
+        segmentSize uint64
+        next        uint64 // next id of the current segment
+        end         uint64 // first id after the current segment
+        prefetch    chan segmentResult // receives the next segment, nil if it is not being fetched
+        logger      *slog.Logger
+}
+
+// segmentCounter reserves n ids and returns the last one.
+type segmentCounter interface {
+        reserve(ctx context.Context, n uint64) (uint64, error)
+}
+
+type segmentResult struct {
+        upper uint64
+        err   error
+}
+
+// NewSegmentGenerator returns a SegmentGenerator for the config. The counter is not touched before the first id.
+func NewSegmentGenerator(config SegmentConfig, logger *slog.Logger) (*SegmentGenerator, error) {
+        if err := config.setDefaults(); err != nil {
+                return nil, err
+        }
+        if logger == nil {
+                logger = slog.Default()
+        }
+        g := &SegmentGenerator{rangeSize: uint64(config.RangeSize), segmentSize: uint64(config.BlockSize)}
+        switch {
+        case config.File != "":
+                g.counter = &fileCounter{path: config.File}
+                g.logger = logger.With("counter_file", config.File)
+        case config.Addr != "" && config.Key != "":
+                timeout, err := config.timeout()
+                if err != nil {
+                        return nil, err
+                }
+                g.counter = newRedisCounter(config.TicketConfig, timeout)
+                g.logger = logger.With("redis_key", config.Key)
+        default:
+                return nil, errors.New("segment generator needs a counter file or a redis addr and key")
+        }
+        return g, nil
+}
+
+// NextID returns the next id of the segment.
+func (g *SegmentGenerator) NextID() (uint64, error) {
+        return g.NextIDContext(context.Background())
+}
+
+// NextIDContext is NextID with the wait for a segment traced as a child of ctx.
+func (g *SegmentGenerator) NextIDContext(ctx context.Context) (uint64, error) {
+        id, _, err := g.NextIDRangeContext(ctx, 1)
+        return id, err
+}
+
+// NextIDs returns n increasing ids, consecutive within a range.
+func (g *SegmentGenerator) NextIDs(n int) ([]uint64, error) {
+        return g.NextIDsContext(context.Background(), n)
+}
+
+// NextIDsContext is NextIDs with the waits for segments traced as children of ctx.
+func (g *SegmentGenerator) NextIDsContext(ctx context.Context, n int) ([]uint64, error) {
+        return collectRanges(ctx, g, n)
+}
+
+// NextIDRange returns the bounds of n consecutive ids, n is at most RangeSize. If the rest of the segment is
+// shorter, the rest is dropped and the next segment is used.
+func (g *SegmentGenerator) NextIDRange(n int) (uint64, uint64, error) {
+        return g.NextIDRangeContext(context.Background(), n)
+}
+
+// NextIDRangeContext is NextIDRange with the wait for a segment traced as a child of ctx.
+func (g *SegmentGenerator) NextIDRangeContext(ctx context.Context, n int) (uint64, uint64, error) {
+        if err := checkCount(n, int(g.rangeSize)); err != nil {
+                return 0, 0, err
+        }
+        g.mutex.Lock()
+        defer g.mutex.Unlock()
+        if g.end - g.next < uint64(n) {
+                if err := g.nextSegment(ctx); err != nil {
+                        return 0, 0, err
+                }
+        }
+        lower := g.next
+        g.next += uint64(n)
+        if g.prefetch == nil && g.end - g.next <= g.segmentSize / 2 {
+                g.startPrefetch()
+        }
+        return lower, g.next - 1, nil
+}
+
+// Describe returns the segment strategy, segment ids carry neither a time nor a machine id.
+func (g *SegmentGenerator) Describe() Description {
+        return Description{Strategy: StrategySegment, RangeSize: int(g.rangeSize)}
+}
+
+// startPrefetch fetches the next segment in the background. The caller holds the mutex.
+func (g *SegmentGenerator) startPrefetch() {
+        prefetch := make(chan segmentResult, 1)
+        g.prefetch = prefetch
+        go func() {
+                upper, err := g.fetch(context.Background())
+                prefetch <- segmentResult{upper, err}
+        }()
+}
+
+// nextSegment replaces the current segment by the prefetched one, waiting for it if needed. Without a
+// prefetch the segment is fetched right away. The caller holds the mutex.
+func (g *SegmentGenerator) nextSegment(ctx context.Context) error {
+        var result segmentResult
+        if g.prefetch == nil {
+                result.upper, result.err = g.fetch(ctx)
+        } else {
+                select {
+                case result = <-g.prefetch:
+                default:
+                        _, span := tracer().Start(ctx, "segment wait")
+                        select {
+                        case result = <-g.prefetch:
+                        case <-ctx.Done():
+                                span.End()
+                                return ctx.Err()
+                        }
+                        span.End()
+                }
+                g.prefetch = nil
+        }
+        if result.err != nil {
+                g.logger.Error("failed to fetch a segment", "error", result.err)
+                return result.err
+        }
+        g.next, g.end = result.upper - g.segmentSize + 1, result.upper + 1
+        return nil
+}
+
+func (g *SegmentGenerator) fetch(ctx context.Context) (uint64, error) {
+        ctx, span := tracer().Start(ctx, "segment fetch",
+                trace.WithAttributes(attribute.Int64("segment.size", int64(g.segmentSize))))
+        defer span.End()
+        return g.counter.reserve(ctx, g.segmentSize)
+}
+
+// fileCounter keeps the counter in a local file. The file is replaced by rename, so a crash leaves either the
+// old or the new value. It must not be shared by several processes.
+type fileCounter struct {
+        mutex sync.Mutex
+        path  string
+}
+
+// reserve adds n to the counter and returns the new value, the last id of the block.
+func (c *fileCounter) reserve(ctx context.Context, n uint64) (uint64, error) {
+        c.mutex.Lock()
+        defer c.mutex.Unlock()
+        var value uint64
+        data, err := os.ReadFile(c.path)
+        if err == nil {
+                if value, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 63); err != nil {
+                        return 0, fmt.Errorf("counter file %s: %v", c.path, err)
+                }
+        } else if !os.IsNotExist(err) {
+                return 0, err
+        }
+        if value > 1 << 63 - 1 - n {
+                return 0, fmt.Errorf("counter file %s is exhausted", c.path)
+        }
+        value += n
+        if err := writeFileAtomic(c.path, []byte(strconv.FormatUint(value, 10) + "\n")); err != nil {
+                return 0, err
+        }
+        return value, nil
+}
+
+// writeFileAtomic replaces the file at path by data. The data is synced before the rename, so a crash leaves
+// either the old or the new content.
+func writeFileAtomic(path string, data []byte) error {
+        f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path) + ".*")
+        if err != nil {
+                return err
+        }
+        defer os.Remove(f.Name())
+        _, err = f.Write(data)
+        if err == nil {
+                err = f.Sync()
+        }
+        if closeErr := f.Close(); err == nil {
+                err = closeErr
+        }
+        if err == nil {
+                err = os.Rename(f.Name(), path)
+        }
+        return err
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+        "context"
+        "errors"
+        "fmt"
+        "os"
+        "strings"
+        "time"
+)
+
+// Modes of a SequencePolicy, what a SnowFlake does once the sequence of the current tick is used up.
+const (
+        SequenceBlock  = "block"  // sleep until the next tick, the default
+        SequenceFail   = "fail"   // return a *SequenceExhaustedError at once
+        SequenceBorrow = "borrow" // hand out ids of up to MaxBorrow ticks ahead of the clock, then block
+)
+
+// SequencePolicy decides what happens to an id request when the sequence of the current tick is used up.
+//
+// Mode is one of SequenceBlock, SequenceFail or SequenceBorrow, empty means block. MaxWait bounds the sleep of
+// block and borrow, a request which would sleep longer fails with a *SequenceExhaustedError instead. 0 means no
+// limit.
+//
+// MaxBorrow is the number of ticks ahead of the clock borrow may hand out. Borrowed ticks are recorded in
+// StateFile before their ids are handed out, and a SnowFlake started with the same StateFile resumes after
+// them, so a restart cannot hand out the borrowed ids again. StateFile is required if MaxBorrow is set.
+// Borrow works like block as long as MaxBorrow is 0.
+type SequencePolicy struct {
+        Mode      string
+        MaxWait   time.Duration
+        MaxBorrow int
+        StateFile string
+}
+
+// SequenceExhaustedError is returned if the policy forbids waiting for the next tick. RetryAfter is the time
+// until the next tick with free ids starts.
+type SequenceExhaustedError struct {
+        RetryAfter time.Duration
+}
+
+func (e *SequenceExhaustedError) Error() string {
+        return fmt.Sprintf("sequence exhausted, next ids in %s", e.RetryAfter)
+}
+
+func (p SequencePolicy) valid() bool {
+        switch p.Mode {
+        case "", SequenceBlock, SequenceFail, SequenceBorrow:
+        default:
+                return false
+        }
+        return p.MaxWait >= 0 && p.MaxBorrow >= 0 && (p.MaxBorrow == 0 || p.StateFile != "")
+}
+
+// failsAfter tells whether a request which has to sleep for wait fails instead.
+func (p SequencePolicy) failsAfter(wait time.Duration) bool {
+        return wait > 0 && (p.Mode == SequenceFail || p.MaxWait > 0 && wait > p.MaxWait)
+}
+
+type sequencePolicyKey struct{}
+
+// WithSequencePolicy returns a context under which the SnowFlakes follow the Mode and MaxWait of p instead of
+// those of their Settings, e.g. for a single request. A MaxWait longer than the one of the Settings is ignored,
+// and MaxBorrow and StateFile always come from the Settings, so borrow works like block for a SnowFlake which
+// may not borrow.
+func WithSequencePolicy(ctx context.Context, p SequencePolicy) context.Context {
+        return context.WithValue(ctx, sequencePolicyKey{}, p)
+}
+
+// sequencePolicyFrom returns the policy of the settings overridden by the one of the context, if any.
+func sequencePolicyFrom(ctx context.Context, p SequencePolicy) SequencePolicy {
+        override, ok := ctx.Value(sequencePolicyKey{}).(SequencePolicy)
+        if !ok {
+                return p
+        }
+        if override.Mode != "" {
+                p.Mode = override.Mode
+        }
+        if override.MaxWait > 0 && (p.MaxWait == 0 || override.MaxWait < p.MaxWait) {
+                p.MaxWait = override.MaxWait
+        }
+        return p
+}
+
+// SequencePolicyConfig is the JSON form of SequencePolicy. MaxWait is parsed by time.ParseDuration.
+type SequencePolicyConfig struct {
+        Mode      string `json:"mode"`
+        MaxWait   string `json:"max_wait"`
+        MaxBorrow int    `json:"max_borrow"`
+        StateFile string `json:"state_file"`
+}
+
+func (config *SequencePolicyConfig) policy() (SequencePolicy, error) {
+        p := SequencePolicy{Mode: config.Mode, MaxBorrow: config.MaxBorrow, StateFile: config.StateFile}
+        if config.MaxWait != "" {
+                var err error
+                if p.MaxWait, err = time.ParseDuration(config.MaxWait); err != nil {
+                        return p, err
+                }
+        }
+        if !p.valid() {
+                return p, errors.New("invalid sequence policy")
+        }
+        return p, nil
+}
+
+// loadBorrowed returns the last tick borrowed by a previous run, -1 if none was recorded. The state file holds
+// the start time of that tick, so it stays valid if the epoch of the config changes.
+func (sf *SnowFlake) loadBorrowed(path string) (int64, error) {
+        data, err := os.ReadFile(path)
+        if os.IsNotExist(err) {
+                return -1, nil
+        }
+        if err != nil {
+                return 0, err
+        }
+        t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(data)))
+        if err != nil {
+                return 0, fmt.Errorf("state file %s: %v", path, err)
+        }
+        return sf.toSnowFlakeTime(t) - sf.startTime, nil
+}
+
+// borrow records that the ticks up to tick may be handed out ahead of the clock. The state file is only
+// written when the recorded horizon has to grow, and then moves it as far as the policy allows.
+func (sf *SnowFlake) borrow(tick int64, current int64) error {
+        if tick <= sf.borrowedUntil {
+                return nil
+        }
+        horizon := current + int64(sf.policy.MaxBorrow)
+        if horizon < tick {
+                horizon = tick
+        }
+        start := tickTime(time.Unix(0, sf.startTime * sf.timeUnit), time.Duration(sf.timeUnit), uint64(horizon))
+        if err := writeFileAtomic(sf.policy.StateFile, []byte(start.Format(time.RFC3339Nano) + "\n")); err != nil {
+                sf.logger.Error("failed to record borrowed ticks", "state_file", sf.policy.StateFile, "error", err)
+                return err
+        }
+        sf.borrowedUntil = horizon
+        return nil
+}
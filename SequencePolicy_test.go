@@ -0,0 +1,141 @@
+package main
+
+import (
+        "context"
+        "encoding/json"
+        "errors"
+        "net/http"
+        "path/filepath"
+        "testing"
+        "time"
+        "github.com/stretchr/testify/assert"
+)
+
+// hourlySettings gives 4 ids an hour, so a test uses up a tick at once and never sees the next one.
+func hourlySettings(policy SequencePolicy) Settings {
+        return Settings{StartTime: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), TimeUnit: time.Hour, MachineID: mockMachineId,
+                Layout: Layout{BitLenTime: 45, BitLenMachineID: 16, BitLenSequence: 2}, SequencePolicy: policy}
+}
+
+// assertExhausted checks that err asks to retry once the tick ticks ahead has started.
+func assertExhausted(t *testing.T, err error, ticks int, msgAndArgs ...interface{}) {
+        var exhausted *SequenceExhaustedError
+        if assert.True(t, errors.As(err, &exhausted), msgAndArgs...) {
+                assert.True(t, exhausted.RetryAfter > time.Duration(ticks - 1) * time.Hour &&
+                        exhausted.RetryAfter <= time.Duration(ticks) * time.Hour, msgAndArgs...)
+        }
+}
+
+func TestSequenceFail(t *testing.T) {
+        for _, g := range []ContextIDGenerator{NewSnowFlake(hourlySettings(SequencePolicy{Mode: SequenceFail})),
+                NewAtomicSnowFlake(hourlySettings(SequencePolicy{Mode: SequenceFail}))} {
+                ids, err := g.NextIDs(4)
+                assert.Nil(t, err)
+                assert.Equal(t, 4, len(ids))
+                _, err = g.NextID()
+                assertExhausted(t, err, 1)
+                _, _, err = g.NextIDRange(1)
+                assertExhausted(t, err, 1, "the tick stays used up")
+        }
+}
+
+func TestSequenceMaxWait(t *testing.T) {
+        sf := NewSnowFlake(hourlySettings(SequencePolicy{MaxWait: time.Millisecond}))
+        _, err := sf.NextIDs(4)
+        assert.Nil(t, err)
+        _, err = sf.NextID()
+        assertExhausted(t, err, 1, "the next tick is more than a msec away")
+}
+
+func TestSequencePolicyOfContext(t *testing.T) {
+        ctx := WithSequencePolicy(context.Background(), SequencePolicy{Mode: SequenceFail})
+        for _, g := range []ContextIDGenerator{NewSnowFlake(hourlySettings(SequencePolicy{})),
+                NewAtomicSnowFlake(hourlySettings(SequencePolicy{}))} {
+                _, err := g.NextIDs(4)
+                assert.Nil(t, err)
+                _, err = g.NextIDContext(ctx)
+                assertExhausted(t, err, 1)
+        }
+
+        p := sequencePolicyFrom(WithSequencePolicy(context.Background(), SequencePolicy{MaxWait: time.Second}),
+                SequencePolicy{Mode: SequenceBorrow, MaxWait: time.Millisecond, MaxBorrow: 2, StateFile: "borrowed"})
+        assert.Equal(t, SequencePolicy{Mode: SequenceBorrow, MaxWait: time.Millisecond, MaxBorrow: 2, StateFile: "borrowed"}, p,
+                "a request can only shorten the wait")
+}
+
+func TestSequenceBorrow(t *testing.T) {
+        stateFile := filepath.Join(t.TempDir(), "borrowed")
+        sf := NewSnowFlake(hourlySettings(SequencePolicy{Mode: SequenceBorrow, MaxBorrow: 2, StateFile: stateFile}))
+        current := sf.currentElapsedTime()
+        start := time.Now()
+        ids, err := sf.NextIDs(12)
+        assert.Nil(t, err)
+        assert.True(t, time.Since(start) < time.Second, "borrowed ticks are handed out without waiting")
+        assert.Equal(t, uint64(current + 2), sf.layout.Decompose(ids[11])["time"])
+        _, err = sf.NextIDContext(WithSequencePolicy(context.Background(), SequencePolicy{Mode: SequenceFail}))
+        assertExhausted(t, err, 3, "all ticks which may be borrowed are used up")
+
+        // a restart resumes after the borrowed ticks
+        restarted := NewSnowFlake(hourlySettings(SequencePolicy{Mode: SequenceBorrow, MaxBorrow: 3, StateFile: stateFile}))
+        id, err := restarted.NextID()
+        assert.Nil(t, err)
+        assert.True(t, id > ids[11])
+        assert.Equal(t, uint64(current + 3), restarted.layout.Decompose(id)["time"])
+
+        blocking := NewSnowFlake(hourlySettings(SequencePolicy{StateFile: stateFile}))
+        _, err = blocking.NextIDContext(WithSequencePolicy(context.Background(), SequencePolicy{Mode: SequenceFail}))
+        assertExhausted(t, err, 4, "the ticks borrowed by both runs are not handed out again")
+
+        assert.Nil(t, NewSnowFlake(hourlySettings(SequencePolicy{Mode: SequenceBorrow, MaxBorrow: 2})), "borrowing needs a state file")
+        assert.Nil(t, NewAtomicSnowFlake(hourlySettings(SequencePolicy{Mode: SequenceBorrow, MaxBorrow: 2, StateFile: stateFile})))
+        assert.Nil(t, NewSnowFlake(hourlySettings(SequencePolicy{Mode: "later"})))
+}
+
+func TestSequencePolicyEndpoints(t *testing.T) {
+        config, err := parseServiceConfig([]byte(`{"namespaces": [
+                {"name": "hourly-fail", "start_time": "2020-01-01T00:00:00Z", "time_unit": "1h",
+                 "layout": {"bit_len_time": 45, "bit_len_machine_id": 16, "bit_len_sequence": 2},
+                 "sequence_policy": {"mode": "fail"}},
+                {"name": "hourly-block", "start_time": "2020-01-01T00:00:00Z", "time_unit": "1h",
+                 "layout": {"bit_len_time": 45, "bit_len_machine_id": 16, "bit_len_sequence": 2}}]}`))
+        assert.Nil(t, err)
+        err = setupNamespaces(&Settings{StartTime: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC), MachineID: mockMachineId}, config)
+        assert.Nil(t, err)
+        router := newRouter(config)
+
+        for _, path := range []string{"/ns/hourly-fail/longidrange", "/ns/hourly-block/longidrange"} {
+                assert.Equal(t, http.StatusOK, serve(router, path).Code)
+        }
+        for _, path := range []string{"/ns/hourly-fail/longid", "/ns/hourly-block/longids?on_exhausted=fail",
+                "/ns/hourly-block/longid?max_wait=5ms"} {
+                w := serve(router, path)
+                assert.Equal(t, http.StatusServiceUnavailable, w.Code, path)
+                assert.NotEmpty(t, w.Header().Get("Retry-After"), path)
+                resp := &ErrorResponse{}
+                json.Unmarshal(w.Body.Bytes(), resp)
+                assert.Equal(t, errorCodeSequenceExhausted, resp.Code, path)
+                assert.True(t, resp.RetryAfterMs > 0 && resp.RetryAfterMs <= 3600000, path)
+        }
+        for _, path := range []string{"/longid?on_exhausted=later", "/longid?max_wait=soon", "/longids?max_wait=-1s"} {
+                assert.Equal(t, http.StatusBadRequest, serve(router, path).Code, path)
+        }
+
+        for _, body := range []string{
+                `{"namespaces": [{"name": "a", "strategy": "random", "sequence_policy": {"mode": "fail"}}]}`,
+        } {
+                _, err := parseServiceConfig([]byte(body))
+                assert.NotNil(t, err, body)
+        }
+        for _, policy := range []string{`{"mode": "borrow", "max_borrow": 10}`, `{"mode": "later"}`, `{"max_wait": "soon"}`} {
+                _, err := NamespaceConfig{Name: "a", SequencePolicy: &SequencePolicyConfig{}}.settings()
+                assert.Nil(t, err)
+                nc := NamespaceConfig{Name: "a"}
+                json.Unmarshal([]byte(`{"sequence_policy": ` + policy + `}`), &nc)
+                _, err = nc.settings()
+                assert.NotNil(t, err, policy)
+        }
+        nc := NamespaceConfig{Name: "a", LockFree: true, SequencePolicy: &SequencePolicyConfig{Mode: "borrow", MaxBorrow: 10,
+                StateFile: "borrowed"}}
+        _, err = nc.settings()
+        assert.NotNil(t, err, "lock free namespaces cannot borrow")
+}
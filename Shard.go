@@ -0,0 +1,273 @@
+package main
+
+import (
+        "errors"
+        "hash/fnv"
+        "net/http"
+        "sort"
+        "strconv"
+        "sync"
+        "time"
+        "gopkg.in/gin-gonic/gin.v1"
+)
+
+// ShardKey mixes the bits of an id so that every bit of the key depends on every bit of the id. The ids of a tick
+// or of a quiet pod differ in a few low or high bits only, their keys are spread uniformly, so key % shards picks
+// the shards evenly. The mix is the finalizer of splitmix64, a bijection: distinct ids have distinct keys.
+func ShardKey(id uint64) uint64 {
+        id ^= id >> 30
+        id *= 0xbf58476d1ce4e5b9
+        id ^= id >> 27
+        id *= 0x94d049bb133111eb
+        id ^= id >> 31
+        return id
+}
+
+// Methods of /shard to map an id to one of n shards numbered from 0.
+const (
+        ShardMethodJump   = "jump"   // JumpShard, the default
+        ShardMethodRing   = "ring"   // a HashRing of the shards named "0" to "n-1"
+        ShardMethodModulo = "modulo" // ShardKey(id) % n
+)
+
+// JumpShard returns the shard of an id among shards numbered 0 to shards-1, by the jump consistent hash of
+// Lamping and Veach applied to the ShardKey of the id. Going from n to n+1 shards moves 1/(n+1) of the ids, all
+// of them to the new shard, so shards can only be added or removed at the end. It needs no memory, unlike a
+// HashRing. If shards is not positive -1 is returned.
+func JumpShard(id uint64, shards int) int {
+        key := ShardKey(id)
+        b, j := int64(-1), int64(0)
+        for j < int64(shards) {
+                b = j
+                key = key * 2862933555777941757 + 1
+                j = int64(float64(b + 1) * (float64(int64(1) << 31) / float64(key >> 33 + 1)))
+        }
+        return int(b)
+}
+
+// defaultRingReplicas is the number of points of every shard on a HashRing, enough to keep the shards within a
+// few percent of their fair share.
+const defaultRingReplicas = 160
+
+// HashRing maps ids to named shards by consistent hashing. Every shard owns replicas points on a ring of 64-bit
+// keys, the point i of shard s is the ShardKey of the FNV-1a hash of "s#i", and an id belongs to the shard of
+// the first point at or after the ShardKey of the id. Adding or removing a shard only moves the ids next to its
+// points.
+type HashRing struct {
+        points []uint64 // sorted
+        shards []string // shard of the point with the same index
+}
+
+// NewHashRing returns the ring of the shards with replicas points each, 0 means 160.
+func NewHashRing(shards []string, replicas int) *HashRing {
+        if replicas <= 0 {
+                replicas = defaultRingReplicas
+        }
+        type point struct {
+                key   uint64
+                shard string
+        }
+        points := make([]point, 0, len(shards) * replicas)
+        for _, shard := range shards {
+                for i := 0; i < replicas; i++ {
+                        h := fnv.New64a()
+                        h.Write([]byte(shard + "#" + strconv.Itoa(i)))
+                        points = append(points, point{ShardKey(h.Sum64()), shard})
+                }
+        }
+        sort.Slice(points, func(i, j int) bool {
+                if points[i].key != points[j].key {
+                        return points[i].key < points[j].key
+                }
+                return points[i].shard < points[j].shard
+        })
+        r := &HashRing{points: make([]uint64, len(points)), shards: make([]string, len(points))}
+        for i, p := range points {
+                r.points[i], r.shards[i] = p.key, p.shard
+        }
+        return r
+}
+
+// Shard returns the shard of an id, "" if the ring has no shards.
+func (r *HashRing) Shard(id uint64) string {
+        if len(r.points) == 0 {
+                return ""
+        }
+        key := ShardKey(id)
+        i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= key })
+        if i == len(r.points) {
+                i = 0
+        }
+        return r.shards[i]
+}
+
+// Periods of the time buckets of ids, e.g. monthly partitions.
+const (
+        PeriodHour  = "hour"
+        PeriodDay   = "day"
+        PeriodMonth = "month"
+        PeriodYear  = "year"
+)
+
+var periodLabels = map[string]string{PeriodHour: "2006-01-02T15", PeriodDay: "2006-01-02", PeriodMonth: "2006-01",
+        PeriodYear: "2006"}
+
+// TimeBucket returns the start, in UTC, of the period an id was issued in, e.g. the first of the month for monthly
+// partitions. Ids increase with time, so the ids of a bucket are a range and a query for a time window only
+// touches its buckets.
+func (d *Descriptor) TimeBucket(id uint64, period string) (time.Time, error) {
+        t := d.Time(id)
+        switch period {
+        case PeriodHour:
+                return t.Truncate(time.Hour), nil
+        case PeriodDay:
+                return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+        case PeriodMonth:
+                return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC), nil
+        case PeriodYear:
+                return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC), nil
+        }
+        return time.Time{}, errors.New("unknown period " + period)
+}
+
+// BucketLabel names the bucket of a period starting at start, like 2024, 2024-03, 2024-03-15 or 2024-03-15T07.
+func BucketLabel(start time.Time, period string) string {
+        return start.UTC().Format(periodLabels[period])
+}
+
+// ShardResponse is the response of /shard. Bucket and BucketStart are only set if a period was asked for.
+type ShardResponse struct {
+        ID          uint64     `json:"id"`
+        Shards      int        `json:"shards"`
+        Method      string     `json:"method"`
+        Shard       int        `json:"shard"`
+        Bucket      string     `json:"bucket,omitempty"`
+        BucketStart *time.Time `json:"bucket_start,omitempty"`
+}
+
+// maxShards bounds the shards param of /shard, maxRingShards the one of the ring method, whose ring of
+// maxRingShards shards holds 163840 points.
+const (
+        maxShards     = 4096
+        maxRingShards = 1024
+)
+
+// numberedRings caches the rings of the shards named "0" to "n-1" used by /shard, the ringCacheSize most recently
+// used ones, so that callers with a few shard counts do not rebuild a ring per request.
+var numberedRings = struct {
+        sync.Mutex
+        recent []*numberedRing // most recently used first
+}{}
+
+const ringCacheSize = 8
+
+// ringShardsPerID prices building a ring for /shard: a lookup is charged to the quota as one id, building a ring
+// which is not cached as one more id per ringShardsPerID shards, so cycling through shard counts costs quota.
+const ringShardsPerID = 16
+
+type numberedRing struct {
+        n    int
+        ring *HashRing
+}
+
+// numberedRingCached reports whether the ring of n shards is cached.
+func numberedRingCached(n int) bool {
+        numberedRings.Lock()
+        defer numberedRings.Unlock()
+        for _, r := range numberedRings.recent {
+                if r.n == n {
+                        return true
+                }
+        }
+        return false
+}
+
+func numberedHashRing(n int) *HashRing {
+        numberedRings.Lock()
+        for i, r := range numberedRings.recent {
+                if r.n == n {
+                        copy(numberedRings.recent[1:i + 1], numberedRings.recent[:i])
+                        numberedRings.recent[0] = r
+                        numberedRings.Unlock()
+                        return r.ring
+                }
+        }
+        numberedRings.Unlock()
+        names := make([]string, n)
+        for i := range names {
+                names[i] = strconv.Itoa(i)
+        }
+        ring := NewHashRing(names, 0)
+        numberedRings.Lock()
+        defer numberedRings.Unlock()
+        numberedRings.recent = append([]*numberedRing{{n, ring}}, numberedRings.recent...)
+        if len(numberedRings.recent) > ringCacheSize {
+                numberedRings.recent = numberedRings.recent[:ringCacheSize]
+        }
+        return ring
+}
+
+func shardHandler(c *gin.Context) {
+        format, ok := requestIDFormat(c)
+        if !ok {
+                return
+        }
+        id, err := Decode(c.Query("id"), format)
+        if err != nil {
+                badRequest(c, errorCodeInvalidParam, "id", "id has to be a " + format + " id")
+                return
+        }
+        shards, ok := intQuery(c, "shards", 0, 1, maxShards)
+        if !ok {
+                return
+        }
+        resp := &ShardResponse{ID: id, Shards: shards, Method: c.DefaultQuery("method", ShardMethodJump)}
+        cost := 1
+        switch resp.Method {
+        case ShardMethodJump, ShardMethodModulo:
+        case ShardMethodRing:
+                if shards > maxRingShards {
+                        badRequest(c, errorCodeParamOutOfRange, "shards", "shards has to be at most " +
+                                strconv.Itoa(maxRingShards) + " for the ring method")
+                        return
+                }
+                if !numberedRingCached(shards) {
+                        cost += shards / ringShardsPerID
+                }
+        default:
+                badRequest(c, errorCodeInvalidParam, "method", "method has to be one of jump, ring or modulo")
+                return
+        }
+        var d *Descriptor
+        period := c.Query("period")
+        if period != "" {
+                if _, ok := periodLabels[period]; !ok {
+                        badRequest(c, errorCodeInvalidParam, "period", "period has to be one of hour, day, month or year")
+                        return
+                }
+                ns := requestNamespace(c)
+                if ns == nil {
+                        return
+                }
+                if d = ns.generator.Describe().SnowFlake; d == nil {
+                        badRequest(c, errorCodeInvalidParam, "period", "ids of namespace " + ns.Name + " carry no time")
+                        return
+                }
+        }
+        if !chargeQuota(c, cost) {
+                return
+        }
+        switch resp.Method {
+        case ShardMethodJump:
+                resp.Shard = JumpShard(id, shards)
+        case ShardMethodRing:
+                resp.Shard, _ = strconv.Atoi(numberedHashRing(shards).Shard(id))
+        case ShardMethodModulo:
+                resp.Shard = int(ShardKey(id) % uint64(shards))
+        }
+        if d != nil {
+                start, _ := d.TimeBucket(id, period)
+                resp.Bucket, resp.BucketStart = BucketLabel(start, period), &start
+        }
+        writeJSON(c, http.StatusOK, resp)
+}
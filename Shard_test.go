@@ -0,0 +1,145 @@
+package main
+
+import (
+        "encoding/json"
+        "net/http"
+        "strconv"
+        "testing"
+        "time"
+        "github.com/stretchr/testify/assert"
+)
+
+func TestShardKeyUniform(t *testing.T) {
+        layout := DefaultLayout
+        const shards = 16
+        // a busy pod: every sequence number of 64 ticks, a quiet pod: the first id of 4096 ticks
+        busy, quiet := make([]int, shards), make([]int, shards)
+        for tick := int64(0); tick < 64; tick++ {
+                for seq := 0; seq < 256; seq++ {
+                        id, _ := layout.toID(tick, 321, uint16(seq))
+                        busy[ShardKey(id) % shards]++
+                }
+        }
+        for tick := int64(0); tick < 4096; tick++ {
+                id, _ := layout.toID(tick, 321, 0)
+                quiet[ShardKey(id) % shards]++
+        }
+        for shard := 0; shard < shards; shard++ {
+                assert.InDelta(t, 1024, busy[shard], 150, "busy shard %d", shard)
+                assert.InDelta(t, 256, quiet[shard], 60, "quiet shard %d", shard)
+        }
+        assert.NotEqual(t, ShardKey(1), ShardKey(2))
+        assert.Equal(t, uint64(0), ShardKey(0))
+}
+
+func TestJumpShard(t *testing.T) {
+        counts := make([]int, 10)
+        for id := uint64(0); id < 100000; id++ {
+                shard := JumpShard(id << 8, 10)
+                counts[shard]++
+                if grown := JumpShard(id << 8, 11); grown != shard {
+                        assert.Equal(t, 10, grown, "ids only move to the new shard")
+                }
+        }
+        for shard, count := range counts {
+                assert.InDelta(t, 10000, count, 500, "shard %d", shard)
+        }
+        assert.Equal(t, 0, JumpShard(12345, 1))
+        assert.Equal(t, -1, JumpShard(12345, 0))
+}
+
+func TestHashRing(t *testing.T) {
+        ring := NewHashRing([]string{"a", "b", "c"}, 0)
+        grown := NewHashRing([]string{"a", "b", "c", "d"}, 0)
+        shrunk := NewHashRing([]string{"a", "c"}, 0)
+        counts := map[string]int{}
+        for id := uint64(0); id < 30000; id++ {
+                shard := ring.Shard(id)
+                counts[shard]++
+                if moved := grown.Shard(id); moved != shard {
+                        assert.Equal(t, "d", moved, "ids only move to the new shard")
+                }
+                if moved := shrunk.Shard(id); shard != "b" {
+                        assert.Equal(t, shard, moved, "only the ids of the removed shard move")
+                }
+        }
+        for _, shard := range []string{"a", "b", "c"} {
+                assert.InDelta(t, 10000, counts[shard], 1500, shard)
+        }
+        assert.Equal(t, "", NewHashRing(nil, 0).Shard(1))
+
+        four, eight := numberedHashRing(4), numberedHashRing(8)
+        assert.True(t, four == numberedHashRing(4) && eight == numberedHashRing(8), "alternating shard counts reuse their rings")
+        for n := 9; n < 9 + ringCacheSize; n++ {
+                numberedHashRing(n)
+        }
+        assert.True(t, four != numberedHashRing(4), "the least recently used rings are dropped")
+}
+
+func TestTimeBucket(t *testing.T) {
+        d := &Descriptor{Layout: DefaultLayout, StartTime: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC), TimeUnit: 10 * time.Millisecond}
+        issued := time.Date(2024, 3, 15, 7, 30, 12, 0, time.UTC)
+        id, _ := d.Layout.toID(int64(issued.Sub(d.StartTime) / d.TimeUnit), 321, 17)
+        for period, want := range map[string]string{PeriodHour: "2024-03-15T07", PeriodDay: "2024-03-15",
+                PeriodMonth: "2024-03", PeriodYear: "2024"} {
+                start, err := d.TimeBucket(id, period)
+                assert.Nil(t, err)
+                assert.Equal(t, want, BucketLabel(start, period))
+                assert.False(t, start.After(issued), period)
+        }
+        start, _ := d.TimeBucket(id, PeriodMonth)
+        assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), start)
+        _, err := d.TimeBucket(id, "week")
+        assert.NotNil(t, err)
+}
+
+func TestShardEndpoint(t *testing.T) {
+        router := getTestRouter(t)
+        registerNamespace(NewGeneratorNamespace("shard-random", NewRandomGenerator(0)))
+        id := uint64(0x0bc48a1b2c000141)
+        d := &Descriptor{}
+        if ns, ok := lookupNamespace(defaultNamespaceName); ok {
+                d = ns.generator.Describe().SnowFlake
+        }
+        bucket, _ := d.TimeBucket(id, PeriodMonth)
+        for path, want := range map[string]ShardResponse{
+                "/shard?id=847954479159443777&shards=16": {ID: id, Shards: 16, Method: "jump", Shard: JumpShard(id, 16)},
+                "/shard?id=0bc48a1b2c000141&format=hex&shards=16&method=ring": {ID: id, Shards: 16, Method: "ring",
+                        Shard: func() int { s, _ := strconv.Atoi(numberedHashRing(16).Shard(id)); return s }()},
+                "/shard?id=847954479159443777&shards=7&method=modulo": {ID: id, Shards: 7, Method: "modulo", Shard: int(ShardKey(id) % 7)},
+                "/shard?id=847954479159443777&shards=16&period=month": {ID: id, Shards: 16, Method: "jump", Shard: JumpShard(id, 16),
+                        Bucket: BucketLabel(bucket, PeriodMonth), BucketStart: &bucket},
+        } {
+                w := serve(router, path)
+                assert.Equal(t, http.StatusOK, w.Code, path)
+                resp := ShardResponse{}
+                json.Unmarshal(w.Body.Bytes(), &resp)
+                if want.BucketStart != nil && assert.NotNil(t, resp.BucketStart, path) {
+                        assert.True(t, want.BucketStart.Equal(*resp.BucketStart), path)
+                        want.BucketStart, resp.BucketStart = nil, nil
+                }
+                assert.Equal(t, want, resp, path)
+        }
+        for _, path := range []string{"/shard?id=847954479159443777", "/shard?id=x&shards=4", "/shard?id=1&shards=4&method=rendezvous",
+                "/shard?id=1&shards=1025&method=ring",
+                "/shard?id=1&shards=4&period=week", "/ns/shard-random/shard?id=1&shards=4&period=day"} {
+                assert.Equal(t, http.StatusBadRequest, serve(router, path).Code, path)
+        }
+        assert.Equal(t, http.StatusNotFound, serve(router, "/ns/nope/shard?id=1&shards=4&period=day").Code)
+}
+
+func TestShardQuota(t *testing.T) {
+        router := getAuthRouter(t, []APIKey{{Key: "secret", Client: "billing", PerDay: 1000}})
+        res := serveWithHeader(router, "/shard?id=1&shards=4", "X-API-Key", "secret")
+        assert.Equal(t, http.StatusOK, res.StatusCode, "lookup should pass")
+        assert.Equal(t, "999", res.Header.Get("X-RateLimit-Remaining-Day"), "a lookup should be charged as one id")
+
+        numberedHashRing(32)
+        res = serveWithHeader(router, "/shard?id=1&shards=32&method=ring", "X-API-Key", "secret")
+        assert.Equal(t, "998", res.Header.Get("X-RateLimit-Remaining-Day"), "a cached ring should be charged as a lookup")
+        res = serveWithHeader(router, "/shard?id=1&shards=1000&method=ring", "X-API-Key", "secret")
+        assert.Equal(t, http.StatusOK, res.StatusCode, "ring lookup should pass")
+        assert.Equal(t, "935", res.Header.Get("X-RateLimit-Remaining-Day"), "building a ring should be charged per shard")
+        res = serveWithHeader(router, "/shard?id=1&shards=4&method=rendezvous", "X-API-Key", "secret")
+        assert.Equal(t, "", res.Header.Get("X-RateLimit-Remaining-Day"), "invalid requests should not be charged")
+}
@@ -1,13 +1,16 @@
 package main
 import (
+        "context"
         "errors"
-        "net"
+        "math/rand/v2"
+        "sort"
         "sync"
         "time"
-        "io/ioutil"
-        "net/http"
-        "os"
-        "log"
+        "log/slog"
+        "go.opentelemetry.io/otel/attribute"
+        "go.opentelemetry.io/otel/trace"
+        "github.com/spinaki/distributed-unique-id/client"
+        "github.com/spinaki/distributed-unique-id/internal/machineid"
 )
 // These constants are the bit lengths of SnowFlake ID parts.
 const (
@@ -30,122 +33,363 @@ const (
 // CheckMachineID validates the uniqueness of the machine ID.
 // If CheckMachineID returns false, SnowFlake is not created.
 // If CheckMachineID is nil, no validation is done.
+//
+// Layout splits the 63 usable bits of an ID between time, machine id and sequence.
+// If Layout is the zero value, DefaultLayout is used. If Layout is invalid, SnowFlake is not created.
+// If the machine ID does not fit into the machine id part, SnowFlake is not created: cutting it to the lower bits
+// would give machines whose ips differ only in the upper bits the same ids. Layouts with fewer than 16 machine id
+// bits need a MachineID unless the private ips of all machines differ in those bits.
+//
+// TimeUnit is the length of one tick of the SnowFlake time. If TimeUnit is 0, 10 msec is used.
+//
+// Logger receives the warnings of the SnowFlake. If Logger is nil, slog.Default() is used.
+//
+// SequencePolicy decides what happens once the sequence of a tick is used up, see SequencePolicy.
+// If SequencePolicy is invalid or its StateFile cannot be read, SnowFlake is not created.
+//
+// RandomSequenceStart starts the sequence of every tick at a random number instead of 0, so the ids of a quiet
+// SnowFlake do not all end in 0. The ids still increase, but a tick holds fewer of them: a request for n ids
+// starts at most n-1 before the end of the tick, ranges of a whole tick start at 0.
+//
+// SequenceMultiplier, if not 0, scrambles the sequence part of the ids: it is the sequence number times
+// SequenceMultiplier modulo the ids of a tick. The multiplier has to be odd, so the ids stay unique within the
+// tick. The ids of a tick are no longer handed out in increasing order, NextIDs sorts every tick of its list and
+// NextIDRange only takes 1 or all ids of a tick. If SequenceMultiplier is even, SnowFlake is not created.
 type Settings struct {
         StartTime      time.Time
         MachineID      func() (uint16, error)
         CheckMachineID func(uint16) bool
+        Layout         Layout
+        TimeUnit       time.Duration
+        Logger         *slog.Logger
+        SequencePolicy SequencePolicy
+
+        RandomSequenceStart bool
+        SequenceMultiplier  uint16
+}
+
+// Layout is the bit length of each SnowFlake ID part, from MSB to LSB: Time-MachineID-Sequence.
+// The three parts have to add up to 63 bits so that the msb is always 0.
+type Layout struct {
+        BitLenTime      uint8 `json:"bit_len_time"`
+        BitLenMachineID uint8 `json:"bit_len_machine_id"`
+        BitLenSequence  uint8 `json:"bit_len_sequence"`
 }
 
+// DefaultLayout is the 39-16-8 layout described in the README.
+var DefaultLayout = Layout{BitLenTime: BitLenTime, BitLenMachineID: BitLenMachineID, BitLenSequence: BitLenSequence}
+
 // SnowFlake is a distributed unique ID generator.
 type SnowFlake struct {
-        mutex      *sync.Mutex
-        startTime  int64
-        recentTime int64 // most recent time when this snowflake was used
-        sequence   uint16
-        machineID  uint16
+        mutex           *sync.Mutex
+        startTime       int64
+        recentTime      int64 // most recent time when this snowflake was used
+        sequence        uint16
+        machineID       uint16
+        machineIDSource string // one of the MachineIDFrom constants
+        layout          Layout
+        timeUnit        int64 // length of a tick in nsec
+        logger          *slog.Logger
+        policy          SequencePolicy
+        borrowedUntil   int64 // last tick recorded in the state file of the policy
+        randomStart     bool
+        multiplier      uint16 // 0 keeps the sequence numbers
 }
 
+// Sources of the machine id reported by Describe.
+const (
+        MachineIDFromPodIP     = machineid.FromPodIP     // the UNIQUE_ID_POD_IP env variable
+        MachineIDFromEC2       = machineid.FromEC2       // the private ip of the EC2 instance metadata
+        MachineIDFromInterface = machineid.FromInterface // the private ip of a network interface
+        MachineIDFromSettings  = "settings"              // Settings.MachineID
+)
+
 // NewSnowFlake returns a new SnowFlake configured with the given Settings.
 // NewSnowFlake returns nil in the following cases:
 // - Settings.StartTime is ahead of the current time.
-// - Settings.MachineID returns an error.
+// - Settings.MachineID returns an error or a machine ID which does not fit into the layout.
 // - Settings.CheckMachineID returns false.
+// - Settings.Layout or Settings.TimeUnit is invalid.
+// - Settings.SequencePolicy is invalid or its state file cannot be read.
+// - Settings.SequenceMultiplier is even.
 func NewSnowFlake(st Settings) *SnowFlake {
         sf := new(SnowFlake)
         sf.mutex = new(sync.Mutex)
+        sf.layout = st.Layout
+        if sf.layout == (Layout{}) {
+                sf.layout = DefaultLayout
+        }
+        if !sf.layout.valid() {
+                return nil
+        }
+        sf.timeUnit = int64(st.TimeUnit)
+        if sf.timeUnit == 0 {
+                sf.timeUnit = snowFlakeTimeUnitScaleFactor
+        }
+        if sf.timeUnit < 0 {
+                return nil
+        }
+        if st.SequenceMultiplier != 0 && st.SequenceMultiplier % 2 == 0 {
+                return nil
+        }
+        sf.randomStart, sf.multiplier = st.RandomSequenceStart, st.SequenceMultiplier
         // why is it set to max value ?
-        sf.sequence = uint16( 1 << BitLenSequence - 1)
+        sf.sequence = sf.layout.maxSequence()
         if st.StartTime.After(time.Now()) {
                 return nil
         }
         if st.StartTime.IsZero() {
-                sf.startTime = toSnowFlakeTime(time.Date(2014, 9, 1, 0, 0, 0, 0, time.UTC))
+                sf.startTime = sf.toSnowFlakeTime(time.Date(2014, 9, 1, 0, 0, 0, 0, time.UTC))
         } else {
-                sf.startTime = toSnowFlakeTime(st.StartTime)
+                sf.startTime = sf.toSnowFlakeTime(st.StartTime)
         }
 
         var err error
         if st.MachineID == nil {
-                sf.machineID, err = lower16BitPrivateIP()
+                sf.machineID, sf.machineIDSource, err = privateIPMachineID()
         } else {
                 sf.machineID, err = st.MachineID()
+                sf.machineIDSource = MachineIDFromSettings
+        }
+        sf.logger = st.Logger
+        if sf.logger == nil {
+                sf.logger = slog.Default()
+        }
+        sf.logger = sf.logger.With("machine_id", sf.machineID)
+        if err == nil && sf.machineID > sf.layout.maxMachineID() {
+                sf.logger.Error("machine id does not fit into the layout, set a machine id for narrow layouts",
+                        "machine_id_source", sf.machineIDSource, "bit_len_machine_id", sf.layout.BitLenMachineID)
+                return nil
         }
         if err != nil || (st.CheckMachineID != nil && !st.CheckMachineID(sf.machineID)) {
                 return nil
         }
 
+        if !st.SequencePolicy.valid() {
+                return nil
+        }
+        sf.policy = st.SequencePolicy
+        if sf.policy.StateFile != "" {
+                if sf.borrowedUntil, err = sf.loadBorrowed(sf.policy.StateFile); err != nil {
+                        sf.logger.Error("failed to read borrowed ticks", "state_file", sf.policy.StateFile, "error", err)
+                        return nil
+                }
+                if sf.borrowedUntil >= sf.currentElapsedTime() {
+                        // a previous run handed out ids ahead of the clock, continue after them
+                        sf.recentTime = sf.borrowedUntil
+                }
+        }
+
         return sf
 }
 
 // elapsedTime, machine-id and sequence
-func (sf *SnowFlake) NextIDs() ([]uint64, error) {
-        sf.mutex.Lock()
+// NextIDs returns n ids in increasing order. Up to a tick of ids are consecutive, n of a tick or more start
+// on a tick none of whose ids have been handed out, so repeated calls never overlap.
+func (sf *SnowFlake) NextIDs(n int) ([]uint64, error) {
+        return sf.NextIDsContext(context.Background(), n)
+}
+
+// NextIDsContext is NextIDs with the waits for the lock and the next tick traced as children of ctx.
+func (sf *SnowFlake) NextIDsContext(ctx context.Context, n int) ([]uint64, error) {
+        if err := checkCount(n, 0); err != nil {
+                return nil, err
+        }
+        sf.lock(ctx)
         defer sf.mutex.Unlock()
-        //sf.elapsedTime = currentElapsedTime(sf.startTime)
-        sf.validateTime()
-        sf.sequence = 0
-        const maxSequence = uint16(1 << BitLenSequence - 1)
-        idList := make([]uint64, 0, maxSequence + 1)
-        for; sf.sequence <= maxSequence; {
-                id, err := sf.toID()
+        tickSize := int(sf.layout.maxSequence()) + 1
+        idList := make([]uint64, 0, n)
+        for len(idList) < n {
+                chunk := n - len(idList)
+                if chunk > tickSize {
+                        chunk = tickSize
+                }
+                first, err := sf.claim(ctx, chunk)
                 if err != nil {
                         return nil, err
                 }
-                idList = append(idList, id)
-                sf.sequence = (sf.sequence + 1)
+                tickStart := len(idList)
+                for seq := int(first); seq < int(first) + chunk; seq++ {
+                        id, err := sf.layout.toID(sf.recentTime, sf.machineID, sf.scramble(uint16(seq)))
+                        if err != nil {
+                                return nil, err
+                        }
+                        idList = append(idList, id)
+                }
+                if sf.multiplier != 0 {
+                        tick := idList[tickStart:]
+                        sort.Slice(tick, func(i, j int) bool { return tick[i] < tick[j] })
+                }
         }
         return idList, nil
 }
 
 // NextID generates a next unique ID.
 // After the SnowFlake time overflows, NextID returns an error.
-// ONLY USED in Testing ??
 func (sf *SnowFlake) NextID() (uint64, error) {
-        sf.mutex.Lock()
+        return sf.NextIDContext(context.Background())
+}
+
+// NextIDContext is NextID with the waits for the lock and the next tick traced as children of ctx.
+func (sf *SnowFlake) NextIDContext(ctx context.Context) (uint64, error) {
+        sf.lock(ctx)
         defer sf.mutex.Unlock()
-        sf.validateTime()
+        if err := sf.validateTime(ctx, 1); err != nil {
+                return 0, err
+        }
         return sf.toID()
 }
 
+// Describe returns the strategy, layout, epoch and time unit of the ids.
+func (sf *SnowFlake) Describe() Description {
+        return Description{
+                Strategy:        StrategySnowFlake,
+                RangeSize:       int(sf.layout.maxSequence()) + 1,
+                MachineID:       sf.machineID,
+                MachineIDSource: sf.machineIDSource,
+                SnowFlake:       &Descriptor{Layout: sf.layout, StartTime: time.Unix(0, sf.startTime * sf.timeUnit).UTC(),
+                        TimeUnit: time.Duration(sf.timeUnit), MaxBorrow: sf.maxBorrow()},
+        }
+}
+
+// maxBorrow is the number of ticks ahead of the clock the policy lets the SnowFlake hand out.
+func (sf *SnowFlake) maxBorrow() int {
+        if sf.policy.Mode != SequenceBorrow {
+                return 0
+        }
+        return sf.policy.MaxBorrow
+}
+
+// MachineID returns the machine id part of the ids.
+func (sf *SnowFlake) MachineID() uint16 {
+        return sf.machineID
+}
+
+// Layout returns the bit layout of the ids.
+func (sf *SnowFlake) Layout() Layout {
+        return sf.layout
+}
+
+// lock acquires the mutex inside a span, contention shows up as a long "snowflake lock" span.
+func (sf *SnowFlake) lock(ctx context.Context) {
+        _, span := tracer().Start(ctx, "snowflake lock")
+        sf.mutex.Lock()
+        span.End()
+}
+
 // checks if the current time (time elapsed since the start of this snowflake instances start) is less than the most recent
 // snowflake time. If the recentTime is less than the current time -- meaning the id has not been generated in a while --
 // update the recent time to current time and set the sequence to 0. The sequence is set to zero since new ids will be generated in this time.
 // if recentTime time is equal to or greater than current time -- find the number of ids that have already been generated by updating the sequence.
-// if the ids is 0 -- meaning all ids at the current time has been generated -- sleep for the time until the next time slot is available
-func (sf *SnowFlake) validateTime() {
-        current := currentElapsedTime(sf.startTime)
+// if the ids is 0 -- meaning all ids at the current time has been generated -- the sequence policy decides: sleep for the time
+// until the next time slot is available, fail, or move on to a tick ahead of the clock which is recorded as borrowed.
+// if the clock moved backwards behind the borrowed ticks no id can be handed out safely and an error is returned.
+// n is the number of ids the caller needs, a new tick starts early enough to hold them.
+func (sf *SnowFlake) validateTime(ctx context.Context, n int) error {
+        current := sf.currentElapsedTime()
         if sf.recentTime < current {
                 // this is only executed the first time
                 // this will be executed if the elapsedTime is not set correctly to current time
                 sf.recentTime = current
-                sf.sequence = 0
-        } else if (sf.recentTime == current) {
-                const maskSequence = uint16(1 << BitLenSequence - 1)
-                sf.sequence = (sf.sequence + 1) & maskSequence
-                if sf.sequence == 0  {
-                        sf.recentTime++
-                        overtime := sf.recentTime - current
-                        time.Sleep(sleepTime((overtime)))
+                sf.sequence = sf.startSequence(n)
+                return nil
+        }
+        if sf.recentTime > current && sf.recentTime > sf.borrowedUntil {
+                sf.logger.Error("clock moved backwards, refusing to generate ids",
+                        "recent_time", sf.recentTime, "current_time", current)
+                return errors.New("clock moved backwards")
+        }
+        maskSequence := sf.layout.maxSequence()
+        sf.sequence = (sf.sequence + 1) & maskSequence
+        if sf.sequence != 0 {
+                return nil
+        }
+        policy := sequencePolicyFrom(ctx, sf.policy)
+        next := sf.recentTime + 1
+        var borrow int64
+        if policy.Mode == SequenceBorrow {
+                borrow = int64(policy.MaxBorrow)
+        }
+        var wait time.Duration
+        if overtime := next - current - borrow; overtime > 0 {
+                wait = sf.sleepTime(overtime)
+        }
+        if policy.failsAfter(wait) {
+                // keep the tick used up for the next request
+                sf.sequence = maskSequence
+                return &SequenceExhaustedError{RetryAfter: wait}
+        }
+        if borrow > 0 {
+                if err := sf.borrow(next, current); err != nil {
+                        sf.sequence = maskSequence
+                        return err
                 }
-        } else {
-                log.Fatal("recent time can never be greater than current time")
         }
+        sf.recentTime = next
+        sf.sequence = sf.startSequence(n)
+        if wait > 0 {
+                _, span := tracer().Start(ctx, "snowflake tick wait",
+                        trace.WithAttributes(attribute.Int64("snowflake.wait_ns", int64(wait))))
+                time.Sleep(wait)
+                span.End()
+        }
+        return nil
 }
-func (sf *SnowFlake) NextIDRange () (uint64, uint64, error) {
-        sf.mutex.Lock()
+
+// claim hands out n consecutive sequence numbers of a tick and returns the first one. If the rest of the current
+// tick is too short, the sequence moves on to the following tick. The sequence is left at the last number handed out.
+func (sf *SnowFlake) claim(ctx context.Context, n int) (uint16, error) {
+        if err := sf.validateTime(ctx, n); err != nil {
+                return 0, err
+        }
+        maxSequence := sf.layout.maxSequence()
+        if int(sf.sequence) + n - 1 > int(maxSequence) {
+                // part of the current tick is already used
+                sf.sequence = maxSequence
+                if err := sf.validateTime(ctx, n); err != nil {
+                        return 0, err
+                }
+        }
+        first := sf.sequence
+        sf.sequence += uint16(n - 1)
+        return first, nil
+}
+
+// NextIDRange returns the first and the last of n consecutive ids, n is at most the ids of a tick.
+// All ids in between belong to the caller. With a SequenceMultiplier n is either 1 or all ids of a tick.
+func (sf *SnowFlake) NextIDRange(n int) (uint64, uint64, error) {
+        return sf.NextIDRangeContext(context.Background(), n)
+}
+
+// NextIDRangeContext is NextIDRange with the waits for the lock and the next tick traced as children of ctx.
+func (sf *SnowFlake) NextIDRangeContext(ctx context.Context, n int) (uint64, uint64, error) {
+        tickSize := int(sf.layout.maxSequence()) + 1
+        if err := checkCount(n, tickSize); err != nil {
+                return 0, 0, err
+        }
+        if sf.multiplier != 0 && n != 1 && n != tickSize {
+                return 0, 0, errors.New("scrambled sequences only have ranges of 1 or a whole tick")
+        }
+        sf.lock(ctx)
         defer sf.mutex.Unlock()
-        sf.validateTime()
-        lower, err := sf.toID()
-        if (err != nil) {
+        first, err := sf.claim(ctx, n)
+        if err != nil {
+                return 0, 0, err
+        }
+        if n == 1 {
+                id, err := sf.toID()
+                return id, id, err
+        }
+        // a whole tick is the same set of ids whether scrambled or not
+        lower, err := sf.layout.toID(sf.recentTime, sf.machineID, first)
+        if err != nil {
                 return 0, 0, err
         }
-        sf.sequence = uint16(1 << BitLenSequence - 1)
-        upper, err := sf.toID()
-        if (err != nil) {
+        upper, err := sf.layout.toID(sf.recentTime, sf.machineID, sf.sequence)
+        if err != nil {
                 return 0, 0, err
         }
         return lower, upper, nil
-
 }
 
 const snowFlakeTimeUnitScaleFactor = 1e7 // nsec, i.e. 10 msec convert unit of nano-sec to 10 msec.
@@ -154,121 +398,102 @@ func toSnowFlakeTime(t time.Time) int64 {
         return t.UTC().UnixNano() / snowFlakeTimeUnitScaleFactor
 }
 
-func currentElapsedTime(startTime int64) int64 {
-        return toSnowFlakeTime(time.Now()) - startTime
+func (sf *SnowFlake) toSnowFlakeTime(t time.Time) int64 {
+        return t.UTC().UnixNano() / sf.timeUnit
 }
 
-func sleepTime(overtime int64) time.Duration {
-        return time.Duration(overtime)*10*time.Millisecond -
-                time.Duration(time.Now().UTC().UnixNano() % snowFlakeTimeUnitScaleFactor) * time.Nanosecond
+// tickTime returns the wall clock time at which the tick elapsed ticks after startTime begins,
+// rounding startTime down to the time unit like SnowFlake does.
+func tickTime(startTime time.Time, timeUnit time.Duration, elapsed uint64) time.Time {
+        return client.TickTime(startTime, timeUnit, elapsed)
 }
 
-func (sf *SnowFlake) toID() (uint64, error) {
-        if sf.recentTime >= 1<<BitLenTime {
-                return 0, errors.New("over the time limit")
-        }
-        // Time-Sequence-MachineID
-        //return uint64(sf.elapsedTime)<<(BitLenSequence+BitLenMachineID) |
-        //        uint64(sf.sequence)<<BitLenMachineID |
-        //        uint64(sf.machineID), nil
+func (sf *SnowFlake) currentElapsedTime() int64 {
+        return sf.toSnowFlakeTime(time.Now()) - sf.startTime
+}
 
-        // Time-MachineID-Sequence
-        return uint64(sf.recentTime) << (BitLenSequence + BitLenMachineID) |
-                uint64(sf.machineID) << BitLenSequence |
-                uint64(sf.sequence), nil
+func (sf *SnowFlake) sleepTime(overtime int64) time.Duration {
+        return time.Duration(overtime * sf.timeUnit) -
+                time.Duration(time.Now().UTC().UnixNano() % sf.timeUnit) * time.Nanosecond
 }
 
-func privateIPv4() (net.IP, error) {
-        as, err := net.InterfaceAddrs()
-        if err != nil {
-                return nil, err
-        }
+func (sf *SnowFlake) toID() (uint64, error) {
+        return sf.layout.toID(sf.recentTime, sf.machineID, sf.scramble(sf.sequence))
+}
 
-        for _, a := range as {
-                ipnet, ok := a.(*net.IPNet)
-                if !ok || ipnet.IP.IsLoopback() {
-                        continue
-                }
+// startSequence is the first sequence number of a new tick whose first request takes n ids.
+func (sf *SnowFlake) startSequence(n int) uint16 {
+        return sf.layout.startSequence(sf.randomStart, n)
+}
 
-                ip := ipnet.IP.To4()
-                if isPrivateIPv4(ip) {
-                        return ip, nil
-                }
+// scramble maps a sequence number to the sequence part of its id, a permutation of the tick if the
+// multiplier is odd.
+func (sf *SnowFlake) scramble(sequence uint16) uint16 {
+        if sf.multiplier == 0 {
+                return sequence
         }
-        return nil, errors.New("no private ip address")
+        return sequence * sf.multiplier & sf.layout.maxSequence()
 }
 
-func amazonEC2PrivateIPv4() (net.IP, error) {
-        // URL to retrieve instance metadata in an AWS EC2 instance:
-        // http://docs.aws.amazon.com/en_us/AWSEC2/latest/UserGuide/ec2-instance-metadata.html
-        timeout := time.Duration( 10 * time.Millisecond)
-        client := http.Client{
-                Timeout: timeout,
-        }
-        res, err := client.Get("http://169.254.169.254/latest/meta-data/local-ipv4")
-        if err != nil {
-                return nil, err
-        }
-        defer res.Body.Close()
+func (l Layout) valid() bool {
+        return client.Layout(l).Valid()
+}
 
-        body, err := ioutil.ReadAll(res.Body)
-        if err != nil {
-                return nil, err
-        }
+func (l Layout) maxSequence() uint16 {
+        return uint16(1 << l.BitLenSequence - 1)
+}
 
-        ip := net.ParseIP(string(body))
-        if ip == nil {
-                return nil, errors.New("invalid ip address")
+// startSequence returns 0, or a random sequence number which leaves room for n ids in the tick.
+func (l Layout) startSequence(random bool, n int) uint16 {
+        if !random {
+                return 0
         }
-        return ip.To4(), nil
+        return uint16(rand.IntN(int(l.maxSequence()) + 2 - n))
 }
 
-func k8sPodIPFromEnvVariable() (net.IP, error) {
-        podIpEnvVarKey := "UNIQUE_ID_POD_IP"
-        podIpStr := os.Getenv(podIpEnvVarKey)
-        if podIpStr == "" {
-                return nil, errors.New("Env Variable Not Present")
-        }
-        ip := net.ParseIP(podIpStr)
-        if ip == nil {
-                return nil, errors.New("invalid ip address")
-        }
-        return ip.To4(), nil
+func (l Layout) maxMachineID() uint16 {
+        return uint16(1 << l.BitLenMachineID - 1)
 }
 
-func isPrivateIPv4(ip net.IP) bool {
-        return ip != nil &&
-                (ip[0] == 10 || ip[0] == 172 && (ip[1] >= 16 && ip[1] < 32) || ip[0] == 192 && ip[1] == 168)
+func (l Layout) toID(elapsedTime int64, machineID uint16, sequence uint16) (uint64, error) {
+        if elapsedTime >= 1 << l.BitLenTime {
+                return 0, errors.New("over the time limit")
+        }
+        // Time-Sequence-MachineID
+        //return uint64(sf.elapsedTime)<<(BitLenSequence+BitLenMachineID) |
+        //        uint64(sf.sequence)<<BitLenMachineID |
+        //        uint64(sf.machineID), nil
+
+        // Time-MachineID-Sequence
+        return uint64(elapsedTime) << (l.BitLenSequence + l.BitLenMachineID) |
+                uint64(machineID) << l.BitLenSequence |
+                uint64(sequence), nil
 }
 
 func lower16BitPrivateIP() (uint16, error) {
-        ip, err := k8sPodIPFromEnvVariable()
-        if err != nil {
-                ip, err = amazonEC2PrivateIPv4()
-        }
-        if err != nil {
-                ip, err = privateIPv4()
-        }
-        if err != nil {
-                return 0, err
-        }
+        machineID, _, err := privateIPMachineID()
+        return machineID, err
+}
 
-        return uint16(ip[2])<<8 + uint16(ip[3]), nil
+// privateIPMachineID returns the lower 16 bits of the private ip and where the ip was found.
+func privateIPMachineID() (uint16, string, error) {
+        return machineid.FromPrivateIP()
 }
 
 // Decompose returns a set of SnowFlake ID parts.
 // Time-MachineID-Sequence
 func decompose(id uint64) map[string]uint64 {
-        // const maskSequence = uint64((1<<BitLenSequence - 1) << BitLenMachineID)
-        const maskSequence = uint64((1<<BitLenSequence - 1))
-        //const maskMachineID = uint64(1<<BitLenMachineID - 1)
-        const maskMachineID = uint64((1<<BitLenMachineID - 1) << BitLenSequence )
+        return DefaultLayout.Decompose(id)
+}
+
+// Decompose returns a set of SnowFlake ID parts for an id built with this layout.
+func (l Layout) Decompose(id uint64) map[string]uint64 {
+        maskSequence := uint64(1 << l.BitLenSequence - 1)
+        maskMachineID := uint64(1 << l.BitLenMachineID - 1) << l.BitLenSequence
         msb := id >> 63
-        time := id >> (BitLenSequence + BitLenMachineID)
-        //sequence := id & maskSequence >> BitLenMachineID
+        time := id >> (l.BitLenSequence + l.BitLenMachineID)
         sequence := id & maskSequence
-
-        machineID := id & maskMachineID >> BitLenSequence
+        machineID := id & maskMachineID >> l.BitLenSequence
 
         return map[string]uint64{
                 "id":         id,
@@ -278,4 +503,3 @@ func decompose(id uint64) map[string]uint64 {
                 "machine-id": machineID,
         }
 }
-
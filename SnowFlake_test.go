@@ -1,5 +1,6 @@
 package main
 import (
+        "context"
         "fmt"
         "runtime"
         "testing"
@@ -81,11 +82,11 @@ func TestSnowFlakeConsecutive(t *testing.T) {
 
 func TestSnowFlakeRangeConsecutive(t *testing.T) {
         sf := getSnowFlake()
-        lower1, upper1, err := sf.NextIDRange()
+        lower1, upper1, err := sf.NextIDRange(256)
         if err != nil {
                 t.Fatal("id bounds not generated")
         }
-        lower2, upper2, err := sf.NextIDRange()
+        lower2, upper2, err := sf.NextIDRange(256)
         assert.Equal(t, true, (lower1 < upper1), "Lower Upper mismatch")
         assert.Equal(t, true, (lower2 < upper2), "Lower Upper mismatch")
         assert.Equal(t, true, (lower1 < lower2), "Lower Lower mismatch")
@@ -98,7 +99,7 @@ func currentTime() int64 {
 
 func TestSnowFlakeList(t *testing.T) {
         sf := getSnowFlake()
-        idList, err := sf.NextIDs()
+        idList, err := sf.NextIDs(256)
         if err != nil {
                 t.Fatal("id list not generated")
         }
@@ -127,7 +128,7 @@ func TestSnowFlakeList(t *testing.T) {
 
 func TestSnowFlakeRange(t *testing.T) {
         sf := getSnowFlake()
-        lower, upper, err := sf.NextIDRange()
+        lower, upper, err := sf.NextIDRange(256)
         if err != nil {
                 t.Fatal("id bounds not generated")
         }
@@ -259,6 +260,21 @@ func TestNilSnowFlake(t *testing.T) {
         if NewSnowFlake(invalidMachineID) != nil {
                 t.Errorf("SnowFlake with invalid machine id")
         }
+
+        // the pod ip 10.0.1.65 gives 321, which needs 9 bits
+        narrowLayout := Settings{Layout: Layout{BitLenTime: 47, BitLenMachineID: 8, BitLenSequence: 8}}
+        t.Setenv("UNIQUE_ID_POD_IP", "10.0.1.65")
+        if NewSnowFlake(narrowLayout) != nil {
+                t.Errorf("SnowFlake with a derived machine id cut to the layout")
+        }
+        narrowLayout.MachineID = mockMachineId
+        if NewSnowFlake(narrowLayout) != nil {
+                t.Errorf("SnowFlake with a machine id cut to the layout")
+        }
+        narrowLayout.Layout = Layout{BitLenTime: 45, BitLenMachineID: 10, BitLenSequence: 8}
+        if NewSnowFlake(narrowLayout) == nil {
+                t.Errorf("SnowFlake with a machine id which fits not created")
+        }
 }
 
 func pseudoSleep(period time.Duration, sf *SnowFlake) {
@@ -277,3 +293,112 @@ func TestNextIDError(t *testing.T) {
                 t.Errorf("time is not over")
         }
 }
+
+func TestClockMovedBackwards(t *testing.T) {
+        sf := getSnowFlake()
+        nextID(t, sf)
+        // the clock moved back by a second
+        sf.recentTime += 100
+        _, err := sf.NextID()
+        assert.NotNil(t, err, "clock moving backwards should be an error")
+        _, err = sf.NextIDs(256)
+        assert.NotNil(t, err, "clock moving backwards should be an error")
+        _, _, err = sf.NextIDRange(256)
+        assert.NotNil(t, err, "clock moving backwards should be an error")
+}
+
+// The benchmarks below use the default layout and time unit of the service, so NextIDs and NextIDRange
+// mostly measure the wait for a fresh 10ms tick. BenchmarkMutexNextID and friends use a finer layout.
+func BenchmarkNextID(b *testing.B) {
+        sf := getSnowFlake()
+        for i := 0; i < b.N; i++ {
+                if _, err := sf.NextID(); err != nil {
+                        b.Fatal(err)
+                }
+        }
+}
+
+func BenchmarkNextIDs(b *testing.B) {
+        sf := getSnowFlake()
+        for i := 0; i < b.N; i++ {
+                if _, err := sf.NextIDs(256); err != nil {
+                        b.Fatal(err)
+                }
+        }
+}
+
+func BenchmarkNextIDRange(b *testing.B) {
+        sf := getSnowFlake()
+        for i := 0; i < b.N; i++ {
+                if _, _, err := sf.NextIDRange(256); err != nil {
+                        b.Fatal(err)
+                }
+        }
+}
+
+func TestRandomSequenceStart(t *testing.T) {
+        settings := Settings{StartTime: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), TimeUnit: time.Hour,
+                MachineID: mockMachineId, RandomSequenceStart: true}
+        fail := WithSequencePolicy(context.Background(), SequencePolicy{Mode: SequenceFail})
+        starts := map[uint64]bool{}
+        for i := 0; i < 20; i++ {
+                sf := NewSnowFlake(settings)
+                first, err := sf.NextID()
+                assert.Nil(t, err)
+                start := decompose(first)["sequence"]
+                starts[start] = true
+                last := first
+                for {
+                        id, err := sf.NextIDContext(fail)
+                        if err != nil {
+                                break
+                        }
+                        assert.True(t, id > last, "ids still increase")
+                        last = id
+                }
+                assert.Equal(t, uint64(255), decompose(last)["sequence"])
+                assert.Equal(t, 256 - start, last - first + 1, "the tick is used from the random start on")
+        }
+        assert.True(t, len(starts) > 1, "the ticks start at different sequence numbers")
+
+        lower, upper, err := NewSnowFlake(settings).NextIDRange(256)
+        assert.Nil(t, err)
+        assert.Equal(t, uint64(0), decompose(lower)["sequence"], "a whole tick starts at 0")
+        assert.Equal(t, uint64(255), upper - lower)
+        lower, upper, err = NewAtomicSnowFlake(settings).NextIDRange(200)
+        assert.Nil(t, err)
+        assert.True(t, decompose(upper)["sequence"] <= 255)
+        assert.Equal(t, uint64(199), upper - lower)
+}
+
+func TestSequenceMultiplier(t *testing.T) {
+        settings := Settings{StartTime: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), TimeUnit: time.Hour,
+                MachineID: mockMachineId, SequenceMultiplier: 37}
+        sf := NewSnowFlake(settings)
+        seen := mapset.NewSet()
+        var sequences []uint64
+        for i := 0; i < 256; i++ {
+                id, err := sf.NextID()
+                assert.Nil(t, err)
+                seen.Add(id)
+                sequences = append(sequences, decompose(id)["sequence"])
+        }
+        assert.Equal(t, 256, seen.Cardinality(), "the multiplier permutes the sequence of the tick")
+        assert.Equal(t, []uint64{0, 37, 74, 111, 148, 185, 222, 3}, sequences[:8])
+
+        ids, err := NewSnowFlake(settings).NextIDs(256)
+        assert.Nil(t, err)
+        for i := 1; i < len(ids); i++ {
+                assert.Equal(t, ids[i - 1] + 1, ids[i], "a whole tick is sorted")
+        }
+        _, _, err = NewSnowFlake(settings).NextIDRange(10)
+        assert.NotNil(t, err)
+        lower, upper, err := NewSnowFlake(settings).NextIDRange(256)
+        assert.Nil(t, err)
+        assert.Equal(t, uint64(255), upper - lower)
+
+        settings.SequenceMultiplier = 36
+        assert.Nil(t, NewSnowFlake(settings), "even multipliers are not a permutation")
+        settings.SequenceMultiplier = 37
+        assert.Nil(t, NewAtomicSnowFlake(settings))
+}
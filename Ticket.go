@@ -0,0 +1,321 @@
+package main
+
+import (
+        "bufio"
+        "context"
+        "errors"
+        "fmt"
+        "io"
+        "log/slog"
+        "net"
+        "strconv"
+        "sync"
+        "time"
+        "go.opentelemetry.io/otel/attribute"
+        "go.opentelemetry.io/otel/trace"
+)
+
+// TicketConfig configures a namespace whose ids come from a Redis counter, like a Flickr style ticket server.
+// Every reservation INCRBYs Key by BlockSize and serves the ids of the block locally, so Redis is asked once
+// per block. Ids are unique across all replicas sharing Key and increase within a replica, but they carry no
+// time or machine id. Ids of a block which is not used up when the replica stops are never handed out.
+type TicketConfig struct {
+        Addr      string `json:"addr"`       // host:port of Redis
+        Password  string `json:"password"`   // sent with AUTH if set
+        DB        int    `json:"db"`         // selected if not 0
+        Key       string `json:"key"`        // counter, defaults to unique-id:<namespace>
+        RangeSize int    `json:"range_size"` // ids of /longids and /longidrange, a power of two, default 256
+        BlockSize int    `json:"block_size"` // ids reserved at once, a multiple of RangeSize, default 16 ranges
+        Timeout   string `json:"timeout"`    // of a Redis request, parsed by time.ParseDuration, default 1s
+}
+
+// TicketGenerator hands out ids reserved in blocks from a Redis counter. NextIDRange hands out up to RangeSize
+// consecutive ids, like a tick of a SnowFlake. It is safe for concurrent use.
+type TicketGenerator struct {
+        mutex     sync.Mutex
+        counter   *redisCounter
+        rangeSize uint64
+        blockSize uint64
+        next      uint64 // next id of the block
+        end       uint64 // first id after the block
+        logger    *slog.Logger
+}
+
+// NewTicketGenerator returns a TicketGenerator for the config. Redis is not contacted before the first id.
+func NewTicketGenerator(config TicketConfig, logger *slog.Logger) (*TicketGenerator, error) {
+        if config.Addr == "" || config.Key == "" {
+                return nil, errors.New("ticket generator needs a redis addr and key")
+        }
+        if err := config.setDefaults(); err != nil {
+                return nil, err
+        }
+        timeout, err := config.timeout()
+        if err != nil {
+                return nil, err
+        }
+        if logger == nil {
+                logger = slog.Default()
+        }
+        return &TicketGenerator{
+                counter:   newRedisCounter(config, timeout),
+                rangeSize: uint64(config.RangeSize),
+                blockSize: uint64(config.BlockSize),
+                logger:    logger.With("redis_key", config.Key),
+        }, nil
+}
+
+// setDefaults fills in and checks the range and block size.
+func (config *TicketConfig) setDefaults() error {
+        if config.RangeSize == 0 {
+                config.RangeSize = 1 << BitLenSequence
+        }
+        if config.RangeSize < 0 || config.RangeSize > 1 << 16 || config.RangeSize & (config.RangeSize - 1) != 0 {
+                return fmt.Errorf("range size %d is not a power of two up to 65536", config.RangeSize)
+        }
+        if config.BlockSize == 0 {
+                config.BlockSize = 16 * config.RangeSize
+        }
+        if config.BlockSize < 0 || config.BlockSize % config.RangeSize != 0 {
+                return fmt.Errorf("block size %d is not a multiple of the range size %d", config.BlockSize, config.RangeSize)
+        }
+        return nil
+}
+
+func (config *TicketConfig) timeout() (time.Duration, error) {
+        if config.Timeout == "" {
+                return time.Second, nil
+        }
+        timeout, err := time.ParseDuration(config.Timeout)
+        if err != nil || timeout <= 0 {
+                return 0, fmt.Errorf("invalid timeout %q", config.Timeout)
+        }
+        return timeout, nil
+}
+
+// NextID returns the next id of the block, reserving a new block if it is used up.
+func (g *TicketGenerator) NextID() (uint64, error) {
+        return g.NextIDContext(context.Background())
+}
+
+// NextIDContext is NextID with the Redis request traced as a child of ctx.
+func (g *TicketGenerator) NextIDContext(ctx context.Context) (uint64, error) {
+        id, _, err := g.NextIDRangeContext(ctx, 1)
+        return id, err
+}
+
+// NextIDs returns n increasing ids, consecutive within a range.
+func (g *TicketGenerator) NextIDs(n int) ([]uint64, error) {
+        return g.NextIDsContext(context.Background(), n)
+}
+
+// NextIDsContext is NextIDs with the Redis requests traced as children of ctx.
+func (g *TicketGenerator) NextIDsContext(ctx context.Context, n int) ([]uint64, error) {
+        return collectRanges(ctx, g, n)
+}
+
+// NextIDRange returns the bounds of n consecutive ids, n is at most RangeSize. If the rest of the block is
+// shorter, the rest is dropped and a new block is reserved.
+func (g *TicketGenerator) NextIDRange(n int) (uint64, uint64, error) {
+        return g.NextIDRangeContext(context.Background(), n)
+}
+
+// NextIDRangeContext is NextIDRange with the Redis request traced as a child of ctx.
+func (g *TicketGenerator) NextIDRangeContext(ctx context.Context, n int) (uint64, uint64, error) {
+        if err := checkCount(n, int(g.rangeSize)); err != nil {
+                return 0, 0, err
+        }
+        g.mutex.Lock()
+        defer g.mutex.Unlock()
+        if g.end - g.next < uint64(n) {
+                if err := g.reserve(ctx); err != nil {
+                        return 0, 0, err
+                }
+        }
+        lower := g.next
+        g.next += uint64(n)
+        return lower, g.next - 1, nil
+}
+
+// Describe returns the ticket strategy, ticket ids carry neither a time nor a machine id.
+func (g *TicketGenerator) Describe() Description {
+        return Description{Strategy: StrategyTicket, RangeSize: int(g.rangeSize)}
+}
+
+// reserve replaces the block by a new one. The caller holds the mutex.
+func (g *TicketGenerator) reserve(ctx context.Context) error {
+        upper, err := g.counter.reserve(ctx, g.blockSize)
+        if err != nil {
+                g.logger.Error("failed to reserve ids", "error", err)
+                return err
+        }
+        g.next, g.end = upper - g.blockSize + 1, upper + 1
+        return nil
+}
+
+// redisCounter reserves blocks of ids with INCRBY on a Redis key.
+type redisCounter struct {
+        client *respClient
+        key    string
+}
+
+func newRedisCounter(config TicketConfig, timeout time.Duration) *redisCounter {
+        return &redisCounter{
+                client: &respClient{addr: config.Addr, password: config.Password, db: config.DB, timeout: timeout},
+                key:    config.Key,
+        }
+}
+
+// reserve increments the counter by n and returns the last id of the block.
+func (c *redisCounter) reserve(ctx context.Context, n uint64) (uint64, error) {
+        ctx, span := tracer().Start(ctx, "redis incrby", trace.WithAttributes(attribute.String("redis.key", c.key)))
+        defer span.End()
+        upper, err := c.client.incrBy(ctx, c.key, int64(n))
+        if err != nil {
+                return 0, err
+        }
+        if upper < int64(n) {
+                return 0, fmt.Errorf("redis counter %s is %d after reserving a block", c.key, upper)
+        }
+        return uint64(upper), nil
+}
+
+// respClient speaks the Redis serialization protocol over a single TCP connection. A connection which fails is
+// closed and dialed again on the next command.
+type respClient struct {
+        mutex    sync.Mutex
+        addr     string
+        password string
+        db       int
+        timeout  time.Duration
+        conn     net.Conn
+        reader   *bufio.Reader
+}
+
+// respError is an error reply of the server.
+type respError string
+
+func (e respError) Error() string {
+        return "redis: " + string(e)
+}
+
+// incrBy increments key by n and returns the new value.
+func (c *respClient) incrBy(ctx context.Context, key string, n int64) (int64, error) {
+        reply, err := c.do(ctx, "INCRBY", key, strconv.FormatInt(n, 10))
+        if err != nil {
+                return 0, err
+        }
+        v, ok := reply.(int64)
+        if !ok {
+                return 0, fmt.Errorf("redis: unexpected reply %v to INCRBY", reply)
+        }
+        return v, nil
+}
+
+// do sends a command and returns its reply: a string, an int64, nil, a []interface{} or a respError.
+func (c *respClient) do(ctx context.Context, args ...string) (interface{}, error) {
+        c.mutex.Lock()
+        defer c.mutex.Unlock()
+        if c.conn == nil {
+                if err := c.connect(ctx); err != nil {
+                        return nil, err
+                }
+        }
+        reply, err := c.roundTrip(ctx, args)
+        if _, ok := err.(respError); err != nil && !ok {
+                c.conn.Close()
+                c.conn = nil
+        }
+        return reply, err
+}
+
+func (c *respClient) connect(ctx context.Context) error {
+        dialer := net.Dialer{Timeout: c.timeout}
+        conn, err := dialer.DialContext(ctx, "tcp", c.addr)
+        if err != nil {
+                return err
+        }
+        c.conn, c.reader = conn, bufio.NewReader(conn)
+        if c.password != "" {
+                _, err = c.roundTrip(ctx, []string{"AUTH", c.password})
+        }
+        if err == nil && c.db != 0 {
+                _, err = c.roundTrip(ctx, []string{"SELECT", strconv.Itoa(c.db)})
+        }
+        if err != nil {
+                conn.Close()
+                c.conn = nil
+        }
+        return err
+}
+
+func (c *respClient) roundTrip(ctx context.Context, args []string) (interface{}, error) {
+        deadline := time.Now().Add(c.timeout)
+        if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+                deadline = d
+        }
+        c.conn.SetDeadline(deadline)
+        buf := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+        for _, arg := range args {
+                buf = append(buf, "$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n"...)
+        }
+        if _, err := c.conn.Write(buf); err != nil {
+                return nil, err
+        }
+        reply, err := readRESP(c.reader)
+        if err != nil {
+                return nil, err
+        }
+        if e, ok := reply.(respError); ok {
+                return nil, e
+        }
+        return reply, nil
+}
+
+// readRESP reads a single reply.
+func readRESP(r *bufio.Reader) (interface{}, error) {
+        line, err := r.ReadString('\n')
+        if err != nil {
+                return nil, err
+        }
+        if len(line) < 3 || line[len(line) - 2] != '\r' {
+                return nil, errors.New("redis: malformed reply")
+        }
+        kind, body := line[0], line[1:len(line) - 2]
+        switch kind {
+        case '+':
+                return body, nil
+        case '-':
+                return respError(body), nil
+        case ':':
+                return strconv.ParseInt(body, 10, 64)
+        case '$':
+                n, err := strconv.Atoi(body)
+                if err != nil || n < -1 {
+                        return nil, errors.New("redis: malformed bulk string length")
+                }
+                if n == -1 {
+                        return nil, nil
+                }
+                data := make([]byte, n + 2)
+                if _, err := io.ReadFull(r, data); err != nil {
+                        return nil, err
+                }
+                return string(data[:n]), nil
+        case '*':
+                n, err := strconv.Atoi(body)
+                if err != nil || n < -1 {
+                        return nil, errors.New("redis: malformed array length")
+                }
+                if n == -1 {
+                        return nil, nil
+                }
+                array := make([]interface{}, n)
+                for i := range array {
+                        if array[i], err = readRESP(r); err != nil {
+                                return nil, err
+                        }
+                }
+                return array, nil
+        }
+        return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+}
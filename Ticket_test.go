@@ -0,0 +1,250 @@
+package main
+
+import (
+        "bufio"
+        "context"
+        "encoding/json"
+        "fmt"
+        "net"
+        "net/http"
+        "strconv"
+        "strings"
+        "sync"
+        "testing"
+        "time"
+        "github.com/stretchr/testify/assert"
+)
+
+// fakeRedis is an in-process stand-in for Redis which understands PING, AUTH, SELECT and INCRBY.
+type fakeRedis struct {
+        listener net.Listener
+        mutex    sync.Mutex
+        values   map[string]int64
+        password string
+        commands []string
+        dropNext bool // close the connection instead of answering the next command
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+        listener, err := net.Listen("tcp", "127.0.0.1:0")
+        if err != nil {
+                t.Fatal("cannot listen: ", err)
+        }
+        f := &fakeRedis{listener: listener, values: map[string]int64{}}
+        t.Cleanup(func() { listener.Close() })
+        go func() {
+                for {
+                        conn, err := listener.Accept()
+                        if err != nil {
+                                return
+                        }
+                        go f.serve(conn)
+                }
+        }()
+        return f
+}
+
+func (f *fakeRedis) addr() string {
+        return f.listener.Addr().String()
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+        defer conn.Close()
+        r := bufio.NewReader(conn)
+        authenticated := false
+        for {
+                request, err := readRESP(r)
+                if err != nil {
+                        return
+                }
+                var args []string
+                for _, arg := range request.([]interface{}) {
+                        args = append(args, arg.(string))
+                }
+                f.mutex.Lock()
+                f.commands = append(f.commands, strings.Join(args, " "))
+                drop := f.dropNext
+                f.dropNext = false
+                reply := f.reply(args, &authenticated)
+                f.mutex.Unlock()
+                if drop {
+                        return
+                }
+                conn.Write([]byte(reply))
+        }
+}
+
+func (f *fakeRedis) reply(args []string, authenticated *bool) string {
+        command := strings.ToUpper(args[0])
+        if command == "AUTH" {
+                if len(args) == 2 && args[1] == f.password {
+                        *authenticated = true
+                        return "+OK\r\n"
+                }
+                return "-WRONGPASS invalid password\r\n"
+        }
+        if f.password != "" && !*authenticated {
+                return "-NOAUTH Authentication required.\r\n"
+        }
+        switch {
+        case command == "PING":
+                return "+PONG\r\n"
+        case command == "SELECT" && len(args) == 2:
+                return "+OK\r\n"
+        case command == "INCRBY" && len(args) == 3:
+                n, err := strconv.ParseInt(args[2], 10, 64)
+                if err != nil {
+                        return "-ERR value is not an integer or out of range\r\n"
+                }
+                if args[1] == "not-a-counter" {
+                        return "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"
+                }
+                f.values[args[1]] += n
+                return fmt.Sprintf(":%d\r\n", f.values[args[1]])
+        }
+        return "-ERR unknown command\r\n"
+}
+
+func (f *fakeRedis) numCommands(prefix string) int {
+        f.mutex.Lock()
+        defer f.mutex.Unlock()
+        n := 0
+        for _, c := range f.commands {
+                if strings.HasPrefix(c, prefix) {
+                        n++
+                }
+        }
+        return n
+}
+
+func TestTicketRanges(t *testing.T) {
+        redis := newFakeRedis(t)
+        g, err := NewTicketGenerator(TicketConfig{Addr: redis.addr(), Key: "ids"}, nil)
+        assert.Nil(t, err)
+        ctx := context.Background()
+        previous := uint64(0)
+        for i := 0; i < 16; i++ {
+                lower, upper, err := g.NextIDRangeContext(ctx, 256)
+                assert.Nil(t, err)
+                assert.Equal(t, previous + 1, lower)
+                assert.Equal(t, uint64(255), upper - lower)
+                previous = upper
+        }
+        assert.Equal(t, 1, redis.numCommands("INCRBY ids 4096"), "16 ranges fit into a block")
+        ids, err := g.NextIDsContext(ctx, 256)
+        assert.Nil(t, err)
+        assert.Equal(t, 256, len(ids))
+        assert.Equal(t, uint64(4097), ids[0])
+        assert.Equal(t, 2, redis.numCommands("INCRBY"))
+        assert.Equal(t, Description{Strategy: StrategyTicket, RangeSize: 256}, g.Describe())
+}
+
+func TestTicketDropsShortRest(t *testing.T) {
+        redis := newFakeRedis(t)
+        g, _ := NewTicketGenerator(TicketConfig{Addr: redis.addr(), Key: "ids", RangeSize: 16, BlockSize: 32}, nil)
+        ctx := context.Background()
+        id, err := g.NextIDContext(ctx)
+        assert.Nil(t, err)
+        assert.Equal(t, uint64(1), id)
+        lower, upper, _ := g.NextIDRangeContext(ctx, 16)
+        assert.Equal(t, []uint64{2, 17}, []uint64{lower, upper})
+        // 15 ids left in the block, too few for a range
+        lower, upper, _ = g.NextIDRangeContext(ctx, 16)
+        assert.Equal(t, []uint64{33, 48}, []uint64{lower, upper})
+        id, _ = g.NextIDContext(ctx)
+        assert.Equal(t, uint64(49), id)
+}
+
+func TestTicketReplicasDoNotCollide(t *testing.T) {
+        redis := newFakeRedis(t)
+        const numReplicas = 4
+        ids := make(chan uint64, numReplicas * 2000)
+        var wg sync.WaitGroup
+        for i := 0; i < numReplicas; i++ {
+                g, _ := NewTicketGenerator(TicketConfig{Addr: redis.addr(), Key: "shared", RangeSize: 16, BlockSize: 64}, nil)
+                for j := 0; j < 2; j++ {
+                        wg.Add(1)
+                        go func() {
+                                defer wg.Done()
+                                for k := 0; k < 1000; k++ {
+                                        id, err := g.NextIDContext(context.Background())
+                                        if err != nil {
+                                                t.Error(err)
+                                                return
+                                        }
+                                        ids <- id
+                                }
+                        }()
+                }
+        }
+        wg.Wait()
+        close(ids)
+        seen := map[uint64]bool{}
+        for id := range ids {
+                assert.False(t, seen[id], "duplicated id %d", id)
+                seen[id] = true
+        }
+        assert.Equal(t, numReplicas * 2000, len(seen))
+}
+
+func TestTicketAuthAndReconnect(t *testing.T) {
+        redis := newFakeRedis(t)
+        redis.password = "secret"
+        ctx := context.Background()
+        g, _ := NewTicketGenerator(TicketConfig{Addr: redis.addr(), Key: "ids", Password: "wrong"}, nil)
+        _, err := g.NextIDContext(ctx)
+        assert.NotNil(t, err, "wrong password")
+
+        g, _ = NewTicketGenerator(TicketConfig{Addr: redis.addr(), Key: "ids", Password: "secret", DB: 2,
+                RangeSize: 1, BlockSize: 1}, nil)
+        _, err = g.NextIDContext(ctx)
+        assert.Nil(t, err)
+        assert.Equal(t, 1, redis.numCommands("SELECT 2"))
+
+        redis.mutex.Lock()
+        redis.dropNext = true
+        redis.mutex.Unlock()
+        _, err = g.NextIDContext(ctx)
+        assert.NotNil(t, err, "connection dropped")
+        id, err := g.NextIDContext(ctx)
+        assert.Nil(t, err, "should reconnect")
+        assert.Equal(t, uint64(3), id, "the dropped INCRBY was applied, its block is lost")
+        assert.Equal(t, 2, redis.numCommands("AUTH secret"))
+}
+
+func TestTicketErrors(t *testing.T) {
+        redis := newFakeRedis(t)
+        g, _ := NewTicketGenerator(TicketConfig{Addr: redis.addr(), Key: "not-a-counter"}, nil)
+        _, _, err := g.NextIDRangeContext(context.Background(), 1)
+        assert.Equal(t, respError("WRONGTYPE Operation against a key holding the wrong kind of value"), err)
+        assert.NotNil(t, g.counter.client.conn, "error replies keep the connection")
+
+        g, _ = NewTicketGenerator(TicketConfig{Addr: "127.0.0.1:1", Key: "ids", Timeout: "100ms"}, nil)
+        _, err = g.NextIDContext(context.Background())
+        assert.NotNil(t, err, "nothing listens on port 1")
+
+        for _, config := range []TicketConfig{
+                {Key: "ids"}, {Addr: "redis:6379"}, {Addr: "redis:6379", Key: "ids", RangeSize: 100},
+                {Addr: "redis:6379", Key: "ids", BlockSize: 300}, {Addr: "redis:6379", Key: "ids", Timeout: "soon"},
+        } {
+                _, err := NewTicketGenerator(config, nil)
+                assert.NotNil(t, err, "%+v should be invalid", config)
+        }
+}
+
+func TestTicketNamespace(t *testing.T) {
+        redis := newFakeRedis(t)
+        config, err := parseServiceConfig([]byte(`{"namespaces": [{"name": "tickets",
+                "ticket": {"addr": "` + redis.addr() + `", "range_size": 128, "timeout": "1s"}}]}`))
+        assert.Nil(t, err)
+        err = setupNamespaces(&Settings{StartTime: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC), MachineID: mockMachineId}, config)
+        assert.Nil(t, err)
+        router := newRouter(config)
+
+        idRange := &IDRange{}
+        w := serve(router, "/ns/tickets/longidrange")
+        assert.Equal(t, http.StatusOK, w.Code)
+        json.Unmarshal(w.Body.Bytes(), idRange)
+        assert.Equal(t, IDRange{LowerBound: 1, UpperBound: 128}, *idRange)
+        assert.Equal(t, 1, redis.numCommands("INCRBY unique-id:tickets 2048"))
+}
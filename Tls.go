@@ -0,0 +1,202 @@
+package main
+
+import (
+        "context"
+        "crypto/tls"
+        "crypto/x509"
+        "errors"
+        "io/ioutil"
+        "net/http"
+        "os"
+        "sync"
+        "time"
+)
+
+// TLSConfig enables https. Certificate, key and client CA files are re-read when they change on disk,
+// so rotated certificates are picked up without a restart.
+//
+// ClientCAFile turns on mutual TLS: clients have to present a certificate signed by one of the CAs
+// in the file, unless ClientCertOptional is set.
+//
+// ClientIdentities maps client certificate subjects to the client names of the api keys, so that a
+// client authenticated by its certificate is charged to the quota of that client. A subject is matched
+// by its full distinguished name ("CN=billing,O=Acme") first and by its common name second.
+type TLSConfig struct {
+        CertFile           string            `json:"cert_file"`
+        KeyFile            string            `json:"key_file"`
+        ClientCAFile       string            `json:"client_ca_file"`
+        ClientCertOptional bool              `json:"client_cert_optional"`
+        ClientIdentities   map[string]string `json:"client_identities"`
+}
+
+// certReloadInterval is how often the files are checked for changes, at most once per handshake.
+const certReloadInterval = 10 * time.Second
+
+// certReloader serves the certificate and client CAs of a TLSConfig and reloads them on change.
+type certReloader struct {
+        config    *TLSConfig
+        mutex     sync.Mutex
+        cert      *tls.Certificate
+        clientCAs *x509.CertPool
+        modTimes  map[string]time.Time
+        lastCheck time.Time
+}
+
+func newCertReloader(config *TLSConfig) (*certReloader, error) {
+        if config.CertFile == "" || config.KeyFile == "" {
+                return nil, errors.New("tls needs a cert_file and a key_file")
+        }
+        r := &certReloader{config: config, modTimes: map[string]time.Time{}}
+        if err := r.load(); err != nil {
+                return nil, err
+        }
+        r.lastCheck = time.Now()
+        return r, nil
+}
+
+// load reads all files. The previous certificate stays in use if any of them is broken.
+func (r *certReloader) load() error {
+        cert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+        if err != nil {
+                return err
+        }
+        var pool *x509.CertPool
+        if r.config.ClientCAFile != "" {
+                pem, err := ioutil.ReadFile(r.config.ClientCAFile)
+                if err != nil {
+                        return err
+                }
+                pool = x509.NewCertPool()
+                if !pool.AppendCertsFromPEM(pem) {
+                        return errors.New("no certificates in client_ca_file")
+                }
+        }
+        r.cert = &cert
+        r.clientCAs = pool
+        for _, path := range r.files() {
+                if info, err := os.Stat(path); err == nil {
+                        r.modTimes[path] = info.ModTime()
+                }
+        }
+        return nil
+}
+
+func (r *certReloader) files() []string {
+        files := []string{r.config.CertFile, r.config.KeyFile}
+        if r.config.ClientCAFile != "" {
+                files = append(files, r.config.ClientCAFile)
+        }
+        return files
+}
+
+// maybeReload reloads the files if one of them changed since the last load.
+func (r *certReloader) maybeReload(now time.Time) {
+        r.mutex.Lock()
+        defer r.mutex.Unlock()
+        if now.Sub(r.lastCheck) < certReloadInterval {
+                return
+        }
+        r.lastCheck = now
+        changed := false
+        for _, path := range r.files() {
+                info, err := os.Stat(path)
+                if err == nil && !info.ModTime().Equal(r.modTimes[path]) {
+                        changed = true
+                }
+        }
+        if !changed {
+                return
+        }
+        if err := r.load(); err != nil {
+                logger.Error("failed to reload tls files, keeping the previous certificate", "error", err)
+        }
+}
+
+// current returns the certificate and client CAs in use.
+func (r *certReloader) current() (*tls.Certificate, *x509.CertPool) {
+        r.maybeReload(time.Now())
+        r.mutex.Lock()
+        defer r.mutex.Unlock()
+        return r.cert, r.clientCAs
+}
+
+// tlsConfig returns a tls.Config which asks the reloader for the certificate and client CAs of every handshake.
+func (r *certReloader) tlsConfig() *tls.Config {
+        base := &tls.Config{MinVersion: tls.VersionTLS12}
+        base.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+                cert, _ := r.current()
+                return cert, nil
+        }
+        base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+                cert, clientCAs := r.current()
+                config := base.Clone()
+                config.GetConfigForClient = nil
+                config.Certificates = []tls.Certificate{*cert}
+                if clientCAs != nil {
+                        config.ClientCAs = clientCAs
+                        config.ClientAuth = tls.RequireAndVerifyClientCert
+                        if r.config.ClientCertOptional {
+                                config.ClientAuth = tls.VerifyClientCertIfGiven
+                        }
+                }
+                return config, nil
+        }
+        return base
+}
+
+// clientCertIdentities is TLSConfig.ClientIdentities of the running service.
+var clientCertIdentities map[string]string
+
+// certIdentity returns the client name mapped from the verified client certificate of the request,
+// or "" if there is no verified certificate or its subject is not mapped.
+func certIdentity(r *http.Request) string {
+        if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+                return ""
+        }
+        subject := r.TLS.VerifiedChains[0][0].Subject
+        if identity, ok := clientCertIdentities[subject.String()]; ok {
+                return identity
+        }
+        return clientCertIdentities[subject.CommonName]
+}
+
+// newServer returns the server of the router, with the TLS config if configured.
+func newServer(addr string, handler http.Handler, config *TLSConfig) (*http.Server, error) {
+        server := &http.Server{Addr: addr, Handler: handler}
+        if config == nil {
+                return server, nil
+        }
+        reloader, err := newCertReloader(config)
+        if err != nil {
+                return nil, err
+        }
+        clientCertIdentities = config.ClientIdentities
+        server.TLSConfig = reloader.tlsConfig()
+        return server, nil
+}
+
+// shutdownTimeout bounds the time the requests in flight get to finish after a stop signal.
+const shutdownTimeout = 10 * time.Second
+
+// serveUntil serves over TLS if the server has a TLS config, plain http otherwise, until the server fails or a
+// signal arrives on stop. After a signal the requests in flight get shutdownTimeout to finish and nil is returned
+// if they do.
+func serveUntil(server *http.Server, stop <-chan os.Signal) error {
+        errs := make(chan error, 1)
+        go func() {
+                if server.TLSConfig != nil {
+                        errs <- server.ListenAndServeTLS("", "")
+                } else {
+                        errs <- server.ListenAndServe()
+                }
+        }()
+        select {
+        case err := <-errs:
+                return err
+        case sig := <-stop:
+                logger.Info("shutting down", "signal", sig.String())
+                ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+                defer cancel()
+                return server.Shutdown(ctx)
+        }
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+        "testing"
+        "crypto/ecdsa"
+        "crypto/elliptic"
+        "crypto/rand"
+        "crypto/tls"
+        "crypto/x509"
+        "crypto/x509/pkix"
+        "encoding/pem"
+        "io/ioutil"
+        "math/big"
+        "net"
+        "net/http"
+        "net/http/httptest"
+        "os"
+        "path/filepath"
+        "syscall"
+        "time"
+        "github.com/stretchr/testify/assert"
+)
+
+type testCert struct {
+        cert    *x509.Certificate
+        key     *ecdsa.PrivateKey
+        certPEM []byte
+        keyPEM  []byte
+}
+
+// newTestCert creates a certificate signed by parent, or a self signed CA if parent is nil.
+func newTestCert(t *testing.T, cn string, serial int64, parent *testCert) *testCert {
+        key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+        if err != nil {
+                t.Fatal("key not generated")
+        }
+        template := &x509.Certificate{
+                SerialNumber: big.NewInt(serial),
+                Subject:      pkix.Name{CommonName: cn, Organization: []string{"Test"}},
+                NotBefore:    time.Now().Add(-time.Hour),
+                NotAfter:     time.Now().Add(time.Hour),
+                KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+                ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+                IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+        }
+        signer, signerKey := template, key
+        if parent == nil {
+                template.IsCA = true
+                template.BasicConstraintsValid = true
+        } else {
+                signer, signerKey = parent.cert, parent.key
+        }
+        der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+        if err != nil {
+                t.Fatal("certificate not created: ", err)
+        }
+        cert, _ := x509.ParseCertificate(der)
+        keyDER, _ := x509.MarshalECPrivateKey(key)
+        return &testCert{cert: cert, key: key,
+                certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+                keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})}
+}
+
+func (tc *testCert) tlsCertificate() tls.Certificate {
+        cert, _ := tls.X509KeyPair(tc.certPEM, tc.keyPEM)
+        return cert
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+        if err := ioutil.WriteFile(path, data, 0600); err != nil {
+                t.Fatal("file not written")
+        }
+}
+
+// startTLSServer serves /identity, which echoes the certificate identity, with the given TLSConfig.
+func startTLSServer(t *testing.T, config *TLSConfig) (*httptest.Server, *certReloader) {
+        reloader, err := newCertReloader(config)
+        if err != nil {
+                t.Fatal("reloader not created: ", err)
+        }
+        clientCertIdentities = config.ClientIdentities
+        t.Cleanup(func() { clientCertIdentities = nil })
+        server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                w.Write([]byte(certIdentity(r)))
+        }))
+        server.TLS = reloader.tlsConfig()
+        server.StartTLS()
+        t.Cleanup(server.Close)
+        return server, reloader
+}
+
+func tlsClient(ca *testCert, clientCert *testCert) *http.Client {
+        pool := x509.NewCertPool()
+        pool.AddCert(ca.cert)
+        config := &tls.Config{RootCAs: pool}
+        if clientCert != nil {
+                config.Certificates = []tls.Certificate{clientCert.tlsCertificate()}
+        }
+        return &http.Client{Transport: &http.Transport{TLSClientConfig: config, DisableKeepAlives: true}}
+}
+
+func TestMutualTLSIdentity(t *testing.T) {
+        dir := t.TempDir()
+        ca := newTestCert(t, "test-ca", 1, nil)
+        serverCert := newTestCert(t, "127.0.0.1", 2, ca)
+        clientCert := newTestCert(t, "billing-service", 3, ca)
+        writeFile(t, filepath.Join(dir, "ca.pem"), ca.certPEM)
+        writeFile(t, filepath.Join(dir, "server.pem"), serverCert.certPEM)
+        writeFile(t, filepath.Join(dir, "server.key"), serverCert.keyPEM)
+
+        server, _ := startTLSServer(t, &TLSConfig{
+                CertFile:         filepath.Join(dir, "server.pem"),
+                KeyFile:          filepath.Join(dir, "server.key"),
+                ClientCAFile:     filepath.Join(dir, "ca.pem"),
+                ClientIdentities: map[string]string{"billing-service": "billing"},
+        })
+
+        res, err := tlsClient(ca, clientCert).Get(server.URL)
+        if err != nil {
+                t.Fatal("mtls request failed: ", err)
+        }
+        body, _ := ioutil.ReadAll(res.Body)
+        res.Body.Close()
+        assert.Equal(t, "billing", string(body), "Client certificate should map to the billing identity")
+
+        _, err = tlsClient(ca, nil).Get(server.URL)
+        assert.NotNil(t, err, "Request without client certificate should be rejected")
+
+        otherCA := newTestCert(t, "other-ca", 4, nil)
+        _, err = tlsClient(ca, newTestCert(t, "billing-service", 5, otherCA)).Get(server.URL)
+        assert.NotNil(t, err, "Client certificate of another CA should be rejected")
+}
+
+func TestCertificateReload(t *testing.T) {
+        dir := t.TempDir()
+        ca := newTestCert(t, "test-ca", 1, nil)
+        certFile, keyFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key")
+        first := newTestCert(t, "127.0.0.1", 10, ca)
+        writeFile(t, certFile, first.certPEM)
+        writeFile(t, keyFile, first.keyPEM)
+        server, reloader := startTLSServer(t, &TLSConfig{CertFile: certFile, KeyFile: keyFile})
+
+        serial := func() int64 {
+                res, err := tlsClient(ca, nil).Get(server.URL)
+                if err != nil {
+                        t.Fatal("tls request failed: ", err)
+                }
+                res.Body.Close()
+                return res.TLS.PeerCertificates[0].SerialNumber.Int64()
+        }
+        assert.Equal(t, int64(10), serial(), "Serial of the first certificate mismatch")
+
+        second := newTestCert(t, "127.0.0.1", 11, ca)
+        writeFile(t, certFile, second.certPEM)
+        writeFile(t, keyFile, second.keyPEM)
+        later := time.Now().Add(time.Minute)
+        os.Chtimes(certFile, later, later)
+        reloader.lastCheck = time.Time{}
+        assert.Equal(t, int64(11), serial(), "Rotated certificate should be served")
+
+        // a broken file keeps the previous certificate
+        writeFile(t, keyFile, []byte("broken"))
+        later = later.Add(time.Minute)
+        os.Chtimes(keyFile, later, later)
+        reloader.lastCheck = time.Time{}
+        assert.Equal(t, int64(11), serial(), "Previous certificate should be kept")
+}
+
+func TestAuthByClientCertificate(t *testing.T) {
+        a, err := NewAuthenticator([]APIKey{{Key: "secret", Client: "billing", PerDay: 1000}, {Client: "search", PerDay: 10}})
+        if err != nil {
+                t.Fatal("authenticator not created: ", err)
+        }
+        assert.Equal(t, a.clients["secret"], a.byClient["billing"], "Key quota should serve the certificate of the client")
+        assert.Equal(t, uint64(10), a.byClient["search"].key.PerDay, "Certificate only quota mismatch")
+        _, ok := a.clients[""]
+        assert.Equal(t, false, ok, "Empty key should not authenticate")
+}
+
+func TestServeUntilSignal(t *testing.T) {
+        server, err := newServer("127.0.0.1:0", http.NotFoundHandler(), nil)
+        assert.Nil(t, err, "plain http needs no certificates")
+        stop := make(chan os.Signal, 1)
+        done := make(chan error)
+        go func() { done <- serveUntil(server, stop) }()
+        stop <- syscall.SIGTERM
+        select {
+        case err := <-done:
+                assert.Nil(t, err, "a signal should shut the server down cleanly")
+        case <-time.After(5 * time.Second):
+                t.Fatal("server did not stop")
+        }
+
+        server, _ = newServer("127.0.0.1:-1", http.NotFoundHandler(), nil)
+        assert.NotNil(t, serveUntil(server, stop), "failing to listen should be returned")
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+        "context"
+        "errors"
+        "net/http"
+        "os"
+        "go.opentelemetry.io/otel"
+        "go.opentelemetry.io/otel/attribute"
+        "go.opentelemetry.io/otel/codes"
+        "go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+        "go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+        "go.opentelemetry.io/otel/propagation"
+        "go.opentelemetry.io/otel/sdk/resource"
+        sdktrace "go.opentelemetry.io/otel/sdk/trace"
+        "go.opentelemetry.io/otel/trace"
+        "gopkg.in/gin-gonic/gin.v1"
+)
+
+// TracingConfig configures OpenTelemetry tracing.
+//
+// Exporter is "none" (default), "stdout", "file" or "otlp". "file" appends the spans as JSON to File,
+// "otlp" sends them over http to Endpoint (host:port, default localhost:4318).
+// SampleRatio is the fraction of new traces that are recorded, default 1. Traces started by a caller
+// follow the sampling decision of the caller.
+type TracingConfig struct {
+        Exporter    string  `json:"exporter"`
+        File        string  `json:"file"`
+        Endpoint    string  `json:"endpoint"`
+        Insecure    bool    `json:"insecure"`
+        SampleRatio float64 `json:"sample_ratio"`
+}
+
+const tracerName = "github.com/spinaki/distributed-unique-id"
+
+// tracer returns the tracer of the service. Until setupTracing installs a provider its spans are no-ops.
+func tracer() trace.Tracer {
+        return otel.Tracer(tracerName)
+}
+
+// setupTracing installs the tracer provider and the W3C trace context propagator.
+// The returned function flushes and stops the exporter and closes the file of the file exporter.
+func setupTracing(config TracingConfig) (func(context.Context) error, error) {
+        otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+        var exporter sdktrace.SpanExporter
+        var file *os.File
+        var err error
+        switch config.Exporter {
+        case "", "none":
+                return func(context.Context) error { return nil }, nil
+        case "stdout":
+                exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+        case "file":
+                if config.File == "" {
+                        return nil, errors.New("file exporter needs a file")
+                }
+                if file, err = os.OpenFile(config.File, os.O_WRONLY | os.O_APPEND | os.O_CREATE, 0644); err != nil {
+                        return nil, err
+                }
+                if exporter, err = stdouttrace.New(stdouttrace.WithWriter(file)); err != nil {
+                        file.Close()
+                }
+        case "otlp":
+                options := []otlptracehttp.Option{}
+                if config.Endpoint != "" {
+                        options = append(options, otlptracehttp.WithEndpoint(config.Endpoint))
+                }
+                if config.Insecure {
+                        options = append(options, otlptracehttp.WithInsecure())
+                }
+                exporter, err = otlptracehttp.New(context.Background(), options...)
+        default:
+                return nil, errors.New("unknown trace exporter " + config.Exporter)
+        }
+        if err != nil {
+                return nil, err
+        }
+        ratio := config.SampleRatio
+        if ratio <= 0 {
+                ratio = 1
+        }
+        provider := sdktrace.NewTracerProvider(
+                sdktrace.WithBatcher(exporter),
+                sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+                sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "uniqueidgenerator"))),
+        )
+        otel.SetTracerProvider(provider)
+        return func(ctx context.Context) error {
+                err := provider.Shutdown(ctx)
+                if file != nil {
+                        if closeErr := file.Close(); err == nil {
+                                err = closeErr
+                        }
+                }
+                return err
+        }, nil
+}
+
+// tracingMiddleware continues the trace of the caller, if any, and wraps the request in a server span.
+// The span is named after the route, not the path, so every namespace shares the span name of its route.
+func tracingMiddleware() gin.HandlerFunc {
+        return func(c *gin.Context) {
+                ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+                route := c.FullPath()
+                if route == "" {
+                        route = "unmatched route"
+                }
+                attributes := []attribute.KeyValue{
+                        attribute.String("http.request.method", c.Request.Method),
+                        attribute.String("http.route", route),
+                        attribute.String("url.path", c.Request.URL.Path),
+                        attribute.String("url.query", c.Request.URL.RawQuery),
+                }
+                if ns := c.Param("name"); ns != "" {
+                        attributes = append(attributes, attribute.String("unique_id.namespace", ns))
+                }
+                ctx, span := tracer().Start(ctx, c.Request.Method + " " + route,
+                        trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attributes...))
+                defer span.End()
+                c.Request = c.Request.WithContext(ctx)
+                c.Next()
+                status := c.Writer.Status()
+                span.SetAttributes(attribute.Int("http.response.status_code", status))
+                if status >= 500 {
+                        span.SetStatus(codes.Error, http.StatusText(status))
+                }
+        }
+}
+
+// writeJSON writes the response body inside a span, so that slow encoding of big id lists shows up.
+func writeJSON(c *gin.Context, status int, obj interface{}) {
+        _, span := tracer().Start(c.Request.Context(), "encode json")
+        c.JSON(status, obj)
+        span.End()
+}
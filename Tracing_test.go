@@ -0,0 +1,121 @@
+package main
+
+import (
+        "testing"
+        "context"
+        "io/ioutil"
+        "net/http"
+        "net/http/httptest"
+        "path/filepath"
+        "strings"
+        "go.opentelemetry.io/otel"
+        "go.opentelemetry.io/otel/propagation"
+        sdktrace "go.opentelemetry.io/otel/sdk/trace"
+        "go.opentelemetry.io/otel/sdk/trace/tracetest"
+        "go.opentelemetry.io/otel/trace"
+        "github.com/stretchr/testify/assert"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+        recorder := tracetest.NewSpanRecorder()
+        provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+        previous := otel.GetTracerProvider()
+        otel.SetTracerProvider(provider)
+        otel.SetTextMapPropagator(propagation.TraceContext{})
+        t.Cleanup(func() { otel.SetTracerProvider(previous) })
+        return recorder
+}
+
+func spanNames(recorder *tracetest.SpanRecorder) map[string]sdktrace.ReadOnlySpan {
+        names := map[string]sdktrace.ReadOnlySpan{}
+        for _, span := range recorder.Ended() {
+                names[span.Name()] = span
+        }
+        return names
+}
+
+func TestTracingRouteName(t *testing.T) {
+        recorder := recordSpans(t)
+        router := getTestRouter(t)
+        serve(router, "/ns/orders/longids")
+        serve(router, "/ns/unknown-namespace/longids")
+        serve(router, "/no/such/route")
+
+        spans := spanNames(recorder)
+        server, ok := spans["GET /ns/:name/longids"]
+        assert.Equal(t, true, ok, "the server span should be named after the route")
+        serverNames := map[string]bool{}
+        for _, span := range recorder.Ended() {
+                if span.SpanKind() == trace.SpanKindServer {
+                        serverNames[span.Name()] = true
+                }
+        }
+        assert.Equal(t, 2, len(serverNames), "one span name per route: %v", serverNames)
+        if ok {
+                found := false
+                for _, kv := range server.Attributes() {
+                        found = found || kv.Key == "unique_id.namespace"
+                }
+                assert.Equal(t, true, found, "the namespace should be an attribute")
+        }
+        _, ok = spans["GET unmatched route"]
+        assert.Equal(t, true, ok, "unmatched paths should share a span name")
+}
+
+func TestTracingPropagation(t *testing.T) {
+        recorder := recordSpans(t)
+        router := getTestRouter(t)
+        w := httptest.NewRecorder()
+        req, _ := http.NewRequest("GET", "/longidrange", nil)
+        req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929b0e0e4736-00f067aa0ba902b7-01")
+        router.ServeHTTP(w, req)
+        assert.Equal(t, http.StatusOK, w.Code, "Status mismatch")
+
+        spans := spanNames(recorder)
+        server, ok := spans["GET /longidrange"]
+        if !ok {
+                t.Fatal("server span not recorded")
+        }
+        assert.Equal(t, "4bf92f3577b34da6a3ce929b0e0e4736", server.SpanContext().TraceID().String(), "Trace id should be continued")
+        assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String(), "Parent span mismatch")
+        for _, name := range []string{"snowflake lock", "encode json"} {
+                span, ok := spans[name]
+                assert.Equal(t, true, ok, name + " span should be recorded")
+                if ok {
+                        assert.Equal(t, server.SpanContext().SpanID(), span.Parent().SpanID(), name + " should be a child of the server span")
+                }
+        }
+}
+
+func TestTracingTickWait(t *testing.T) {
+        recorder := recordSpans(t)
+        sf := getSnowFlake()
+        ctx, span := tracer().Start(context.Background(), "test")
+        // the second list has to wait for the next tick
+        sf.NextIDsContext(ctx, 256)
+        sf.NextIDsContext(ctx, 256)
+        span.End()
+        wait, ok := spanNames(recorder)["snowflake tick wait"]
+        if !ok {
+                t.Fatal("tick wait span not recorded")
+        }
+        assert.Equal(t, span.SpanContext().TraceID(), wait.SpanContext().TraceID(), "Tick wait should be part of the trace")
+}
+
+func TestFileExporter(t *testing.T) {
+        path := filepath.Join(t.TempDir(), "spans.json")
+        previous := otel.GetTracerProvider()
+        defer otel.SetTracerProvider(previous)
+        shutdown, err := setupTracing(TracingConfig{Exporter: "file", File: path})
+        if err != nil {
+                t.Fatal("tracing not set up: ", err)
+        }
+        _, span := tracer().Start(context.Background(), "file span")
+        span.End()
+        shutdown(context.Background())
+        data, _ := ioutil.ReadFile(path)
+        assert.Condition(t, func() bool { return strings.Contains(string(data), `"Name":"file span"`) }, "span should be written to the file")
+
+        _, err = setupTracing(TracingConfig{Exporter: "zipkin"})
+        assert.NotNil(t, err, "unknown exporter should be rejected")
+}
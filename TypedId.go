@@ -0,0 +1,177 @@
+package main
+
+import (
+        "errors"
+        "fmt"
+        "net/http"
+        "strings"
+        "gopkg.in/gin-gonic/gin.v1"
+)
+
+// TypedID is an id tagged with the prefix of its resource type, written like ord_0BQ7FFM1fnNx:
+// the prefix, an underscore, the 11 base62 digits of the id and a base62 check digit.
+// Typed ids of one prefix sort like their ids. The check digit is computed with the Luhn mod N algorithm over
+// the prefix and the digits, so it catches every single mistyped char, most swapped neighbours and an id
+// pasted with the prefix of another type.
+type TypedID struct {
+        Prefix string
+        ID     uint64
+}
+
+// maxTypedIDPrefixLen bounds the length of a prefix, prefixes are short abbreviations like ord or cus.
+const maxTypedIDPrefixLen = 10
+
+// ValidTypedIDPrefix reports whether prefix is a lower case letter followed by lower case letters and digits.
+func ValidTypedIDPrefix(prefix string) bool {
+        if prefix == "" || len(prefix) > maxTypedIDPrefixLen || prefix[0] < 'a' || prefix[0] > 'z' {
+                return false
+        }
+        for i := 1; i < len(prefix); i++ {
+                if !(prefix[i] >= 'a' && prefix[i] <= 'z' || prefix[i] >= '0' && prefix[i] <= '9') {
+                        return false
+                }
+        }
+        return true
+}
+
+// String returns the typed id with its check digit.
+func (t TypedID) String() string {
+        body, _ := Encode(t.ID, IDFormatBase62)
+        return t.Prefix + "_" + body + string(typedIDCheckDigit(t.Prefix + body))
+}
+
+// ParseTypedID parses a typed id of any type, validating the prefix and the check digit.
+func ParseTypedID(s string) (TypedID, error) {
+        i := strings.LastIndexByte(s, '_')
+        if i < 0 {
+                return TypedID{}, errors.New("typed id has no prefix")
+        }
+        prefix, rest := s[:i], s[i + 1:]
+        if !ValidTypedIDPrefix(prefix) {
+                return TypedID{}, fmt.Errorf("invalid typed id prefix %q", prefix)
+        }
+        if len(rest) != 12 {
+                return TypedID{}, errors.New("typed ids have 12 chars after the prefix")
+        }
+        body, check := rest[:11], rest[11]
+        if strings.IndexByte(base62Alphabet, check) < 0 || typedIDCheckDigit(prefix + body) != check {
+                return TypedID{}, errors.New("invalid typed id check digit")
+        }
+        id, err := Decode(body, IDFormatBase62)
+        if err != nil {
+                return TypedID{}, err
+        }
+        return TypedID{Prefix: prefix, ID: id}, nil
+}
+
+// ParseTypedIDPrefix parses a typed id which has to carry prefix, so ids of other types are rejected.
+func ParseTypedIDPrefix(s string, prefix string) (TypedID, error) {
+        t, err := ParseTypedID(s)
+        if err != nil {
+                return t, err
+        }
+        if t.Prefix != prefix {
+                return TypedID{}, fmt.Errorf("typed id has prefix %q, expected %q", t.Prefix, prefix)
+        }
+        return t, nil
+}
+
+// IsValidTypedID reports whether s parses as a typed id.
+func IsValidTypedID(s string) bool {
+        _, err := ParseTypedID(s)
+        return err == nil
+}
+
+// typedIDCheckDigit returns the Luhn mod 62 check digit of a string of base62 chars.
+func typedIDCheckDigit(s string) byte {
+        const n = len(base62Alphabet)
+        factor, sum := 2, 0
+        for i := len(s) - 1; i >= 0; i-- {
+                addend := factor * strings.IndexByte(base62Alphabet, s[i])
+                factor = 3 - factor
+                sum += addend / n + addend % n
+        }
+        return base62Alphabet[(n - sum % n) % n]
+}
+
+// TypedIDList is the response of /typedids.
+type TypedIDList struct {
+        List []string `json:"id_list"`
+        Type string   `json:"type"`
+}
+
+// TypedIDResponse is the response of /typedid.
+type TypedIDResponse struct {
+        ID   string `json:"id"`
+        Type string `json:"type"`
+}
+
+// requestTypedIDPrefix returns the prefix of the type query param in the namespace.
+// Unknown types get a 400 and false is returned.
+func requestTypedIDPrefix(c *gin.Context, ns *Namespace) (string, string, bool) {
+        typ := c.Query("type")
+        prefix, ok := ns.types[typ]
+        if !ok {
+                badRequest(c, errorCodeInvalidParam, "type", fmt.Sprintf("unknown type %q in namespace %s", typ, ns.Name))
+                return "", "", false
+        }
+        return typ, prefix, true
+}
+
+func typedIdsHandler(c *gin.Context) {
+        ns := requestNamespace(c)
+        if ns == nil {
+                return
+        }
+        typ, prefix, ok := requestTypedIDPrefix(c, ns)
+        if !ok {
+                return
+        }
+        ctx, ok := requestGenerateContext(c)
+        if !ok {
+                return
+        }
+        if !chargeQuota(c, ns.tickSize()) {
+                return
+        }
+        idList, err := ns.GenerateIDList(ctx)
+        if err != nil {
+                generateFailed(c, ns, err, "typed id list")
+                return
+        }
+        if !recordIssuedList(c, ns, idList.List, idList.MachineId) {
+                return
+        }
+        typedIdList := &TypedIDList{List: make([]string, len(idList.List)), Type: typ}
+        for i, id := range idList.List {
+                typedIdList.List[i] = TypedID{Prefix: prefix, ID: id}.String()
+        }
+        writeJSON(c, http.StatusOK, typedIdList)
+}
+
+func typedIdHandler(c *gin.Context) {
+        ns := requestNamespace(c)
+        if ns == nil {
+                return
+        }
+        typ, prefix, ok := requestTypedIDPrefix(c, ns)
+        if !ok {
+                return
+        }
+        ctx, ok := requestGenerateContext(c)
+        if !ok {
+                return
+        }
+        if !chargeQuota(c, 1) {
+                return
+        }
+        id, err := ns.GenerateID(ctx)
+        if err != nil {
+                generateFailed(c, ns, err, "typed id")
+                return
+        }
+        if !recordIssued(c, ns, id.ID, id.ID, id.MachineId) {
+                return
+        }
+        writeJSON(c, http.StatusOK, &TypedIDResponse{ID: TypedID{Prefix: prefix, ID: id.ID}.String(), Type: typ})
+}
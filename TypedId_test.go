@@ -0,0 +1,107 @@
+package main
+
+import (
+        "encoding/json"
+        "net/http"
+        "sort"
+        "testing"
+        "testing/quick"
+        "github.com/stretchr/testify/assert"
+)
+
+func TestTypedIDRoundTrip(t *testing.T) {
+        roundTrip := func(id uint64) bool {
+                typed := TypedID{Prefix: "ord", ID: id}
+                parsed, err := ParseTypedID(typed.String())
+                return err == nil && parsed == typed && len(typed.String()) == 16
+        }
+        if err := quick.Check(roundTrip, &quick.Config{MaxCount: 10000}); err != nil {
+                t.Error(err)
+        }
+        parsed, err := ParseTypedIDPrefix(TypedID{Prefix: "cus2", ID: 42}.String(), "cus2")
+        assert.Nil(t, err)
+        assert.Equal(t, uint64(42), parsed.ID)
+}
+
+func TestTypedIDSortsLikeIds(t *testing.T) {
+        ids := []uint64{1, 1 << 62, 99, 1 << 40, 1 << 40 + 1, 7}
+        typed := make([]string, len(ids))
+        for i, id := range ids {
+                typed[i] = TypedID{Prefix: "ord", ID: id}.String()
+        }
+        sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+        sort.Strings(typed)
+        for i, s := range typed {
+                parsed, _ := ParseTypedID(s)
+                assert.Equal(t, ids[i], parsed.ID)
+        }
+}
+
+func TestTypedIDCheckDigit(t *testing.T) {
+        s := TypedID{Prefix: "ord", ID: 1 << 50 + 12345}.String()
+        // every single mistyped char is caught
+        for i := 4; i < len(s); i++ {
+                for j := 0; j < len(base62Alphabet); j++ {
+                        if base62Alphabet[j] == s[i] {
+                                continue
+                        }
+                        typo := s[:i] + string(base62Alphabet[j]) + s[i + 1:]
+                        assert.False(t, IsValidTypedID(typo), "%s should be invalid", typo)
+                }
+        }
+        // swapped neighbours
+        caught, swaps := 0, 0
+        for i := 4; i < len(s) - 1; i++ {
+                if s[i] == s[i + 1] {
+                        continue
+                }
+                swaps++
+                if !IsValidTypedID(s[:i] + string(s[i + 1]) + string(s[i]) + s[i + 2:]) {
+                        caught++
+                }
+        }
+        assert.Equal(t, swaps, caught)
+        // the prefix is part of the check digit
+        assert.False(t, IsValidTypedID("inv" + s[3:]))
+        _, err := ParseTypedIDPrefix(TypedID{Prefix: "inv", ID: 1}.String(), "ord")
+        assert.NotNil(t, err, "an invoice id is no order id")
+
+        for _, invalid := range []string{"", "ord", "ord_", "_0000000000010", "Ord_00000000001x", "ord_0000000000!x",
+                "ord_000000000001", "verylongprefix_0000000000010"} {
+                assert.False(t, IsValidTypedID(invalid), "%q should be invalid", invalid)
+        }
+        assert.False(t, ValidTypedIDPrefix("1ord"))
+        assert.True(t, ValidTypedIDPrefix("o2"))
+}
+
+func TestTypedIdsEndpoints(t *testing.T) {
+        router := getTestRouter(t)
+        typedIdList := &TypedIDList{}
+        w := serve(router, "/ns/orders/typedids?type=order")
+        assert.Equal(t, http.StatusOK, w.Code)
+        if err := json.Unmarshal(w.Body.Bytes(), typedIdList); err != nil {
+                t.Fatal("typed id list cannot be unmarshalled")
+        }
+        assert.Equal(t, 1024, len(typedIdList.List))
+        assert.Equal(t, "order", typedIdList.Type)
+        first, err := ParseTypedIDPrefix(typedIdList.List[0], "ord")
+        assert.Nil(t, err)
+        last, _ := ParseTypedIDPrefix(typedIdList.List[1023], "ord")
+        assert.Equal(t, uint64(1023), last.ID - first.ID)
+
+        typedId := &TypedIDResponse{}
+        w = serve(router, "/ns/orders/typedid?type=invoice")
+        json.Unmarshal(w.Body.Bytes(), typedId)
+        _, err = ParseTypedIDPrefix(typedId.ID, "inv")
+        assert.Nil(t, err, typedId.ID)
+
+        w = serve(router, "/ns/orders/typedids?type=customer")
+        assert.Equal(t, http.StatusBadRequest, w.Code)
+        w = serve(router, "/typedids?type=order")
+        assert.Equal(t, http.StatusBadRequest, w.Code, "the default namespace has no types")
+
+        _, err = parseServiceConfig([]byte(`{"namespaces": [{"name": "a", "types": {"order": "Ord"}}]}`))
+        assert.NotNil(t, err, "invalid prefix")
+        _, err = parseServiceConfig([]byte(`{"namespaces": [{"name": "a", "types": {"order": "o", "offer": "o"}}]}`))
+        assert.NotNil(t, err, "shared prefix")
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+        "errors"
+        "strings"
+        "sync"
+        "time"
+)
+
+// ULID is a 128 bit id: 48 bit unix time in msec followed by 80 bits of randomness.
+// The string form is 26 chars of Crockford base32, which sorts in the same order as the ids.
+// See https://github.com/ulid/spec
+type ULID [16]byte
+
+const (
+        ulidEncodedLength = 26
+        ulidEntropyLength = 10
+        ulidMaxTime       = 1<<48 - 1
+)
+
+// crockfordAlphabet is the base32 alphabet without I, L, O and U.
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// MonotonicEntropy hands out ULIDs that increase strictly within the process.
+// Within the same msec the random part of the previous ULID is incremented by one instead of
+// drawing new random bytes. It is safe for concurrent use.
+type MonotonicEntropy struct {
+        mutex   sync.Mutex
+        lastMs  uint64
+        entropy [ulidEntropyLength]byte
+}
+
+// NewMonotonicEntropy returns an entropy source which reads fresh random bytes via generateRandomBytes.
+func NewMonotonicEntropy() *MonotonicEntropy {
+        return &MonotonicEntropy{}
+}
+
+// NewULID returns a ULID for time t. If t is before the time of the previous ULID -- the clock
+// moved backwards or another goroutine got in first -- the previous time is reused so the result
+// still sorts after the previous ULID.
+// It returns an error if the random part of a msec is exhausted or if crypto/rand fails.
+func (m *MonotonicEntropy) NewULID(t time.Time) (ULID, error) {
+        var id ULID
+        ms := uint64(t.UnixNano() / int64(time.Millisecond))
+        if ms > ulidMaxTime {
+                return id, errors.New("time is too large for a ulid")
+        }
+        m.mutex.Lock()
+        defer m.mutex.Unlock()
+        if ms <= m.lastMs && m.lastMs != 0 {
+                ms = m.lastMs
+                if !incrementBytes(m.entropy[:]) {
+                        return id, errors.New("ulid entropy overflow within the same msec")
+                }
+        } else {
+                b, err := generateRandomBytes(ulidEntropyLength)
+                if err != nil {
+                        return id, err
+                }
+                copy(m.entropy[:], b)
+                m.lastMs = ms
+        }
+        for i := 0; i < 6; i++ {
+                id[i] = byte(ms >> uint(40 - 8*i))
+        }
+        copy(id[6:], m.entropy[:])
+        return id, nil
+}
+
+// incrementBytes adds one to the big endian number in b. It returns false on overflow.
+func incrementBytes(b []byte) bool {
+        for i := len(b) - 1; i >= 0; i-- {
+                b[i]++
+                if b[i] != 0 {
+                        return true
+                }
+        }
+        return false
+}
+
+var defaultULIDEntropy = NewMonotonicEntropy()
+
+// GenerateULIDs returns numIds monotonic ULID strings for the current time.
+func GenerateULIDs(numIds int) ([]string, error) {
+        ids := make([]string, 0, numIds)
+        for i := 0; i < numIds; i++ {
+                id, err := defaultULIDEntropy.NewULID(time.Now())
+                if err != nil {
+                        return nil, err
+                }
+                ids = append(ids, id.String())
+        }
+        return ids, nil
+}
+
+// Time returns the msec precision time of the ULID.
+func (id ULID) Time() time.Time {
+        var ms uint64
+        for i := 0; i < 6; i++ {
+                ms = ms << 8 | uint64(id[i])
+        }
+        return time.Unix(0, int64(ms) * int64(time.Millisecond)).UTC()
+}
+
+// String returns the 26 char Crockford base32 form of the ULID.
+func (id ULID) String() string {
+        // 128 bits are encoded in 130 bits, the first char only carries 3 bits.
+        out := make([]byte, ulidEncodedLength)
+        for i := 0; i < ulidEncodedLength; i++ {
+                var v byte
+                for bit := i*5 - 2; bit < i*5 + 3; bit++ {
+                        v <<= 1
+                        if bit >= 0 && id[bit / 8] & (0x80 >> uint(bit % 8)) != 0 {
+                                v |= 1
+                        }
+                }
+                out[i] = crockfordAlphabet[v]
+        }
+        return string(out)
+}
+
+// ParseULID decodes the Crockford base32 form of a ULID. Lower case chars and the
+// Crockford aliases I, L (for 1) and O (for 0) are accepted.
+func ParseULID(s string) (ULID, error) {
+        var id ULID
+        if len(s) != ulidEncodedLength {
+                return id, errors.New("ulid has to be 26 chars long")
+        }
+        for i := 0; i < ulidEncodedLength; i++ {
+                v := crockfordValue(s[i])
+                if v < 0 {
+                        return id, errors.New("invalid char in ulid")
+                }
+                if i == 0 && v > 7 {
+                        return id, errors.New("ulid overflows 128 bits")
+                }
+                for bit := i*5 - 2; bit < i*5 + 3; bit++ {
+                        set := v & (1 << uint(i*5 + 2 - bit)) != 0
+                        if bit >= 0 && set {
+                                id[bit / 8] |= 0x80 >> uint(bit % 8)
+                        }
+                }
+        }
+        return id, nil
+}
+
+// IsValidULID reports whether s is a well formed ULID string.
+func IsValidULID(s string) bool {
+        _, err := ParseULID(s)
+        return err == nil
+}
+
+// crockfordValue returns the value of a Crockford base32 char or -1.
+func crockfordValue(c byte) int {
+        switch c {
+        case 'I', 'i', 'L', 'l':
+                return 1
+        case 'O', 'o':
+                return 0
+        }
+        if c >= 'a' && c <= 'z' {
+                c -= 'a' - 'A'
+        }
+        return strings.IndexByte(crockfordAlphabet, c)
+}
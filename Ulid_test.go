@@ -0,0 +1,96 @@
+package main
+
+import (
+        "testing"
+        "fmt"
+        "sort"
+        "sync"
+        "time"
+        "github.com/stretchr/testify/assert"
+)
+
+func TestULIDRoundTrip(t *testing.T) {
+        entropy := NewMonotonicEntropy()
+        now := time.Now()
+        id, err := entropy.NewULID(now)
+        if err != nil {
+                t.Fatal("ulid not generated")
+        }
+        s := id.String()
+        fmt.Println("ulid:", s)
+        assert.Equal(t, 26, len(s), "ULID length should be 26")
+        parsed, err := ParseULID(s)
+        assert.Nil(t, err, "ULID should parse")
+        assert.Equal(t, id, parsed, "ULID round trip mismatch")
+        assert.Equal(t, now.UnixNano() / int64(time.Millisecond), parsed.Time().UnixNano() / int64(time.Millisecond), "ULID time mismatch")
+}
+
+func TestULIDKnownValue(t *testing.T) {
+        var max ULID
+        for i := range max {
+                max[i] = 0xff
+        }
+        assert.Equal(t, "7ZZZZZZZZZZZZZZZZZZZZZZZZZ", max.String(), "Max ULID mismatch")
+        assert.Equal(t, "00000000000000000000000000", ULID{}.String(), "Zero ULID mismatch")
+
+        id, err := ParseULID("01ARZ3NDEKTSV4RRFFQ69G5FAV")
+        assert.Nil(t, err, "ULID should parse")
+        assert.Equal(t, int64(1469922850259), id.Time().UnixNano() / int64(time.Millisecond), "ULID time mismatch")
+        lower, _ := ParseULID("01arz3ndektsv4rrffq69g5fav")
+        assert.Equal(t, id, lower, "Lower case ULID should parse")
+}
+
+func TestInvalidULID(t *testing.T) {
+        assert.Equal(t, false, IsValidULID("01ARZ3NDEKTSV4RRFFQ69G5FA"), "Short ULID should be invalid")
+        assert.Equal(t, false, IsValidULID("81ARZ3NDEKTSV4RRFFQ69G5FAV"), "Overflowing ULID should be invalid")
+        assert.Equal(t, false, IsValidULID("01ARZ3NDEKTSV4RRFFQ69G5FAU"), "U is not a crockford char")
+        assert.Equal(t, true, IsValidULID("01ARZ3NDEKTSV4RRFFQ69G5FAV"), "ULID should be valid")
+}
+
+func TestULIDMonotonicWithinMsec(t *testing.T) {
+        entropy := NewMonotonicEntropy()
+        now := time.Now()
+        prev, _ := entropy.NewULID(now)
+        for i := 0; i < 1000; i++ {
+                id, err := entropy.NewULID(now)
+                if err != nil {
+                        t.Fatal("ulid not generated")
+                }
+                assert.Equal(t, true, prev.String() < id.String(), "ULIDs should increase within a msec")
+                prev = id
+        }
+        // clock going backwards keeps the order
+        id, _ := entropy.NewULID(now.Add(-time.Second))
+        assert.Equal(t, true, prev.String() < id.String(), "ULIDs should increase when the clock goes back")
+}
+
+func TestULIDInParallel(t *testing.T) {
+        const numGenerator = 10
+        const numID = 1000
+        var wg sync.WaitGroup
+        var mutex sync.Mutex
+        all := make([]string, 0, numGenerator * numID)
+        for i := 0; i < numGenerator; i++ {
+                wg.Add(1)
+                go func() {
+                        defer wg.Done()
+                        ids, err := GenerateULIDs(numID)
+                        if err != nil {
+                                t.Error("ulids not generated")
+                                return
+                        }
+                        assert.Equal(t, true, sort.StringsAreSorted(ids), "ULIDs of a goroutine should be sorted")
+                        mutex.Lock()
+                        all = append(all, ids...)
+                        mutex.Unlock()
+                }()
+        }
+        wg.Wait()
+        seen := map[string]bool{}
+        for _, id := range all {
+                if seen[id] {
+                        t.Fatal("duplicated ulid")
+                }
+                seen[id] = true
+        }
+}
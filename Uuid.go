@@ -0,0 +1,216 @@
+package main
+
+import (
+        "encoding/hex"
+        "errors"
+        "math/big"
+        "strings"
+        "sync"
+        "time"
+)
+
+// UUID is an RFC 9562 UUID. Version 4 is fully random, version 7 starts with the unix time in msec.
+type UUID [16]byte
+
+// UUID string formats.
+const (
+        UUIDFormatCanonical = "canonical" // 8-4-4-4-12 hex digits
+        UUIDFormatCompact   = "compact"   // 32 hex digits
+        UUIDFormatBase62    = "base62"    // 22 base62 digits, sorts like the canonical form
+)
+
+// base62Alphabet is in ascii order, so fixed width base62 strings sort like the numbers they encode.
+const base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+const uuidBase62Length = 22 // 62^22 > 2^128
+
+// NewUUIDv4 returns a random UUID.
+func NewUUIDv4() (UUID, error) {
+        var id UUID
+        b, err := generateRandomBytes(len(id))
+        if err != nil {
+                return id, err
+        }
+        copy(id[:], b)
+        id.setVersion(4)
+        return id, nil
+}
+
+// UUIDv7Generator hands out version 7 UUIDs that increase strictly within the process.
+// The 74 bits after the timestamp start random in every msec and are incremented by one for
+// every further UUID of the same msec. When they run out the msec is borrowed from the future.
+// It is safe for concurrent use.
+type UUIDv7Generator struct {
+        mutex  sync.Mutex
+        lastMs uint64
+        randA  uint16 // 12 bits
+        randB  uint64 // 62 bits
+}
+
+// NewUUIDv7Generator returns a generator which reads random bits via generateRandomBytes.
+func NewUUIDv7Generator() *UUIDv7Generator {
+        return &UUIDv7Generator{}
+}
+
+// NewUUID returns a version 7 UUID for time t, greater than every UUID returned before.
+func (g *UUIDv7Generator) NewUUID(t time.Time) (UUID, error) {
+        ms := uint64(t.UnixNano() / int64(time.Millisecond))
+        g.mutex.Lock()
+        defer g.mutex.Unlock()
+        if ms <= g.lastMs {
+                ms = g.lastMs
+                g.randB = (g.randB + 1) & (1 << 62 - 1)
+                if g.randB == 0 {
+                        g.randA = (g.randA + 1) & (1 << 12 - 1)
+                        if g.randA == 0 {
+                                ms++
+                        }
+                }
+        }
+        if ms != g.lastMs {
+                b, err := generateRandomBytes(10)
+                if err != nil {
+                        return UUID{}, err
+                }
+                // keep the top bit of the counter clear so a few increments never overflow
+                g.randA = (uint16(b[0]) << 8 | uint16(b[1])) & (1 << 11 - 1)
+                g.randB = 0
+                for _, v := range b[2:] {
+                        g.randB = g.randB << 8 | uint64(v)
+                }
+                g.randB &= 1 << 62 - 1
+                g.lastMs = ms
+        }
+        if ms >= 1 << 48 {
+                return UUID{}, errors.New("time is too large for a uuid v7")
+        }
+
+        var id UUID
+        for i := 0; i < 6; i++ {
+                id[i] = byte(ms >> uint(40 - 8*i))
+        }
+        id[6] = byte(g.randA >> 8)
+        id[7] = byte(g.randA)
+        for i := 0; i < 8; i++ {
+                id[8 + i] = byte(g.randB >> uint(56 - 8*i))
+        }
+        id.setVersion(7)
+        return id, nil
+}
+
+var defaultUUIDv7Generator = NewUUIDv7Generator()
+
+// GenerateUUIDs returns numIds UUIDs of the given version (4 or 7) in the given format.
+func GenerateUUIDs(version int, numIds int, format string) ([]string, error) {
+        if version != 4 && version != 7 {
+                return nil, errors.New("unsupported uuid version")
+        }
+        ids := make([]string, 0, numIds)
+        for i := 0; i < numIds; i++ {
+                var id UUID
+                var err error
+                if version == 4 {
+                        id, err = NewUUIDv4()
+                } else {
+                        id, err = defaultUUIDv7Generator.NewUUID(time.Now())
+                }
+                if err != nil {
+                        return nil, err
+                }
+                s, err := id.Format(format)
+                if err != nil {
+                        return nil, err
+                }
+                ids = append(ids, s)
+        }
+        return ids, nil
+}
+
+// setVersion sets the version nibble and the 10 variant bits.
+func (id *UUID) setVersion(version byte) {
+        id[6] = id[6] & 0x0f | version << 4
+        id[8] = id[8] & 0x3f | 0x80
+}
+
+// Version returns the version nibble of the UUID.
+func (id UUID) Version() int {
+        return int(id[6] >> 4)
+}
+
+// Variant returns the two variant bits, 2 (binary 10) for RFC 9562 UUIDs.
+func (id UUID) Variant() int {
+        return int(id[8] >> 6)
+}
+
+// Time returns the msec precision time of a version 7 UUID.
+func (id UUID) Time() time.Time {
+        var ms uint64
+        for i := 0; i < 6; i++ {
+                ms = ms << 8 | uint64(id[i])
+        }
+        return time.Unix(0, int64(ms) * int64(time.Millisecond)).UTC()
+}
+
+// String returns the canonical hyphenated form.
+func (id UUID) String() string {
+        h := hex.EncodeToString(id[:])
+        return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// Format returns the UUID as a canonical, compact or base62 string.
+func (id UUID) Format(format string) (string, error) {
+        switch format {
+        case "", UUIDFormatCanonical:
+                return id.String(), nil
+        case UUIDFormatCompact:
+                return hex.EncodeToString(id[:]), nil
+        case UUIDFormatBase62:
+                n := new(big.Int).SetBytes(id[:])
+                base := big.NewInt(62)
+                mod := new(big.Int)
+                out := []byte(strings.Repeat("0", uuidBase62Length))
+                for i := uuidBase62Length - 1; n.Sign() > 0; i-- {
+                        n.DivMod(n, base, mod)
+                        out[i] = base62Alphabet[mod.Int64()]
+                }
+                return string(out), nil
+        }
+        return "", errors.New("unknown uuid format " + format)
+}
+
+// ParseUUID accepts the canonical, compact and base62 forms.
+func ParseUUID(s string) (UUID, error) {
+        var id UUID
+        switch len(s) {
+        case 36:
+                if s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+                        return id, errors.New("invalid uuid")
+                }
+                s = s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:]
+                fallthrough
+        case 32:
+                b, err := hex.DecodeString(s)
+                if err != nil {
+                        return id, errors.New("invalid uuid")
+                }
+                copy(id[:], b)
+                return id, nil
+        case uuidBase62Length:
+                n := new(big.Int)
+                base := big.NewInt(62)
+                for i := 0; i < len(s); i++ {
+                        v := strings.IndexByte(base62Alphabet, s[i])
+                        if v < 0 {
+                                return id, errors.New("invalid uuid")
+                        }
+                        n.Mul(n, base)
+                        n.Add(n, big.NewInt(int64(v)))
+                }
+                if n.BitLen() > 128 {
+                        return id, errors.New("invalid uuid")
+                }
+                n.FillBytes(id[:])
+                return id, nil
+        }
+        return id, errors.New("invalid uuid length")
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+        "testing"
+        "fmt"
+        "sort"
+        "strings"
+        "time"
+        "github.com/stretchr/testify/assert"
+)
+
+func TestUUIDv4Bits(t *testing.T) {
+        for i := 0; i < 1000; i++ {
+                id, err := NewUUIDv4()
+                if err != nil {
+                        t.Fatal("uuid not generated")
+                }
+                assert.Equal(t, 4, id.Version(), "Version mismatch")
+                assert.Equal(t, 2, id.Variant(), "Variant mismatch")
+                s := id.String()
+                assert.Equal(t, byte('4'), s[14], "Version digit mismatch")
+                assert.Condition(t, func() bool { return strings.IndexByte("89ab", s[19]) >= 0 }, "Variant digit mismatch")
+        }
+}
+
+func TestUUIDv7Bits(t *testing.T) {
+        g := NewUUIDv7Generator()
+        now := time.Now()
+        id, err := g.NewUUID(now)
+        if err != nil {
+                t.Fatal("uuid not generated")
+        }
+        fmt.Println("uuid v7:", id)
+        assert.Equal(t, 7, id.Version(), "Version mismatch")
+        assert.Equal(t, 2, id.Variant(), "Variant mismatch")
+        assert.Equal(t, now.UnixNano() / int64(time.Millisecond), id.Time().UnixNano() / int64(time.Millisecond), "Time mismatch")
+}
+
+func TestUUIDv7Monotonic(t *testing.T) {
+        g := NewUUIDv7Generator()
+        now := time.Now()
+        prev, _ := g.NewUUID(now)
+        for i := 0; i < 10000; i++ {
+                id, err := g.NewUUID(now)
+                if err != nil {
+                        t.Fatal("uuid not generated")
+                }
+                if prev.String() >= id.String() {
+                        t.Fatal("uuid v7 not increasing")
+                }
+                assert.Equal(t, 7, id.Version(), "Version mismatch")
+                assert.Equal(t, 2, id.Variant(), "Variant mismatch")
+                prev = id
+        }
+        // clock going backwards keeps the order
+        id, _ := g.NewUUID(now.Add(-time.Minute))
+        assert.Equal(t, true, prev.String() < id.String(), "UUIDs should increase when the clock goes back")
+}
+
+func TestUUIDv7CounterOverflow(t *testing.T) {
+        g := NewUUIDv7Generator()
+        now := time.Now()
+        first, _ := g.NewUUID(now)
+        g.randA = 1 << 12 - 1
+        g.randB = 1 << 62 - 1
+        id, _ := g.NewUUID(now)
+        assert.Equal(t, true, first.String() < id.String(), "UUIDs should increase on overflow")
+        assert.Equal(t, first.Time().Add(time.Millisecond), id.Time(), "Overflow should borrow the next msec")
+}
+
+func TestUUIDFormats(t *testing.T) {
+        ids, err := GenerateUUIDs(7, 100, UUIDFormatBase62)
+        if err != nil {
+                t.Fatal("uuids not generated")
+        }
+        assert.Equal(t, true, sort.StringsAreSorted(ids), "Base62 UUIDs should be sorted")
+        for _, s := range ids {
+                assert.Equal(t, 22, len(s), "Base62 length mismatch")
+                id, err := ParseUUID(s)
+                assert.Nil(t, err, "Base62 UUID should parse")
+                assert.Equal(t, 7, id.Version(), "Version mismatch")
+                canonical, _ := id.Format(UUIDFormatCanonical)
+                compact, _ := id.Format(UUIDFormatCompact)
+                assert.Equal(t, 36, len(canonical), "Canonical length mismatch")
+                assert.Equal(t, 32, len(compact), "Compact length mismatch")
+                fromCanonical, _ := ParseUUID(canonical)
+                fromCompact, _ := ParseUUID(compact)
+                assert.Equal(t, id, fromCanonical, "Canonical round trip mismatch")
+                assert.Equal(t, id, fromCompact, "Compact round trip mismatch")
+        }
+        var max UUID
+        for i := range max {
+                max[i] = 0xff
+        }
+        s, _ := max.Format(UUIDFormatBase62)
+        assert.Equal(t, "7n42DGM5Tflk9n8mt7Fhc7", s, "Max base62 mismatch")
+
+        _, err = GenerateUUIDs(5, 1, UUIDFormatCanonical)
+        assert.NotNil(t, err, "Version 5 is not supported")
+        _, err = ParseUUID("not-a-uuid")
+        assert.NotNil(t, err, "Invalid uuid should not parse")
+}
@@ -0,0 +1,206 @@
+// Package client reads the /info endpoint of a unique id service and decodes its ids with the epoch, layout and
+// time unit the service reports, so callers need not hard-code the settings of the server.
+//
+//     c := client.New("http://uniqueid:8080")
+//     parts, err := c.Decompose(ctx, id)
+//     fmt.Println(parts.Time, parts.MachineID, parts.Sequence)
+package client
+
+import (
+        "context"
+        "encoding/json"
+        "fmt"
+        "io"
+        "net/http"
+        "strings"
+        "sync"
+        "time"
+)
+
+// Layout is the bit length of each id part, from MSB to LSB: Time-MachineID-Sequence.
+type Layout struct {
+        BitLenTime      uint8 `json:"bit_len_time"`
+        BitLenMachineID uint8 `json:"bit_len_machine_id"`
+        BitLenSequence  uint8 `json:"bit_len_sequence"`
+}
+
+// Valid reports whether the parts add up to the 63 usable bits, with at most 16 bits of machine id and sequence.
+func (l Layout) Valid() bool {
+        return l.BitLenTime > 0 && l.BitLenSequence > 0 &&
+                l.BitLenMachineID <= 16 && l.BitLenSequence <= 16 &&
+                int(l.BitLenTime) + int(l.BitLenMachineID) + int(l.BitLenSequence) == 63
+}
+
+// NamespaceInfo describes the generator of a namespace. StartTime, TimeUnit and Layout are only set for the
+// snowflake strategy.
+type NamespaceInfo struct {
+        Name             string     `json:"name"`
+        Strategy         string     `json:"strategy"`
+        RangeSize        int        `json:"range_size"`
+        MachineID        uint16     `json:"machine_id"`
+        MachineIDSource  string     `json:"machine_id_source"`
+        StartTime        *time.Time `json:"start_time"`
+        TimeUnit         string     `json:"time_unit"`
+        Layout           *Layout    `json:"layout"`
+        OverflowTime     *time.Time `json:"overflow_time"`
+        RemainingSeconds int64      `json:"remaining_seconds"`
+}
+
+// Info is the response of /info: the default generator at the top level and every namespace in Namespaces.
+type Info struct {
+        NamespaceInfo
+        Version       string          `json:"version"`
+        Commit        string          `json:"commit"`
+        StartedAt     time.Time       `json:"started_at"`
+        UptimeSeconds int64           `json:"uptime_seconds"`
+        Namespaces    []NamespaceInfo `json:"namespaces"`
+}
+
+// Namespace returns the info of the named namespace.
+func (info *Info) Namespace(name string) (*NamespaceInfo, bool) {
+        for i := range info.Namespaces {
+                if info.Namespaces[i].Name == name {
+                        return &info.Namespaces[i], true
+                }
+        }
+        return nil, false
+}
+
+// Decoder takes apart the ids of a snowflake namespace.
+type Decoder struct {
+        Layout    Layout
+        StartTime time.Time
+        TimeUnit  time.Duration
+}
+
+// Parts are the parts of an id. Time is the start of the tick the id was issued in.
+type Parts struct {
+        ID        uint64
+        Time      time.Time
+        Elapsed   uint64 // ticks since StartTime
+        MachineID uint16
+        Sequence  uint16
+}
+
+// NewDecoder returns the decoder of a namespace, an error if its ids carry no time.
+func NewDecoder(info *NamespaceInfo) (*Decoder, error) {
+        if info.Layout == nil || info.StartTime == nil || info.TimeUnit == "" {
+                return nil, fmt.Errorf("ids of the %s strategy cannot be decomposed", info.Strategy)
+        }
+        unit, err := time.ParseDuration(info.TimeUnit)
+        if err != nil || unit <= 0 {
+                return nil, fmt.Errorf("invalid time unit %q", info.TimeUnit)
+        }
+        return &Decoder{Layout: *info.Layout, StartTime: *info.StartTime, TimeUnit: unit}, nil
+}
+
+// Decompose returns the parts of an id.
+func (d *Decoder) Decompose(id uint64) Parts {
+        l := d.Layout
+        elapsed := id >> (l.BitLenSequence + l.BitLenMachineID) & (1 << l.BitLenTime - 1)
+        return Parts{
+                ID:        id,
+                Time:      TickTime(d.StartTime, d.TimeUnit, elapsed),
+                Elapsed:   elapsed,
+                MachineID: uint16(id >> l.BitLenSequence & (1 << l.BitLenMachineID - 1)),
+                Sequence:  uint16(id & (1 << l.BitLenSequence - 1)),
+        }
+}
+
+// TickTime returns the wall clock time at which the tick elapsed ticks after startTime begins,
+// rounding startTime down to the time unit like the service does.
+func TickTime(startTime time.Time, timeUnit time.Duration, elapsed uint64) time.Time {
+        unit := int64(timeUnit)
+        return time.Unix(0, (startTime.UnixNano() / unit + int64(elapsed)) * unit).UTC()
+}
+
+// Client talks to a unique id service. The info of the service is fetched once and cached.
+type Client struct {
+        BaseURL    string
+        APIKey     string // sent in the X-API-Key header if set
+        HTTPClient *http.Client
+
+        mutex sync.Mutex
+        info  *Info
+}
+
+// New returns a client of the service at baseURL, e.g. "http://uniqueid:8080".
+func New(baseURL string) *Client {
+        return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), HTTPClient: &http.Client{Timeout: 5 * time.Second}}
+}
+
+// Info returns the info of the service, fetching it on the first call.
+func (c *Client) Info(ctx context.Context) (*Info, error) {
+        c.mutex.Lock()
+        defer c.mutex.Unlock()
+        if c.info != nil {
+                return c.info, nil
+        }
+        info := &Info{}
+        if err := c.get(ctx, "/info", info); err != nil {
+                return nil, err
+        }
+        c.info = info
+        return info, nil
+}
+
+// Decoder returns the decoder of the default generator, the one behind /longids.
+func (c *Client) Decoder(ctx context.Context) (*Decoder, error) {
+        info, err := c.Info(ctx)
+        if err != nil {
+                return nil, err
+        }
+        return NewDecoder(&info.NamespaceInfo)
+}
+
+// NamespaceDecoder returns the decoder of a namespace.
+func (c *Client) NamespaceDecoder(ctx context.Context, name string) (*Decoder, error) {
+        info, err := c.Info(ctx)
+        if err != nil {
+                return nil, err
+        }
+        ns, ok := info.Namespace(name)
+        if !ok {
+                return nil, fmt.Errorf("unknown namespace %q", name)
+        }
+        return NewDecoder(ns)
+}
+
+// Decompose returns the parts of an id of the default generator.
+func (c *Client) Decompose(ctx context.Context, id uint64) (Parts, error) {
+        d, err := c.Decoder(ctx)
+        if err != nil {
+                return Parts{}, err
+        }
+        return d.Decompose(id), nil
+}
+
+func (c *Client) get(ctx context.Context, path string, v interface{}) error {
+        req, err := http.NewRequestWithContext(ctx, "GET", c.BaseURL + path, nil)
+        if err != nil {
+                return err
+        }
+        if c.APIKey != "" {
+                req.Header.Set("X-API-Key", c.APIKey)
+        }
+        httpClient := c.HTTPClient
+        if httpClient == nil {
+                httpClient = http.DefaultClient
+        }
+        resp, err := httpClient.Do(req)
+        if err != nil {
+                return err
+        }
+        defer resp.Body.Close()
+        body, err := io.ReadAll(resp.Body)
+        if err != nil {
+                return err
+        }
+        if resp.StatusCode != http.StatusOK {
+                return fmt.Errorf("GET %s: status %d", path, resp.StatusCode)
+        }
+        if err := json.Unmarshal(body, v); err != nil {
+                return fmt.Errorf("GET %s: %v", path, err)
+        }
+        return nil
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+        "context"
+        "net/http"
+        "net/http/httptest"
+        "testing"
+        "time"
+        "github.com/stretchr/testify/assert"
+)
+
+// infoBody is the /info of a service with the default generator and a ticket namespace.
+const infoBody = `{"name": "default", "strategy": "snowflake", "range_size": 256, "machine_id": 321,
+        "machine_id_source": "pod_ip", "start_time": "2016-01-01T00:00:00Z", "time_unit": "10ms",
+        "layout": {"bit_len_time": 39, "bit_len_machine_id": 16, "bit_len_sequence": 8},
+        "overflow_time": "2190-03-18T03:28:58.88Z", "remaining_seconds": 5156746284,
+        "version": "1.4.0", "commit": "abc123", "started_at": "2026-10-19T12:00:00Z", "uptime_seconds": 60,
+        "namespaces": [
+                {"name": "default", "strategy": "snowflake", "range_size": 256, "machine_id": 321,
+                 "machine_id_source": "pod_ip", "start_time": "2016-01-01T00:00:00Z", "time_unit": "10ms",
+                 "layout": {"bit_len_time": 39, "bit_len_machine_id": 16, "bit_len_sequence": 8}},
+                {"name": "orders", "strategy": "snowflake", "range_size": 1024, "machine_id": 321,
+                 "start_time": "2020-01-01T00:00:00Z", "time_unit": "1ms",
+                 "layout": {"bit_len_time": 41, "bit_len_machine_id": 12, "bit_len_sequence": 10}},
+                {"name": "invoices", "strategy": "ticket", "range_size": 256, "machine_id": 0}]}`
+
+func newInfoServer(t *testing.T) (*httptest.Server, *int) {
+        requests := 0
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                if r.URL.Path != "/info" {
+                        http.NotFound(w, r)
+                        return
+                }
+                requests++
+                assert.Equal(t, "secret", r.Header.Get("X-API-Key"))
+                w.Write([]byte(infoBody))
+        }))
+        t.Cleanup(server.Close)
+        return server, &requests
+}
+
+func TestDecompose(t *testing.T) {
+        server, requests := newInfoServer(t)
+        c := New(server.URL + "/")
+        c.APIKey = "secret"
+        ctx := context.Background()
+
+        // 100 seconds after the epoch, machine 321, sequence 7
+        id := uint64(10000) << 24 | uint64(321) << 8 | 7
+        parts, err := c.Decompose(ctx, id)
+        assert.Nil(t, err)
+        assert.Equal(t, Parts{ID: id, Time: time.Date(2016, 1, 1, 0, 1, 40, 0, time.UTC), Elapsed: 10000,
+                MachineID: 321, Sequence: 7}, parts)
+
+        info, err := c.Info(ctx)
+        assert.Nil(t, err)
+        assert.Equal(t, "1.4.0", info.Version)
+        assert.Equal(t, "pod_ip", info.MachineIDSource)
+        assert.Equal(t, 1, *requests, "the info is cached")
+
+        d, err := c.NamespaceDecoder(ctx, "orders")
+        assert.Nil(t, err)
+        parts = d.Decompose(uint64(1500) << 22 | uint64(5) << 10 | 1023)
+        assert.Equal(t, time.Date(2020, 1, 1, 0, 0, 1, 500000000, time.UTC), parts.Time)
+        assert.Equal(t, uint16(5), parts.MachineID)
+        assert.Equal(t, uint16(1023), parts.Sequence)
+
+        _, err = c.NamespaceDecoder(ctx, "invoices")
+        assert.NotNil(t, err, "ticket ids carry no time")
+        _, err = c.NamespaceDecoder(ctx, "payments")
+        assert.NotNil(t, err)
+}
+
+func TestInfoErrors(t *testing.T) {
+        server, _ := newInfoServer(t)
+        c := New(server.URL + "/missing")
+        _, err := c.Info(context.Background())
+        assert.NotNil(t, err)
+}
@@ -0,0 +1,132 @@
+package client
+
+import (
+        "errors"
+        "strconv"
+        "strings"
+)
+
+// String formats of 64 bit ids, the format param of the id endpoints. JSON numbers above 2^53 lose precision in
+// javascript, so clients can ask for one of the string formats instead.
+// Apart from decimal every format has a fixed width and an alphabet in ascii order, so the strings
+// sort in the same order as the ids.
+const (
+        FormatNumber  = "number"  // JSON number, the default
+        FormatDecimal = "decimal" // decimal string without leading zeros, does not sort like the ids
+        FormatHex     = "hex"     // 16 lower case hex digits
+        FormatBase32  = "base32"  // 13 Crockford base32 digits
+        FormatBase58  = "base58"  // 11 base58 (bitcoin alphabet) digits
+        FormatBase62  = "base62"  // 11 base62 digits
+)
+
+const (
+        crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+        base58Alphabet    = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+        base62Alphabet    = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+type idEncoding struct {
+        alphabet string
+        width    int
+}
+
+var idEncodings = map[string]idEncoding{
+        FormatHex:    {"0123456789abcdef", 16},
+        FormatBase32: {crockfordAlphabet, 13},
+        FormatBase58: {base58Alphabet, 11},
+        FormatBase62: {base62Alphabet, 11},
+}
+
+// ValidFormat reports whether format is one of the Format constants.
+func ValidFormat(format string) bool {
+        _, ok := idEncodings[format]
+        return ok || format == FormatNumber || format == FormatDecimal
+}
+
+// Encode returns the id in the given string format. For FormatNumber the decimal form is returned.
+func Encode(id uint64, format string) (string, error) {
+        if format == FormatNumber || format == FormatDecimal {
+                return strconv.FormatUint(id, 10), nil
+        }
+        enc, ok := idEncodings[format]
+        if !ok {
+                return "", errors.New("unknown id format " + format)
+        }
+        base := uint64(len(enc.alphabet))
+        out := make([]byte, enc.width)
+        for i := enc.width - 1; i >= 0; i-- {
+                out[i] = enc.alphabet[id % base]
+                id /= base
+        }
+        return string(out), nil
+}
+
+// Decode parses a string produced by Encode. Leading zero digits may be left out, hex and base32 ignore case
+// and base32 reads I and L as 1 and O as 0.
+func Decode(s string, format string) (uint64, error) {
+        if format == FormatNumber || format == FormatDecimal {
+                return strconv.ParseUint(s, 10, 64)
+        }
+        enc, ok := idEncodings[format]
+        if !ok {
+                return 0, errors.New("unknown id format " + format)
+        }
+        if s == "" || len(s) > enc.width {
+                return 0, errors.New("invalid " + format + " id length")
+        }
+        base := uint64(len(enc.alphabet))
+        var id uint64
+        for i := 0; i < len(s); i++ {
+                var v int
+                switch format {
+                case FormatBase32:
+                        v = crockfordValue(s[i])
+                case FormatHex:
+                        v = strings.IndexByte(enc.alphabet, lowerASCII(s[i]))
+                default:
+                        v = strings.IndexByte(enc.alphabet, s[i])
+                }
+                if v < 0 {
+                        return 0, errors.New("invalid char in " + format + " id")
+                }
+                if id > (^uint64(0) - uint64(v)) / base {
+                        return 0, errors.New(format + " id overflows 64 bits")
+                }
+                id = id * base + uint64(v)
+        }
+        return id, nil
+}
+
+// EncodeIDs returns the ids in the given string format.
+func EncodeIDs(ids []uint64, format string) ([]string, error) {
+        list := make([]string, 0, len(ids))
+        for _, id := range ids {
+                s, err := Encode(id, format)
+                if err != nil {
+                        return nil, err
+                }
+                list = append(list, s)
+        }
+        return list, nil
+}
+
+func lowerASCII(c byte) byte {
+        if c >= 'A' && c <= 'Z' {
+                return c + 'a' - 'A'
+        }
+        return c
+}
+
+// crockfordValue returns the value of a Crockford base32 char or -1.
+func crockfordValue(c byte) int {
+        switch c {
+        case 'I', 'i', 'L', 'l':
+                return 1
+        case 'O', 'o':
+                return 0
+        }
+        if c >= 'a' && c <= 'z' {
+                c -= 'a' - 'A'
+        }
+        return strings.IndexByte(crockfordAlphabet, c)
+}
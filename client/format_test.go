@@ -0,0 +1,24 @@
+package client
+
+import (
+        "testing"
+        "github.com/stretchr/testify/assert"
+)
+
+func TestFormats(t *testing.T) {
+        for format, want := range map[string]string{FormatNumber: "255", FormatDecimal: "255", FormatHex: "00000000000000ff",
+                FormatBase32: "000000000007Z", FormatBase58: "1111111115Q", FormatBase62: "00000000047"} {
+                s, err := Encode(255, format)
+                assert.Nil(t, err, format)
+                assert.Equal(t, want, s, format)
+                id, err := Decode(s, format)
+                assert.Nil(t, err, format)
+                assert.Equal(t, uint64(255), id, format)
+        }
+        id, err := Decode("7zil", FormatBase32)
+        assert.Nil(t, err, "base32 ignores case and reads i and l as 1")
+        assert.Equal(t, uint64(7 << 15 | 31 << 10 | 1 << 5 | 1), id, "base32 mismatch")
+        _, err = Encode(1, "base64")
+        assert.NotNil(t, err, "unknown format")
+        assert.False(t, ValidFormat("base64"), "unknown format")
+}
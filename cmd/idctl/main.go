@@ -0,0 +1,278 @@
+// Command idctl mints and inspects ids without a server: it mints the ids of the current tick with the layout and
+// epoch of a generator, takes ids apart, converts them between the string formats and prints random string ids.
+//
+//     go run ./cmd/idctl gen -kind range -machine-id 7
+//     go run ./cmd/idctl decode -server http://uniqueid:8080 -ns orders -format base62 0BQ7FFM1fnN
+package main
+
+import (
+        "context"
+        "flag"
+        "fmt"
+        "io"
+        "os"
+        "sort"
+        "strconv"
+        "time"
+        "github.com/spinaki/distributed-unique-id/client"
+        "github.com/spinaki/distributed-unique-id/internal/cli"
+        "github.com/spinaki/distributed-unique-id/stringid"
+)
+
+var commands = map[string]cli.Command{
+        "gen":      {"gen [-kind id|list|range] [-format number] [generator flags] [-o json|table]", genCommand},
+        "decode":   {"decode [-format number] [generator flags | -server url [-ns name]] [-o json|table] <id>...", decodeCommand},
+        "encode":   {"encode [-from number] [-to base62] [-o json|table] <id>...", encodeCommand},
+        "stringid": {"stringid [-num 1] [-len 32] [-padding=false] [-alphabet name -size 21] [-o json|table]", stringIdCommand},
+}
+
+// run runs the command named by the first arg.
+func run(args []string, stdout io.Writer) error {
+        if len(args) == 0 {
+                return fmt.Errorf("idctl needs a command")
+        }
+        cmd, ok := commands[args[0]]
+        if !ok {
+                names := make([]string, 0, len(commands))
+                for name := range commands {
+                        names = append(names, name)
+                }
+                sort.Strings(names)
+                return fmt.Errorf("unknown idctl command %q, commands: %v", args[0], names)
+        }
+        if err := cmd.Run(args[1:], stdout); err != nil {
+                return fmt.Errorf("%v\nusage: idctl %s", err, cmd.Usage)
+        }
+        return nil
+}
+
+// MintedIDs is the output of gen, shaped like the body of /longid, /longids or /longidrange: the ids are JSON
+// numbers, or strings in Format.
+type MintedIDs struct {
+        ID         interface{}   `json:"id,omitempty"`
+        List       []interface{} `json:"id_list,omitempty"`
+        LowerBound interface{}   `json:"lower_bound,omitempty"`
+        UpperBound interface{}   `json:"upper_bound,omitempty"`
+        MachineID  uint16        `json:"machine_id"`
+        Format     string        `json:"format,omitempty"`
+}
+
+// genCommand mints an id, a list or a range of the current tick, the ids a generator configured by the flags
+// hands out first after it started. Every run starts afresh, so two runs within a tick mint the same ids.
+func genCommand(args []string, stdout io.Writer) error {
+        flags := flag.NewFlagSet("gen", flag.ContinueOnError)
+        kind := flags.String("kind", "id", "id, list or range")
+        format := flags.String("format", client.FormatNumber, "format of the ids: number, decimal, hex, base32, base58 or base62")
+        output := flags.String("o", "json", "output: json or table")
+        generator := cli.AddGeneratorFlags(flags)
+        generator.AddMachineIDFlag(flags)
+        if err := flags.Parse(args); err != nil {
+                return err
+        }
+        if !client.ValidFormat(*format) {
+                return fmt.Errorf("unknown format %q", *format)
+        }
+        d, err := generator.Decoder()
+        if err != nil {
+                return err
+        }
+        machineID, err := generator.MachineID(d.Layout)
+        if err != nil {
+                return err
+        }
+        unit := int64(d.TimeUnit)
+        tick := time.Now().UnixNano() / unit - d.StartTime.UnixNano() / unit
+        if tick < 0 {
+                return fmt.Errorf("the epoch %s is in the future", *generator.Epoch)
+        }
+        if tick >= 1 << d.Layout.BitLenTime {
+                return fmt.Errorf("the ids of the epoch %s have overflown", *generator.Epoch)
+        }
+        first := uint64(tick) << (d.Layout.BitLenMachineID + d.Layout.BitLenSequence) |
+                uint64(machineID) << d.Layout.BitLenSequence
+
+        var ids []uint64
+        switch *kind {
+        case "id":
+                ids = []uint64{first}
+        case "list", "range":
+                ids = make([]uint64, 1 << d.Layout.BitLenSequence)
+                for i := range ids {
+                        ids[i] = first + uint64(i)
+                }
+        default:
+                return fmt.Errorf("unknown kind %q, use id, list or range", *kind)
+        }
+        encoded, err := client.EncodeIDs(ids, *format)
+        if err != nil {
+                return err
+        }
+        value := func(i int) interface{} {
+                if *format == client.FormatNumber {
+                        return ids[i]
+                }
+                return encoded[i]
+        }
+        minted := &MintedIDs{MachineID: machineID}
+        if *format != client.FormatNumber {
+                minted.Format = *format
+        }
+        rows := [][]string{{"ID", "MACHINE ID"}}
+        switch *kind {
+        case "id":
+                minted.ID = value(0)
+                rows = append(rows, []string{encoded[0], strconv.Itoa(int(machineID))})
+        case "list":
+                for i := range ids {
+                        minted.List = append(minted.List, value(i))
+                        rows = append(rows, []string{encoded[i], strconv.Itoa(int(machineID))})
+                }
+        case "range":
+                minted.LowerBound, minted.UpperBound = value(0), value(len(ids) - 1)
+                rows = [][]string{{"LOWER BOUND", "UPPER BOUND", "MACHINE ID"},
+                        {encoded[0], encoded[len(ids) - 1], strconv.Itoa(int(machineID))}}
+        }
+        return cli.PrintOutput(stdout, *output, minted, rows)
+}
+
+// DecodedID is an id split into its parts, with the wall clock time of its tick.
+type DecodedID struct {
+        ID        uint64    `json:"id"`
+        Time      uint64    `json:"time"`
+        MachineID uint64    `json:"machine_id"`
+        Sequence  uint64    `json:"sequence"`
+        Timestamp time.Time `json:"timestamp"`
+}
+
+// decodeCommand prints the parts of ids built by a generator described by the flags, or by the /info of a server.
+func decodeCommand(args []string, stdout io.Writer) error {
+        flags := flag.NewFlagSet("decode", flag.ContinueOnError)
+        format := flags.String("format", client.FormatNumber, "format of the ids: number, decimal, hex, base32, base58 or base62")
+        output := flags.String("o", "json", "output: json or table")
+        server := flags.String("server", "", "url of a running service, its /info replaces the generator flags")
+        namespace := flags.String("ns", "default", "namespace of the ids on the server")
+        generator := cli.AddGeneratorFlags(flags)
+        if err := flags.Parse(args); err != nil {
+                return err
+        }
+        if flags.NArg() == 0 {
+                return fmt.Errorf("decode needs at least one id")
+        }
+        d, err := generator.Decoder()
+        if err != nil {
+                return err
+        }
+        if *server != "" {
+                if d, err = client.New(*server).NamespaceDecoder(context.Background(), *namespace); err != nil {
+                        return err
+                }
+        }
+        decoded := make([]DecodedID, 0, flags.NArg())
+        rows := [][]string{{"ID", "TIME", "MACHINE ID", "SEQUENCE", "TIMESTAMP"}}
+        for _, s := range flags.Args() {
+                id, err := client.Decode(s, *format)
+                if err != nil {
+                        return err
+                }
+                parts := d.Decompose(id)
+                decodedID := DecodedID{ID: id, Time: parts.Elapsed, MachineID: uint64(parts.MachineID),
+                        Sequence: uint64(parts.Sequence), Timestamp: parts.Time}
+                decoded = append(decoded, decodedID)
+                rows = append(rows, []string{s, strconv.FormatUint(decodedID.Time, 10), strconv.FormatUint(decodedID.MachineID, 10),
+                        strconv.FormatUint(decodedID.Sequence, 10), decodedID.Timestamp.Format(time.RFC3339Nano)})
+        }
+        if len(decoded) == 1 {
+                return cli.PrintOutput(stdout, *output, decoded[0], rows)
+        }
+        return cli.PrintOutput(stdout, *output, decoded, rows)
+}
+
+// ConvertedID is an id in two formats.
+type ConvertedID struct {
+        From string `json:"from"`
+        To   string `json:"to"`
+}
+
+// encodeCommand converts ids between the numeric and string formats.
+func encodeCommand(args []string, stdout io.Writer) error {
+        flags := flag.NewFlagSet("encode", flag.ContinueOnError)
+        from := flags.String("from", client.FormatNumber, "format of the input ids")
+        to := flags.String("to", client.FormatBase62, "format of the output ids")
+        output := flags.String("o", "json", "output: json or table")
+        if err := flags.Parse(args); err != nil {
+                return err
+        }
+        if flags.NArg() == 0 {
+                return fmt.Errorf("encode needs at least one id")
+        }
+        converted := make([]ConvertedID, 0, flags.NArg())
+        rows := [][]string{{*from, *to}}
+        for _, s := range flags.Args() {
+                id, err := client.Decode(s, *from)
+                if err != nil {
+                        return err
+                }
+                encoded, err := client.Encode(id, *to)
+                if err != nil {
+                        return err
+                }
+                converted = append(converted, ConvertedID{From: s, To: encoded})
+                rows = append(rows, []string{s, encoded})
+        }
+        return cli.PrintOutput(stdout, *output, converted, rows)
+}
+
+// StringIDList is the output of stringid, shaped like the body of /stringids.
+type StringIDList struct {
+        List []string `json:"id_list"`
+}
+
+// stringIdCommand prints random string ids with the same parameters as /stringids.
+func stringIdCommand(args []string, stdout io.Writer) error {
+        flags := flag.NewFlagSet("stringid", flag.ContinueOnError)
+        num := flags.Int("num", 1, "number of ids")
+        length := flags.Int("len", 32, "random bytes of a base64 id")
+        padding := flags.Bool("padding", true, "keep the base64 padding")
+        alphabet := flags.String("alphabet", "", "preset name or characters, switches to ids of -size characters")
+        size := flags.Int("size", 0, "characters of an alphabet id")
+        output := flags.String("o", "json", "output: json or table")
+        if err := flags.Parse(args); err != nil {
+                return err
+        }
+        if *num < 1 {
+                return fmt.Errorf("num has to be positive")
+        }
+        strIdList := &StringIDList{}
+        var err error
+        if *alphabet == "" && *size == 0 {
+                strIdList.List, err = stringid.Base64(*length, *num, *padding)
+        } else {
+                name := *alphabet
+                if name == "" {
+                        name = "base64url"
+                }
+                chars, aerr := stringid.ResolveAlphabet(name)
+                if aerr != nil {
+                        return aerr
+                }
+                if *size == 0 {
+                        *size = stringid.DefaultSize
+                }
+                strIdList.List, err = stringid.Generate(chars, *size, *num)
+        }
+        if err != nil {
+                return err
+        }
+        rows := [][]string{{"ID"}}
+        for _, id := range strIdList.List {
+                rows = append(rows, []string{id})
+        }
+        return cli.PrintOutput(stdout, *output, strIdList, rows)
+}
+
+func main() {
+        if err := run(os.Args[1:], os.Stdout); err != nil {
+                fmt.Fprintln(os.Stderr, err)
+                os.Exit(1)
+        }
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+        "bytes"
+        "encoding/json"
+        "net/http"
+        "net/http/httptest"
+        "strconv"
+        "strings"
+        "testing"
+        "time"
+        "github.com/spinaki/distributed-unique-id/client"
+        "github.com/stretchr/testify/assert"
+)
+
+func runIdctl(t *testing.T, args ...string) string {
+        var out bytes.Buffer
+        if err := run(args, &out); err != nil {
+                t.Fatal("idctl failed: ", err)
+        }
+        return out.String()
+}
+
+func TestIdctlGenAndDecode(t *testing.T) {
+        idRange := &struct {
+                LowerBound uint64 `json:"lower_bound"`
+                UpperBound uint64 `json:"upper_bound"`
+                MachineID  uint16 `json:"machine_id"`
+        }{}
+        out := runIdctl(t, "gen", "-kind", "range", "-machine-id", "7", "-epoch", "2020-01-01T00:00:00Z")
+        if err := json.Unmarshal([]byte(out), idRange); err != nil {
+                t.Fatal("range cannot be unmarshalled: ", out)
+        }
+        assert.Equal(t, uint64(255), idRange.UpperBound - idRange.LowerBound, "a range is a tick")
+        assert.Equal(t, uint16(7), idRange.MachineID, "machine id mismatch")
+
+        decoded := &DecodedID{}
+        out = runIdctl(t, "decode", "-epoch", "2020-01-01T00:00:00Z", strconv.FormatUint(idRange.UpperBound, 10))
+        if err := json.Unmarshal([]byte(out), decoded); err != nil {
+                t.Fatal("decoded id cannot be unmarshalled: ", out)
+        }
+        assert.Equal(t, uint64(7), decoded.MachineID, "machine id mismatch")
+        assert.Equal(t, uint64(255), decoded.Sequence, "sequence mismatch")
+        assert.True(t, time.Since(decoded.Timestamp) < time.Minute, "timestamp should be now: %v", decoded.Timestamp)
+
+        t.Setenv("UNIQUE_ID_POD_IP", "10.0.1.65")
+        single := &struct {
+                ID        uint64 `json:"id"`
+                MachineID uint16 `json:"machine_id"`
+        }{}
+        json.Unmarshal([]byte(runIdctl(t, "gen")), single)
+        assert.Equal(t, uint16(1 << 8 + 65), single.MachineID, "machine id from the pod ip")
+        assert.Equal(t, uint64(0), single.ID & 255, "the first id of the tick")
+}
+
+func TestIdctlGenLayout(t *testing.T) {
+        idList := &struct {
+                List      []string `json:"id_list"`
+                MachineID uint16   `json:"machine_id"`
+                Format    string   `json:"format"`
+        }{}
+        out := runIdctl(t, "gen", "-kind", "list", "-format", "hex", "-machine-id", "1", "-time-unit", "1ms",
+                "-bit-len-time", "41", "-bit-len-machine-id", "12", "-bit-len-sequence", "10")
+        if err := json.Unmarshal([]byte(out), idList); err != nil {
+                t.Fatal("list cannot be unmarshalled: ", out)
+        }
+        assert.Equal(t, 1024, len(idList.List), "a list is a tick")
+        assert.Equal(t, "hex", idList.Format, "format mismatch")
+
+        var out2 bytes.Buffer
+        err := run([]string{"gen", "-machine-id", "300", "-bit-len-machine-id", "8",
+                "-bit-len-sequence", "16"}, &out2)
+        assert.NotNil(t, err, "machine id should not fit into 8 bits")
+        err = run([]string{"gen", "-bit-len-time", "40"}, &out2)
+        assert.NotNil(t, err, "layout should be invalid")
+        err = run([]string{"gen", "-machine-id", "1", "-epoch", "2999-01-01T00:00:00Z"}, &out2)
+        assert.NotNil(t, err, "epoch in the future")
+}
+
+func TestIdctlDecodeTable(t *testing.T) {
+        // time 1, machine id 2, sequence 3 in the default layout
+        id := uint64(1) << 24 | 2 << 8 | 3
+        base62, _ := client.Encode(id, client.FormatBase62)
+        out := runIdctl(t, "decode", "-format", "base62", "-o", "table", base62)
+        lines := strings.Split(strings.TrimSpace(out), "\n")
+        assert.Equal(t, 2, len(lines), "a header and a row")
+        assert.Equal(t, []string{base62, "1", "2", "3", "2016-01-01T00:00:00.01Z"}, strings.Fields(lines[1]), "row mismatch")
+}
+
+func TestIdctlDecodeWithServerInfo(t *testing.T) {
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                w.Write([]byte(`{"name": "default", "strategy": "snowflake", "namespaces": [
+                        {"name": "orders", "strategy": "snowflake", "start_time": "2020-01-01T00:00:00Z", "time_unit": "1ms",
+                         "layout": {"bit_len_time": 41, "bit_len_machine_id": 12, "bit_len_sequence": 10}}]}`))
+        }))
+        defer server.Close()
+        id := uint64(5000) << 22 | 321 << 10 | 9
+
+        decoded := &DecodedID{}
+        out := runIdctl(t, "decode", "-server", server.URL, "-ns", "orders", strconv.FormatUint(id, 10))
+        if err := json.Unmarshal([]byte(out), decoded); err != nil {
+                t.Fatal("decoded id cannot be unmarshalled: ", out)
+        }
+        assert.Equal(t, uint64(321), decoded.MachineID, "machine id mismatch")
+        assert.Equal(t, time.Date(2020, 1, 1, 0, 0, 5, 0, time.UTC), decoded.Timestamp, "the epoch and unit of the server")
+
+        var out2 bytes.Buffer
+        assert.NotNil(t, run([]string{"decode", "-server", server.URL, "-ns", "payments", "1"}, &out2), "unknown namespace")
+}
+
+func TestIdctlEncode(t *testing.T) {
+        var converted []ConvertedID
+        out := runIdctl(t, "encode", "-to", "hex", "255", "4096")
+        if err := json.Unmarshal([]byte(out), &converted); err != nil {
+                t.Fatal("converted ids cannot be unmarshalled: ", out)
+        }
+        assert.Equal(t, []ConvertedID{{"255", "00000000000000ff"}, {"4096", "0000000000001000"}}, converted, "hex mismatch")
+
+        out = runIdctl(t, "encode", "-from", "hex", "-to", "number", "-o", "table", "ff")
+        assert.Equal(t, []string{"hex", "number", "ff", "255"}, strings.Fields(out), "table mismatch")
+
+        var out2 bytes.Buffer
+        assert.NotNil(t, run([]string{"encode", "-from", "hex", "xyz"}, &out2), "invalid hex id")
+}
+
+func TestIdctlStringId(t *testing.T) {
+        strIdList := &StringIDList{}
+        out := runIdctl(t, "stringid", "-num", "3", "-alphabet", "numeric", "-size", "10")
+        if err := json.Unmarshal([]byte(out), strIdList); err != nil {
+                t.Fatal("string ids cannot be unmarshalled: ", out)
+        }
+        assert.Equal(t, 3, len(strIdList.List), "number of ids mismatch")
+        for _, id := range strIdList.List {
+                assert.Equal(t, 10, len(id), "size mismatch")
+                assert.Equal(t, "", strings.Trim(id, "0123456789"), "only digits")
+        }
+
+        out = runIdctl(t, "stringid", "-len", "4", "-padding=false", "-o", "table")
+        assert.Equal(t, []string{"ID"}, strings.Fields(out)[:1], "table header mismatch")
+        assert.Equal(t, 6, len(strings.Fields(out)[1]), "4 bytes are 6 base64 chars without padding")
+}
+
+func TestIdctlUnknownCommand(t *testing.T) {
+        var out bytes.Buffer
+        assert.NotNil(t, run([]string{"mint"}, &out), "unknown command")
+        assert.NotNil(t, run(nil, &out), "missing command")
+        assert.NotNil(t, run([]string{"gen", "-o", "yaml", "-machine-id", "1"}, &out), "unknown output")
+}
@@ -0,0 +1,243 @@
+// Command idload drives a running unique id service at a target rate and reports latency percentiles.
+// Every id returned is kept, so a single duplicate across all clients fails the run.
+//
+//     go run ./cmd/idload -url http://localhost:8080 -path /longids -qps 200 -clients 16 -duration 30s
+package main
+
+import (
+        "encoding/json"
+        "flag"
+        "fmt"
+        "io"
+        "math"
+        "net/http"
+        "os"
+        "sort"
+        "strconv"
+        "sync"
+        "time"
+)
+
+// loadConfig describes one load test run.
+type loadConfig struct {
+        URL      string
+        Path     string
+        QPS      int // 0 means as fast as the clients can go
+        Clients  int
+        Duration time.Duration
+        Timeout  time.Duration
+        APIKey   string
+}
+
+// maxQPS is the highest rate whose interval between requests is at least a nanosecond.
+const maxQPS = int(time.Second)
+
+func (config loadConfig) validate() error {
+        if config.Clients < 1 {
+                return fmt.Errorf("clients has to be positive")
+        }
+        if config.QPS < 0 || config.QPS > maxQPS {
+                return fmt.Errorf("qps has to be between 0 and %d", maxQPS)
+        }
+        return nil
+}
+
+// report is the outcome of a run.
+type report struct {
+        Requests   int
+        Errors     int
+        IDs        int
+        Duplicates []string
+        Latencies  []time.Duration // sorted
+        Elapsed    time.Duration
+}
+
+// idResponse covers the bodies of the id endpoints: lists, single ids and numeric ranges.
+type idResponse struct {
+        List       []json.RawMessage `json:"id_list"`
+        ID         json.RawMessage   `json:"id"`
+        LowerBound json.RawMessage   `json:"lower_bound"`
+        UpperBound json.RawMessage   `json:"upper_bound"`
+}
+
+// ids returns the ids of a response as strings, expanding ranges. String ids keep their quotes, so a
+// numeric id and its decimal string do not compare equal.
+func (r *idResponse) ids() ([]string, error) {
+        var ids []string
+        for _, id := range r.List {
+                ids = append(ids, string(id))
+        }
+        if len(r.ID) > 0 {
+                ids = append(ids, string(r.ID))
+        }
+        if len(r.LowerBound) > 0 || len(r.UpperBound) > 0 {
+                lower, err := strconv.ParseUint(string(r.LowerBound), 10, 64)
+                if err != nil {
+                        return nil, fmt.Errorf("ranges have to be numeric: %v", err)
+                }
+                upper, err := strconv.ParseUint(string(r.UpperBound), 10, 64)
+                if err != nil || upper < lower {
+                        return nil, fmt.Errorf("invalid range %s-%s", r.LowerBound, r.UpperBound)
+                }
+                for id := lower; id <= upper; id++ {
+                        ids = append(ids, strconv.FormatUint(id, 10))
+                }
+        }
+        if len(ids) == 0 {
+                return nil, fmt.Errorf("no ids in response")
+        }
+        return ids, nil
+}
+
+// collector records the results of all clients.
+type collector struct {
+        mutex      sync.Mutex
+        seen       map[string]struct{}
+        duplicates []string
+        latencies  []time.Duration
+        errors     int
+}
+
+func (c *collector) add(latency time.Duration, ids []string, err error) {
+        c.mutex.Lock()
+        defer c.mutex.Unlock()
+        c.latencies = append(c.latencies, latency)
+        if err != nil {
+                c.errors++
+                return
+        }
+        for _, id := range ids {
+                if _, ok := c.seen[id]; ok {
+                        c.duplicates = append(c.duplicates, id)
+                        continue
+                }
+                c.seen[id] = struct{}{}
+        }
+}
+
+// run sends requests from config.Clients concurrent clients until config.Duration is over.
+// With a QPS the requests of all clients together are paced to that rate.
+func run(config loadConfig) *report {
+        client := &http.Client{Timeout: config.Timeout}
+        results := &collector{seen: make(map[string]struct{})}
+
+        var tokens <-chan time.Time
+        if config.QPS > 0 {
+                ticker := time.NewTicker(time.Second / time.Duration(config.QPS))
+                defer ticker.Stop()
+                tokens = ticker.C
+        }
+
+        start := time.Now()
+        deadline := start.Add(config.Duration)
+        var wg sync.WaitGroup
+        for i := 0; i < config.Clients; i++ {
+                wg.Add(1)
+                go func() {
+                        defer wg.Done()
+                        for time.Now().Before(deadline) {
+                                if tokens != nil {
+                                        select {
+                                        case <-tokens:
+                                        case <-time.After(time.Until(deadline)):
+                                                return
+                                        }
+                                }
+                                requestStart := time.Now()
+                                ids, err := fetchIDs(client, config)
+                                results.add(time.Since(requestStart), ids, err)
+                        }
+                }()
+        }
+        wg.Wait()
+
+        sort.Slice(results.latencies, func(i, j int) bool { return results.latencies[i] < results.latencies[j] })
+        return &report{
+                Requests:   len(results.latencies),
+                Errors:     results.errors,
+                IDs:        len(results.seen),
+                Duplicates: results.duplicates,
+                Latencies:  results.latencies,
+                Elapsed:    time.Since(start),
+        }
+}
+
+func fetchIDs(client *http.Client, config loadConfig) ([]string, error) {
+        req, err := http.NewRequest("GET", config.URL + config.Path, nil)
+        if err != nil {
+                return nil, err
+        }
+        if config.APIKey != "" {
+                req.Header.Set("X-API-Key", config.APIKey)
+        }
+        resp, err := client.Do(req)
+        if err != nil {
+                return nil, err
+        }
+        defer resp.Body.Close()
+        body, err := io.ReadAll(resp.Body)
+        if err != nil {
+                return nil, err
+        }
+        if resp.StatusCode != http.StatusOK {
+                return nil, fmt.Errorf("status %d", resp.StatusCode)
+        }
+        var response idResponse
+        if err := json.Unmarshal(body, &response); err != nil {
+                return nil, err
+        }
+        return response.ids()
+}
+
+// percentile returns the nearest rank percentile p of the sorted latencies, the smallest latency at or
+// above which the fraction p of them fall.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+        if len(sorted) == 0 {
+                return 0
+        }
+        i := int(math.Ceil(p * float64(len(sorted)))) - 1
+        if i < 0 {
+                i = 0
+        }
+        if i >= len(sorted) {
+                i = len(sorted) - 1
+        }
+        return sorted[i]
+}
+
+func (r *report) print(w io.Writer) {
+        fmt.Fprintf(w, "requests: %d in %v (%.1f/s), errors: %d\n", r.Requests, r.Elapsed.Round(time.Millisecond),
+                float64(r.Requests) / r.Elapsed.Seconds(), r.Errors)
+        fmt.Fprintf(w, "latency p50: %v p99: %v p999: %v\n", percentile(r.Latencies, 0.5),
+                percentile(r.Latencies, 0.99), percentile(r.Latencies, 0.999))
+        fmt.Fprintf(w, "unique ids: %d, duplicates: %d\n", r.IDs, len(r.Duplicates))
+        for i, id := range r.Duplicates {
+                if i == 10 {
+                        fmt.Fprintf(w, "  ... and %d more\n", len(r.Duplicates) - i)
+                        break
+                }
+                fmt.Fprintf(w, "  duplicate id %s\n", id)
+        }
+}
+
+func main() {
+        var config loadConfig
+        flag.StringVar(&config.URL, "url", "http://localhost:8080", "base url of the id service")
+        flag.StringVar(&config.Path, "path", "/longids", "endpoint to load, with query string")
+        flag.IntVar(&config.QPS, "qps", 100, "target requests per second of all clients together, 0 for unlimited")
+        flag.IntVar(&config.Clients, "clients", 8, "number of concurrent clients")
+        flag.DurationVar(&config.Duration, "duration", 10 * time.Second, "length of the run")
+        flag.DurationVar(&config.Timeout, "timeout", 5 * time.Second, "timeout of a request")
+        flag.StringVar(&config.APIKey, "key", os.Getenv("UNIQUE_ID_API_KEY"), "api key sent in X-API-Key")
+        flag.Parse()
+        if err := config.validate(); err != nil {
+                fmt.Fprintln(os.Stderr, err)
+                os.Exit(2)
+        }
+
+        r := run(config)
+        r.print(os.Stdout)
+        if len(r.Duplicates) > 0 || r.Requests == 0 || r.Errors == r.Requests {
+                os.Exit(1)
+        }
+}
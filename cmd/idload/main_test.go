@@ -0,0 +1,79 @@
+package main
+
+import (
+        "bytes"
+        "fmt"
+        "net/http"
+        "net/http/httptest"
+        "strings"
+        "sync/atomic"
+        "testing"
+        "time"
+        "github.com/stretchr/testify/assert"
+)
+
+func TestRunCountsUniqueIds(t *testing.T) {
+        var next uint64
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                lower := atomic.AddUint64(&next, 10) - 10
+                fmt.Fprintf(w, `{"lower_bound": %d, "upper_bound": %d, "machine_id": 1}`, lower, lower + 9)
+        }))
+        defer server.Close()
+
+        r := run(loadConfig{URL: server.URL, Path: "/longidrange", QPS: 200, Clients: 4,
+                Duration: 200 * time.Millisecond, Timeout: time.Second})
+        assert.True(t, r.Requests > 10, "requests should have been sent")
+        assert.True(t, r.Requests <= 45, "requests should be paced to the qps")
+        assert.Equal(t, 0, r.Errors, "no request should fail")
+        assert.Equal(t, r.Requests * 10, r.IDs, "every range should be counted")
+        assert.Empty(t, r.Duplicates, "ranges do not overlap")
+}
+
+func TestRunFindsDuplicates(t *testing.T) {
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                fmt.Fprint(w, `{"id_list": ["a", "b"], "machine_id": 1}`)
+        }))
+        defer server.Close()
+
+        r := run(loadConfig{URL: server.URL, Path: "/stringids", Clients: 2, Duration: 50 * time.Millisecond,
+                Timeout: time.Second})
+        assert.Equal(t, 2, r.IDs, "only two distinct ids")
+        assert.Equal(t, 2 * r.Requests - 2, len(r.Duplicates), "every repeated id is a duplicate")
+
+        var out bytes.Buffer
+        r.print(&out)
+        assert.True(t, strings.Contains(out.String(), `duplicate id "a"`), out.String())
+}
+
+func TestRunCountsErrors(t *testing.T) {
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                w.WriteHeader(http.StatusTooManyRequests)
+        }))
+        defer server.Close()
+
+        r := run(loadConfig{URL: server.URL, Path: "/longids", QPS: 100, Clients: 1, Duration: 50 * time.Millisecond,
+                Timeout: time.Second})
+        assert.Equal(t, r.Requests, r.Errors, "every request should fail")
+        assert.Equal(t, 0, r.IDs, "failed requests carry no ids")
+}
+
+func TestPercentile(t *testing.T) {
+        var latencies []time.Duration
+        for i := 1; i <= 1000; i++ {
+                latencies = append(latencies, time.Duration(i) * time.Millisecond)
+        }
+        assert.Equal(t, 500 * time.Millisecond, percentile(latencies, 0.5), "p50 mismatch")
+        assert.Equal(t, 990 * time.Millisecond, percentile(latencies, 0.99), "p99 mismatch")
+        assert.Equal(t, 999 * time.Millisecond, percentile(latencies, 0.999), "p999 mismatch")
+        assert.Equal(t, 1000 * time.Millisecond, percentile(latencies, 1), "p100 is the maximum")
+        assert.Equal(t, time.Millisecond, percentile(latencies, 0), "p0 is the minimum")
+        assert.Equal(t, time.Duration(0), percentile(nil, 0.5), "no latencies")
+}
+
+func TestValidate(t *testing.T) {
+        assert.Nil(t, loadConfig{Clients: 1, QPS: 100}.validate(), "config should be valid")
+        assert.Nil(t, loadConfig{Clients: 1}.validate(), "0 qps is unlimited")
+        assert.NotNil(t, loadConfig{Clients: 0}.validate(), "clients have to be positive")
+        assert.NotNil(t, loadConfig{Clients: 1, QPS: -1}.validate(), "negative qps")
+        assert.NotNil(t, loadConfig{Clients: 1, QPS: maxQPS + 1}.validate(), "qps above a request per nanosecond")
+}
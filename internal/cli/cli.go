@@ -0,0 +1,134 @@
+// Package cli holds what the commands of the server binary and of idctl share: the command table entries, the
+// flags describing a generator and the JSON or table output.
+package cli
+
+import (
+        "encoding/json"
+        "flag"
+        "fmt"
+        "io"
+        "text/tabwriter"
+        "time"
+        "github.com/spinaki/distributed-unique-id/client"
+        "github.com/spinaki/distributed-unique-id/internal/machineid"
+)
+
+// Command is a command run instead of the server, or by idctl: <binary> <command> [args].
+type Command struct {
+        Usage string
+        Run   func(args []string, stdout io.Writer) error
+}
+
+// Defaults of the generator flags, the settings of the default generator of the server.
+const (
+        DefaultEpoch    = "2016-01-01T00:00:00Z"
+        DefaultTimeUnit = 10 * time.Millisecond
+)
+
+// DefaultLayout is the 39-16-8 layout of the server.
+var DefaultLayout = client.Layout{BitLenTime: 39, BitLenMachineID: 16, BitLenSequence: 8}
+
+// GeneratorFlags describe the generator whose ids are minted, decoded or audited. The defaults match the server.
+type GeneratorFlags struct {
+        Epoch           *string
+        TimeUnit        *time.Duration
+        bitLenTime      *uint
+        bitLenMachineID *uint
+        bitLenSequence  *uint
+        machineID       *int
+}
+
+// AddGeneratorFlags adds -epoch, -time-unit and the -bit-len-* flags.
+func AddGeneratorFlags(flags *flag.FlagSet) *GeneratorFlags {
+        return &GeneratorFlags{
+                Epoch:           flags.String("epoch", DefaultEpoch, "start time of the generator, RFC 3339"),
+                TimeUnit:        flags.Duration("time-unit", DefaultTimeUnit, "length of a tick"),
+                bitLenTime:      flags.Uint("bit-len-time", uint(DefaultLayout.BitLenTime), "bits of the time part"),
+                bitLenMachineID: flags.Uint("bit-len-machine-id", uint(DefaultLayout.BitLenMachineID), "bits of the machine id part"),
+                bitLenSequence:  flags.Uint("bit-len-sequence", uint(DefaultLayout.BitLenSequence), "bits of the sequence part"),
+        }
+}
+
+// AddMachineIDFlag adds -machine-id, for the commands which mint ids.
+func (g *GeneratorFlags) AddMachineIDFlag(flags *flag.FlagSet) {
+        g.machineID = flags.Int("machine-id", -1, "machine id, -1 derives it from the private ip like the server")
+}
+
+// Layout returns the layout of the -bit-len-* flags.
+func (g *GeneratorFlags) Layout() (client.Layout, error) {
+        l := client.Layout{BitLenTime: uint8(*g.bitLenTime), BitLenMachineID: uint8(*g.bitLenMachineID),
+                BitLenSequence: uint8(*g.bitLenSequence)}
+        if *g.bitLenTime > 63 || *g.bitLenMachineID > 16 || *g.bitLenSequence > 16 || !l.Valid() {
+                return l, fmt.Errorf("invalid layout %d/%d/%d", *g.bitLenTime, *g.bitLenMachineID, *g.bitLenSequence)
+        }
+        return l, nil
+}
+
+// StartTime returns the -epoch, checking the -time-unit as well.
+func (g *GeneratorFlags) StartTime() (time.Time, error) {
+        t, err := time.Parse(time.RFC3339, *g.Epoch)
+        if err != nil {
+                return t, fmt.Errorf("invalid epoch: %v", err)
+        }
+        if *g.TimeUnit <= 0 {
+                return t, fmt.Errorf("invalid time unit %v", *g.TimeUnit)
+        }
+        return t, nil
+}
+
+// Decoder returns a decoder of the ids of the generator.
+func (g *GeneratorFlags) Decoder() (*client.Decoder, error) {
+        layout, err := g.Layout()
+        if err != nil {
+                return nil, err
+        }
+        startTime, err := g.StartTime()
+        if err != nil {
+                return nil, err
+        }
+        return &client.Decoder{Layout: layout, StartTime: startTime, TimeUnit: *g.TimeUnit}, nil
+}
+
+// MachineID returns the machine id of the -machine-id flag, or derives it like the server from the private ip.
+// Like the server it refuses machine ids which do not fit into the layout rather than cutting them.
+func (g *GeneratorFlags) MachineID(layout client.Layout) (uint16, error) {
+        maxMachineID := 1 << layout.BitLenMachineID - 1
+        if g.machineID != nil && *g.machineID >= 0 {
+                if *g.machineID > maxMachineID {
+                        return 0, fmt.Errorf("machine id %d does not fit into %d bits", *g.machineID, layout.BitLenMachineID)
+                }
+                return uint16(*g.machineID), nil
+        }
+        machineID, source, err := machineid.FromPrivateIP()
+        if err != nil {
+                return 0, fmt.Errorf("%v, set -machine-id", err)
+        }
+        if int(machineID) > maxMachineID {
+                return 0, fmt.Errorf("machine id %d derived from %s does not fit into %d bits, set -machine-id", machineID,
+                        source, layout.BitLenMachineID)
+        }
+        return machineID, nil
+}
+
+// PrintOutput writes v as indented JSON, or rows as an aligned table.
+func PrintOutput(stdout io.Writer, output string, v interface{}, rows [][]string) error {
+        switch output {
+        case "json":
+                encoder := json.NewEncoder(stdout)
+                encoder.SetIndent("", "  ")
+                return encoder.Encode(v)
+        case "table":
+                w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+                for _, row := range rows {
+                        for i, cell := range row {
+                                if i > 0 {
+                                        fmt.Fprint(w, "\t")
+                                }
+                                fmt.Fprint(w, cell)
+                        }
+                        fmt.Fprintln(w)
+                }
+                return w.Flush()
+        }
+        return fmt.Errorf("unknown output %q, use json or table", output)
+}
@@ -0,0 +1,52 @@
+package cli
+
+import (
+        "bytes"
+        "flag"
+        "testing"
+        "github.com/stretchr/testify/assert"
+)
+
+func parseGeneratorFlags(t *testing.T, args ...string) *GeneratorFlags {
+        flags := flag.NewFlagSet("test", flag.ContinueOnError)
+        g := AddGeneratorFlags(flags)
+        g.AddMachineIDFlag(flags)
+        if err := flags.Parse(args); err != nil {
+                t.Fatal("flags not parsed: ", err)
+        }
+        return g
+}
+
+func TestGeneratorFlags(t *testing.T) {
+        layout, err := parseGeneratorFlags(t).Layout()
+        assert.Nil(t, err, "default layout should be valid")
+        assert.Equal(t, DefaultLayout, layout, "layout mismatch")
+        _, err = parseGeneratorFlags(t, "-bit-len-time", "40").Layout()
+        assert.NotNil(t, err, "64 bits should be invalid")
+        _, err = parseGeneratorFlags(t, "-bit-len-time", "303", "-bit-len-machine-id", "0", "-bit-len-sequence", "16").Layout()
+        assert.NotNil(t, err, "bit lengths should not wrap around")
+        _, err = parseGeneratorFlags(t, "-time-unit", "0s").Decoder()
+        assert.NotNil(t, err, "time unit has to be positive")
+}
+
+func TestMachineID(t *testing.T) {
+        narrow := parseGeneratorFlags(t, "-bit-len-time", "43", "-bit-len-machine-id", "12")
+        layout, _ := narrow.Layout()
+        t.Setenv("UNIQUE_ID_POD_IP", "10.0.16.5")
+        _, err := narrow.MachineID(layout)
+        assert.NotNil(t, err, "4101 should not be cut to 12 bits")
+        t.Setenv("UNIQUE_ID_POD_IP", "10.0.1.65")
+        machineID, err := narrow.MachineID(layout)
+        assert.Nil(t, err, "321 fits into 12 bits")
+        assert.Equal(t, uint16(321), machineID, "machine id from the pod ip")
+
+        _, err = parseGeneratorFlags(t, "-machine-id", "4096").MachineID(layout)
+        assert.NotNil(t, err, "the flag should fit as well")
+}
+
+func TestPrintOutput(t *testing.T) {
+        var out bytes.Buffer
+        assert.Nil(t, PrintOutput(&out, "table", nil, [][]string{{"A", "B"}, {"1", "22"}}), "table should print")
+        assert.Equal(t, "A  B\n1  22\n", out.String(), "table mismatch")
+        assert.NotNil(t, PrintOutput(&out, "yaml", nil, nil), "unknown output")
+}
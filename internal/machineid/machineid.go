@@ -0,0 +1,108 @@
+// Package machineid derives the machine id of a generator from the private ip of the host, the same way for the
+// server and the command line tools.
+package machineid
+
+import (
+        "errors"
+        "io/ioutil"
+        "net"
+        "net/http"
+        "os"
+        "time"
+)
+
+// Sources of a derived machine id.
+const (
+        FromPodIP     = "pod_ip"    // the UNIQUE_ID_POD_IP env variable
+        FromEC2       = "ec2"       // the private ip of the EC2 instance metadata
+        FromInterface = "interface" // the private ip of a network interface
+)
+
+// PodIPEnvVarKey is set to the ip of the pod in kubernetes.
+const PodIPEnvVarKey = "UNIQUE_ID_POD_IP"
+
+// FromPrivateIP returns the lower 16 bits of the private ip and where the ip was found: UNIQUE_ID_POD_IP,
+// the EC2 instance metadata or the first private ipv4 address of the interfaces, in this order.
+func FromPrivateIP() (uint16, string, error) {
+        source := FromPodIP
+        ip, err := PodIP()
+        if err != nil {
+                source = FromEC2
+                ip, err = EC2PrivateIPv4()
+        }
+        if err != nil {
+                source = FromInterface
+                ip, err = PrivateIPv4()
+        }
+        if err != nil {
+                return 0, "", err
+        }
+
+        return uint16(ip[2])<<8 + uint16(ip[3]), source, nil
+}
+
+// PrivateIPv4 returns the first private ipv4 address of the network interfaces.
+func PrivateIPv4() (net.IP, error) {
+        as, err := net.InterfaceAddrs()
+        if err != nil {
+                return nil, err
+        }
+
+        for _, a := range as {
+                ipnet, ok := a.(*net.IPNet)
+                if !ok || ipnet.IP.IsLoopback() {
+                        continue
+                }
+
+                ip := ipnet.IP.To4()
+                if IsPrivateIPv4(ip) {
+                        return ip, nil
+                }
+        }
+        return nil, errors.New("no private ip address")
+}
+
+// EC2PrivateIPv4 asks the instance metadata of an AWS EC2 instance for its private ip.
+func EC2PrivateIPv4() (net.IP, error) {
+        // URL to retrieve instance metadata in an AWS EC2 instance:
+        // http://docs.aws.amazon.com/en_us/AWSEC2/latest/UserGuide/ec2-instance-metadata.html
+        timeout := time.Duration( 10 * time.Millisecond)
+        client := http.Client{
+                Timeout: timeout,
+        }
+        res, err := client.Get("http://169.254.169.254/latest/meta-data/local-ipv4")
+        if err != nil {
+                return nil, err
+        }
+        defer res.Body.Close()
+
+        body, err := ioutil.ReadAll(res.Body)
+        if err != nil {
+                return nil, err
+        }
+
+        ip := net.ParseIP(string(body))
+        if ip == nil {
+                return nil, errors.New("invalid ip address")
+        }
+        return ip.To4(), nil
+}
+
+// PodIP returns the ip of UNIQUE_ID_POD_IP.
+func PodIP() (net.IP, error) {
+        podIpStr := os.Getenv(PodIPEnvVarKey)
+        if podIpStr == "" {
+                return nil, errors.New("Env Variable Not Present")
+        }
+        ip := net.ParseIP(podIpStr).To4()
+        if ip == nil {
+                return nil, errors.New("invalid ip address in " + PodIPEnvVarKey)
+        }
+        return ip, nil
+}
+
+// IsPrivateIPv4 reports whether ip is in one of the private ipv4 ranges.
+func IsPrivateIPv4(ip net.IP) bool {
+        return ip != nil &&
+                (ip[0] == 10 || ip[0] == 172 && (ip[1] >= 16 && ip[1] < 32) || ip[0] == 192 && ip[1] == 168)
+}
@@ -0,0 +1,28 @@
+package machineid
+
+import (
+        "net"
+        "testing"
+        "github.com/stretchr/testify/assert"
+)
+
+func TestFromPodIP(t *testing.T) {
+        t.Setenv(PodIPEnvVarKey, "10.0.1.65")
+        machineID, source, err := FromPrivateIP()
+        assert.Nil(t, err, "machine id not derived")
+        assert.Equal(t, uint16(321), machineID, "lower 16 bits of the pod ip")
+        assert.Equal(t, FromPodIP, source, "source mismatch")
+
+        t.Setenv(PodIPEnvVarKey, "fd00::1")
+        _, err = PodIP()
+        assert.NotNil(t, err, "ipv6 pod ips have no lower 16 bits of an ipv4")
+}
+
+func TestIsPrivateIPv4(t *testing.T) {
+        for _, ip := range []string{"10.1.2.3", "172.16.0.1", "192.168.1.1"} {
+                assert.True(t, IsPrivateIPv4(net.ParseIP(ip).To4()), ip + " is private")
+        }
+        for _, ip := range []string{"172.32.0.1", "8.8.8.8"} {
+                assert.False(t, IsPrivateIPv4(net.ParseIP(ip).To4()), ip + " is public")
+        }
+}
@@ -0,0 +1,135 @@
+// Package stringid generates random string ids: base64 encoded random bytes, or NanoID style ids of chars drawn
+// from an alphabet. It is shared by the /stringids endpoint of the service and cmd/idctl.
+package stringid
+
+import (
+        "crypto/rand"
+        "encoding/base64"
+        "errors"
+        "math"
+        "math/bits"
+)
+
+// Alphabets are the presets for random string ids. Any other string of 2 to 128 distinct ascii chars can be used
+// as a custom alphabet.
+var Alphabets = map[string]string{
+        "base64url":    "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_",
+        "alphanumeric": "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+        "hex":          "0123456789abcdef",
+        "numeric":      "0123456789",
+        "crockford":    "0123456789ABCDEFGHJKMNPQRSTVWXYZ",
+        "nolookalikes": "346789ABCDEFGHJKLMNPQRTUVWXYabcdefghijkmnpqrtwxyz", // no 1/l/I, 0/O/o, 2/Z, 5/S, u/v
+}
+
+// DefaultSize is the default size in chars of alphabet based ids, 21 base64url chars carry 126 bits.
+const DefaultSize = 21
+
+// ResolveAlphabet returns the chars of a preset name, or the given chars if they form a valid custom alphabet.
+// Ids are built byte by byte, so custom alphabets are limited to ascii, a multibyte char would be split.
+func ResolveAlphabet(nameOrChars string) (string, error) {
+        if chars, ok := Alphabets[nameOrChars]; ok {
+                return chars, nil
+        }
+        if len(nameOrChars) < 2 || len(nameOrChars) > 128 {
+                return "", errors.New("alphabet has to be a preset or 2 to 128 distinct ascii chars")
+        }
+        var seen [128]bool
+        for i := 0; i < len(nameOrChars); i++ {
+                if nameOrChars[i] >= 128 {
+                        return "", errors.New("alphabet chars have to be ascii")
+                }
+                if seen[nameOrChars[i]] {
+                        return "", errors.New("alphabet chars have to be distinct")
+                }
+                seen[nameOrChars[i]] = true
+        }
+        return nameOrChars, nil
+}
+
+// Generate returns numIds random ids of size chars drawn uniformly from alphabet.
+// Random bytes are masked to the next power of two above the alphabet size and values outside the
+// alphabet are thrown away, so no char is more likely than another.
+func Generate(alphabet string, size int, numIds int) ([]string, error) {
+        if len(alphabet) < 2 || len(alphabet) > 256 {
+                return nil, errors.New("alphabet has to have 2 to 256 chars")
+        }
+        if size < 1 {
+                return nil, errors.New("size has to be positive")
+        }
+        if numIds < 0 {
+                return nil, errors.New("number of ids cannot be negative")
+        }
+        mask := 1 << uint(bits.Len(uint(len(alphabet) - 1))) - 1
+        // read a bit more than needed on average so that most ids need a single read
+        step := int(math.Ceil(1.6 * float64(mask * size) / float64(len(alphabet))))
+        ids := make([]string, 0, numIds)
+        for i := 0; i < numIds; i++ {
+                id := make([]byte, 0, size)
+                for len(id) < size {
+                        b, err := randomBytes(step)
+                        if err != nil {
+                                return nil, err
+                        }
+                        for _, v := range b {
+                                if idx := int(v) & mask; idx < len(alphabet) {
+                                        id = append(id, alphabet[idx])
+                                        if len(id) == size {
+                                                break
+                                        }
+                                }
+                        }
+                }
+                ids = append(ids, string(id))
+        }
+        return ids, nil
+}
+
+// Base64 returns numIds ids of keyLength random bytes each, URL safe base64 encoded, with or without the
+// trailing "=" padding. It returns an error if the system's secure random number generator fails or
+// keyLength is not positive.
+func Base64(keyLength int, numIds int, padding bool) ([]string, error) {
+        if numIds < 0 {
+                return nil, errors.New("number of ids cannot be negative")
+        }
+        if keyLength < 1 {
+                return nil, errors.New("number of random bytes has to be positive")
+        }
+        encoding := base64.URLEncoding
+        if !padding {
+                encoding = base64.RawURLEncoding
+        }
+        ids := make([]string, 0, numIds)
+        for i := 0; i < numIds; i++ {
+                b, err := randomBytes(keyLength)
+                if err != nil {
+                        return nil, err
+                }
+                ids = append(ids, encoding.EncodeToString(b))
+        }
+        return ids, nil
+}
+
+// CollisionProbability returns the probability that at least two of volume random ids with the given
+// number of random bits are equal, using the birthday approximation 1 - exp(-n(n-1)/2^(bits+1)).
+func CollisionProbability(randomBits float64, volume float64) float64 {
+        if volume < 2 {
+                return 0
+        }
+        logPairs := math.Log(volume) + math.Log(volume - 1) - math.Ln2
+        x := math.Exp(logPairs - randomBits * math.Ln2)
+        return -math.Expm1(-x)
+}
+
+// AlphabetBits returns the number of random bits in an id of size chars of the alphabet.
+func AlphabetBits(alphabet string, size int) float64 {
+        return float64(size) * math.Log2(float64(len(alphabet)))
+}
+
+// randomBytes returns n bytes of the secure random number generator.
+func randomBytes(n int) ([]byte, error) {
+        b := make([]byte, n)
+        if _, err := rand.Read(b); err != nil {
+                return nil, err
+        }
+        return b, nil
+}
@@ -0,0 +1,70 @@
+package stringid
+
+import (
+        "testing"
+        "fmt"
+        "strings"
+        "github.com/stretchr/testify/assert"
+)
+
+func TestAlphabetStringIds(t *testing.T) {
+        for name := range Alphabets {
+                alphabet, err := ResolveAlphabet(name)
+                assert.Nil(t, err, "Preset should resolve")
+                ids, err := Generate(alphabet, 21, 10)
+                if err != nil {
+                        t.Fatal("string ids not generated")
+                }
+                assert.Equal(t, 10, len(ids), "Number of ids mismatch")
+                for _, id := range ids {
+                        assert.Equal(t, 21, len(id), "ID length should be 21 chars")
+                        for _, c := range id {
+                                assert.Condition(t, func() bool { return strings.ContainsRune(alphabet, c) }, "Char not in alphabet " + name)
+                        }
+                }
+                fmt.Println(name, ids[0])
+        }
+}
+
+func TestAlphabetUniform(t *testing.T) {
+        // 3 chars are masked to 2 bits, a biased generator would favour one of them
+        ids, err := Generate("abc", 30000, 1)
+        if err != nil {
+                t.Fatal("string ids not generated")
+        }
+        for _, c := range "abc" {
+                count := strings.Count(ids[0], string(c))
+                assert.Condition(t, func() bool { return count > 9000 && count < 11000 }, "Char count should be close to 10000")
+        }
+}
+
+func TestGenerateInvalidCount(t *testing.T) {
+        _, err := Generate("abc", 10, -1)
+        assert.NotNil(t, err, "A negative number of ids should be an error")
+        ids, err := Generate("abc", 10, 0)
+        assert.Nil(t, err, "No ids should not be an error")
+        assert.Equal(t, 0, len(ids), "No ids expected")
+}
+
+func TestCustomAlphabet(t *testing.T) {
+        alphabet, err := ResolveAlphabet("xyz")
+        assert.Nil(t, err, "Custom alphabet should resolve")
+        assert.Equal(t, "xyz", alphabet, "Custom alphabet mismatch")
+        _, err = ResolveAlphabet("x")
+        assert.NotNil(t, err, "Single char alphabet should be rejected")
+        _, err = ResolveAlphabet("xyzx")
+        assert.NotNil(t, err, "Repeated chars should be rejected")
+        _, err = ResolveAlphabet("αβγδ")
+        assert.NotNil(t, err, "Multibyte chars should be rejected")
+        _, err = ResolveAlphabet("ab\xff")
+        assert.NotNil(t, err, "Non ascii bytes should be rejected")
+}
+
+func TestCollisionProbability(t *testing.T) {
+        // 2^32 ids of 64 bits collide with a probability of about 1 - e^-0.5
+        p := CollisionProbability(64, 1 << 32)
+        assert.InDelta(t, 0.3935, p, 0.001, "Collision probability mismatch")
+        assert.Equal(t, float64(0), CollisionProbability(64, 1), "Single id cannot collide")
+        p = CollisionProbability(AlphabetBits(Alphabets["base64url"], 21), 1e9)
+        assert.Condition(t, func() bool { return p > 0 && p < 1e-18 }, "Collision probability of nanoid should be tiny")
+}